@@ -6,15 +6,19 @@ package ciphersuite
 import "hash"
 
 type Suite interface {
-	// when we protect or deprotect 3/4 of 2^exp packets, we ask for KeyUpdate
-	// if peer does not respond quickly. and we reach 2^exp, we close connection for good
+	// [rfc9147:4.5.3] confidentiality limit, when we protect or deprotect 3/4 of it, we ask for KeyUpdate,
+	// if peer does not respond quickly, and we reach limit, we close connection for good
 	ProtectionLimit() uint64
+	// [rfc9147:4.5.3] integrity limit, when so many records fail deprotection, we close connection
+	IntegrityLimit() uint64
 	// used for transcript hash for handshake. Unfortunately, allocates.
 	NewHasher() hash.Hash
 	// used for HKDF and such. Unfortunately, allocates.
 	NewHMAC(key []byte) hash.Hash
-	// Allocates only when cannot replace keys
-	ResetSymmetricKeys(keys SymmetricKeys, secret Hash) SymmetricKeys
+	// Allocates only when cannot replace keys.
+	// If plaintextSeqNum is set, sequence number key is not derived (and not stored, when possible),
+	// and EncryptSeqMask returns zero mask [draft-pismenny-tls-dtls-plaintext-sequence-number]
+	ResetSymmetricKeys(keys SymmetricKeys, secret Hash, plaintextSeqNum bool) SymmetricKeys
 	EmptyHash() Hash
 }
 
@@ -12,7 +12,7 @@ import (
 type SymmetricKeys interface {
 	RecordOverhead() (AEADSealSize int, MinCiphertextSize int)
 
-	// error if called with too short ciphertext
+	// error if called with too short ciphertext, zero mask if sequence numbers are not encrypted
 	EncryptSeqMask(ciphertext []byte) ([2]byte, error)
 
 	// [.................................................] <-- datagramLeft
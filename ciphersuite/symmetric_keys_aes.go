@@ -15,7 +15,8 @@ import (
 const symmetricKeysAESSealSize = 16
 
 type SymmetricKeysAES struct {
-	SN      cipher.Block
+	SN cipher.Block // nil if sequence numbers are not encrypted, saves the whole AES context
+
 	Write   cipher.AEAD
 	WriteIV [12]byte
 }
@@ -26,9 +27,12 @@ func (keys *SymmetricKeysAES) RecordOverhead() (AEADSealSize int, MinCiphertextS
 
 func (keys *SymmetricKeysAES) EncryptSeqMask(ciphertext []byte) ([2]byte, error) {
 	var mask [aes.BlockSize]byte
-	if len(ciphertext) < keys.SN.BlockSize() {
+	if len(ciphertext) < aes.BlockSize {
 		return [2]byte{}, dtlserrors.WarnCipherTextTooShortForSNDecryption
 	}
+	if keys.SN == nil {
+		return [2]byte{}, nil
+	}
 	keys.SN.Encrypt(mask[:], ciphertext)
 	return [2]byte(mask[0:2]), nil
 }
@@ -83,14 +87,18 @@ func NewGCMCipher(block cipher.Block) cipher.AEAD {
 	return c
 }
 
-func (keys *SymmetricKeysAES) fillWithSecret(hmacSecret hash.Hash, keyStorage []byte) {
+func (keys *SymmetricKeysAES) fillWithSecret(hmacSecret hash.Hash, keyStorage []byte, plaintextSeqNum bool) {
 	// write key
 	HKDFExpandLabel(keyStorage[:], hmacSecret, "key", nil)
 	keys.Write = NewGCMCipher(NewAesCipher(keyStorage[:]))
 
 	// sn key
-	HKDFExpandLabel(keyStorage[:], hmacSecret, "sn", nil)
-	keys.SN = NewAesCipher(keyStorage[:])
+	if plaintextSeqNum {
+		keys.SN = nil
+	} else {
+		HKDFExpandLabel(keyStorage[:], hmacSecret, "sn", nil)
+		keys.SN = NewAesCipher(keyStorage[:])
+	}
 
 	HKDFExpandLabel(keys.WriteIV[:], hmacSecret, "iv", nil)
 }
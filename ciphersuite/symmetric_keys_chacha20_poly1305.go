@@ -6,6 +6,7 @@ package ciphersuite
 import (
 	"crypto/cipher"
 	"encoding/binary"
+	"hash"
 
 	"github.com/hrissan/dtls/dtlserrors"
 	"github.com/hrissan/dtls/record"
@@ -15,16 +16,28 @@ import (
 
 const symmetricKeysChaCha20Poly1305SealSize = 16
 
-type SymmetricKeysChaCha20Poly1305 struct {
-	SNKey   [32]byte
+// [draft-pismenny-tls-dtls-plaintext-sequence-number] separate type, so sequence number key is not stored
+type SymmetricKeysChaCha20Poly1305PlaintextSN struct {
 	Write   cipher.AEAD
 	WriteIV [12]byte
 }
 
-func (keys *SymmetricKeysChaCha20Poly1305) RecordOverhead() (AEADSealSize int, MinCiphertextSize int) {
+type SymmetricKeysChaCha20Poly1305 struct {
+	SymmetricKeysChaCha20Poly1305PlaintextSN
+	SNKey [32]byte
+}
+
+func (keys *SymmetricKeysChaCha20Poly1305PlaintextSN) RecordOverhead() (AEADSealSize int, MinCiphertextSize int) {
 	return symmetricKeysChaCha20Poly1305SealSize, 16
 }
 
+func (keys *SymmetricKeysChaCha20Poly1305PlaintextSN) EncryptSeqMask(ciphertext []byte) ([2]byte, error) {
+	if len(ciphertext) < 16 {
+		return [2]byte{}, dtlserrors.WarnCipherTextTooShortForSNDecryption
+	}
+	return [2]byte{}, nil
+}
+
 func (keys *SymmetricKeysChaCha20Poly1305) EncryptSeqMask(ciphertext []byte) ([2]byte, error) {
 	if len(ciphertext) < 16 {
 		return [2]byte{}, dtlserrors.WarnCipherTextTooShortForSNDecryption
@@ -43,7 +56,7 @@ func (keys *SymmetricKeysChaCha20Poly1305) EncryptSeqMask(ciphertext []byte) ([2
 	return [2]byte(mask[0:2]), nil
 }
 
-func (keys *SymmetricKeysChaCha20Poly1305) AEADEncrypt(seq uint64, datagramLeft []byte, hdrSize int, plaintextSize int) {
+func (keys *SymmetricKeysChaCha20Poly1305PlaintextSN) AEADEncrypt(seq uint64, datagramLeft []byte, hdrSize int, plaintextSize int) {
 	iv := keys.WriteIV
 	FillIVSequence(iv[:], seq)
 
@@ -54,12 +67,12 @@ func (keys *SymmetricKeysChaCha20Poly1305) AEADEncrypt(seq uint64, datagramLeft
 	if &encrypted[0] != &datagramLeft[hdrSize] {
 		panic("gcm.Seal reallocated datagram storage")
 	}
-	if len(encrypted) != len(plaintext)+symmetricKeysAESSealSize {
+	if len(encrypted) != len(plaintext)+symmetricKeysChaCha20Poly1305SealSize {
 		panic("gcm.Seal length mismatch")
 	}
 }
 
-func (keys *SymmetricKeysChaCha20Poly1305) AEADDecrypt(rec record.Encrypted, seq uint64) (plaintextSize int, err error) {
+func (keys *SymmetricKeysChaCha20Poly1305PlaintextSN) AEADDecrypt(rec record.Encrypted, seq uint64) (plaintextSize int, err error) {
 	gcm := keys.Write
 	iv := keys.WriteIV // copy, otherwise disaster
 
@@ -71,7 +84,7 @@ func (keys *SymmetricKeysChaCha20Poly1305) AEADDecrypt(rec record.Encrypted, seq
 	if &decrypted[0] != &rec.Ciphertext[0] {
 		panic("gcm.Open reallocated datagram storage")
 	}
-	if len(decrypted)+symmetricKeysAESSealSize != len(rec.Ciphertext) {
+	if len(decrypted)+symmetricKeysChaCha20Poly1305SealSize != len(rec.Ciphertext) {
 		panic("unexpected decrypted body size")
 	}
 	return len(decrypted), nil
@@ -84,3 +97,11 @@ func NewChacha20Poly1305(key []byte) cipher.AEAD {
 	}
 	return c
 }
+
+func (keys *SymmetricKeysChaCha20Poly1305PlaintextSN) fillWithSecret(hmacSecret hash.Hash) {
+	var writeKey [chacha20poly1305.KeySize]byte
+	HKDFExpandLabel(writeKey[:], hmacSecret, "key", nil)
+	keys.Write = NewChacha20Poly1305(writeKey[:])
+
+	HKDFExpandLabel(keys.WriteIV[:], hmacSecret, "iv", nil)
+}
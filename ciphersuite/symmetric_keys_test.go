@@ -0,0 +1,35 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package ciphersuite
+
+import (
+	"testing"
+)
+
+func TestResetSymmetricKeys_PlaintextSeqNum(t *testing.T) {
+	for _, id := range []ID{TLS_AES_128_GCM_SHA256, TLS_AES_256_GCM_SHA384, TLS_CHACHA20_POLY1305_SHA256} {
+		suite := GetSuite(id)
+		secret := suite.EmptyHash() // any secret of suite hash length
+		ciphertext := []byte("0123456789abcdef")
+
+		keys := suite.ResetSymmetricKeys(nil, secret, false)
+		if mask, err := keys.EncryptSeqMask(ciphertext); err != nil || mask == [2]byte{} {
+			t.Fatalf("suite %x: sequence number must be encrypted", id)
+		}
+		// reuse keys object, as we do when updating keys
+		keys = suite.ResetSymmetricKeys(keys, secret, true)
+		if mask, err := keys.EncryptSeqMask(ciphertext); err != nil || mask != [2]byte{} {
+			t.Fatalf("suite %x: sequence number must not be encrypted", id)
+		}
+		if aesKeys, ok := keys.(*SymmetricKeysAES); ok && aesKeys.SN != nil {
+			t.Fatalf("suite %x: sequence number key must not be stored", id)
+		}
+		if _, ok := keys.(*SymmetricKeysChaCha20Poly1305); ok {
+			t.Fatalf("suite %x: sequence number key must not be stored", id)
+		}
+		if _, err := keys.EncryptSeqMask(ciphertext[:15]); err == nil {
+			t.Fatalf("suite %x: short ciphertext must be rejected", id)
+		}
+	}
+}
@@ -17,6 +17,11 @@ func (s *impl_TLS_AES_128_GCM_SHA256) ProtectionLimit() uint64 {
 	return 1 << 24
 }
 
+func (s *impl_TLS_AES_128_GCM_SHA256) IntegrityLimit() uint64 {
+	// [rfc9147:4.5.3] AEAD_AES_128_GCM and AEAD_AES_256_GCM
+	return 1 << 36
+}
+
 func (s *impl_TLS_AES_128_GCM_SHA256) NewHasher() hash.Hash {
 	return sha256.New()
 }
@@ -25,14 +30,14 @@ func (s *impl_TLS_AES_128_GCM_SHA256) NewHMAC(key []byte) hash.Hash {
 	return hmac.New(sha256.New, key)
 }
 
-func (s *impl_TLS_AES_128_GCM_SHA256) ResetSymmetricKeys(keys SymmetricKeys, secret Hash) SymmetricKeys {
+func (s *impl_TLS_AES_128_GCM_SHA256) ResetSymmetricKeys(keys SymmetricKeys, secret Hash, plaintextSeqNum bool) SymmetricKeys {
 	ourKeys, _ := keys.(*SymmetricKeysAES)
 	if ourKeys == nil {
 		ourKeys = &SymmetricKeysAES{}
 	}
 	hmacSecret := s.NewHMAC(secret.GetValue())
 
-	ourKeys.fillWithSecret(hmacSecret, make([]byte, 16)) // on stack
+	ourKeys.fillWithSecret(hmacSecret, make([]byte, 16), plaintextSeqNum) // on stack
 	return ourKeys
 }
 
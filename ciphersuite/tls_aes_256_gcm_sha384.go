@@ -17,6 +17,11 @@ func (s *impl_TLS_AES_256_GCM_SHA384) ProtectionLimit() uint64 {
 	return 1 << 24
 }
 
+func (s *impl_TLS_AES_256_GCM_SHA384) IntegrityLimit() uint64 {
+	// [rfc9147:4.5.3] AEAD_AES_128_GCM and AEAD_AES_256_GCM
+	return 1 << 36
+}
+
 func (s *impl_TLS_AES_256_GCM_SHA384) NewHasher() hash.Hash {
 	return sha512.New384()
 }
@@ -25,14 +30,14 @@ func (s *impl_TLS_AES_256_GCM_SHA384) NewHMAC(key []byte) hash.Hash {
 	return hmac.New(sha512.New384, key)
 }
 
-func (s *impl_TLS_AES_256_GCM_SHA384) ResetSymmetricKeys(keys SymmetricKeys, secret Hash) SymmetricKeys {
+func (s *impl_TLS_AES_256_GCM_SHA384) ResetSymmetricKeys(keys SymmetricKeys, secret Hash, plaintextSeqNum bool) SymmetricKeys {
 	ourKeys, _ := keys.(*SymmetricKeysAES)
 	if ourKeys == nil {
 		ourKeys = &SymmetricKeysAES{}
 	}
 	hmacSecret := s.NewHMAC(secret.GetValue())
 
-	ourKeys.fillWithSecret(hmacSecret, make([]byte, 32)) // on stack
+	ourKeys.fillWithSecret(hmacSecret, make([]byte, 32), plaintextSeqNum) // on stack
 	return ourKeys
 }
 
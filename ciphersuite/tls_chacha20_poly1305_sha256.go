@@ -18,6 +18,11 @@ func (s *impl_TLS_CHACHA20_POLY1305_SHA256) ProtectionLimit() uint64 {
 	return math.MaxUint64
 }
 
+func (s *impl_TLS_CHACHA20_POLY1305_SHA256) IntegrityLimit() uint64 {
+	// [rfc9147:4.5.3] AEAD_CHACHA20_POLY1305
+	return 1 << 36
+}
+
 func (s *impl_TLS_CHACHA20_POLY1305_SHA256) NewHasher() hash.Hash {
 	return sha256.New()
 }
@@ -26,23 +31,22 @@ func (s *impl_TLS_CHACHA20_POLY1305_SHA256) NewHMAC(key []byte) hash.Hash {
 	return hmac.New(sha256.New, key)
 }
 
-func (s *impl_TLS_CHACHA20_POLY1305_SHA256) ResetSymmetricKeys(keys SymmetricKeys, secret Hash) SymmetricKeys {
+func (s *impl_TLS_CHACHA20_POLY1305_SHA256) ResetSymmetricKeys(keys SymmetricKeys, secret Hash, plaintextSeqNum bool) SymmetricKeys {
+	hmacSecret := s.NewHMAC(secret.GetValue())
+	if plaintextSeqNum {
+		ourKeys, _ := keys.(*SymmetricKeysChaCha20Poly1305PlaintextSN)
+		if ourKeys == nil {
+			ourKeys = &SymmetricKeysChaCha20Poly1305PlaintextSN{}
+		}
+		ourKeys.fillWithSecret(hmacSecret)
+		return ourKeys
+	}
 	ourKeys, _ := keys.(*SymmetricKeysChaCha20Poly1305)
 	if ourKeys == nil {
 		ourKeys = &SymmetricKeysChaCha20Poly1305{}
 	}
-
-	const keySize = 32
-
-	hmacSecret := s.NewHMAC(secret.GetValue())
-
-	var writeKey [keySize]byte
-	HKDFExpandLabel(writeKey[:], hmacSecret, "key", nil)
-	ourKeys.Write = NewChacha20Poly1305(writeKey[:])
-
+	ourKeys.fillWithSecret(hmacSecret)
 	HKDFExpandLabel(ourKeys.SNKey[:], hmacSecret, "sn", nil)
-
-	HKDFExpandLabel(ourKeys.WriteIV[:], hmacSecret, "iv", nil)
 	return ourKeys
 }
 
@@ -5,6 +5,7 @@ package chat
 
 import (
 	"fmt"
+	"net/netip"
 	"strings"
 	"sync"
 
@@ -37,6 +38,26 @@ func (conn *Conn) OnDisconnectLocked(err error) {
 	delete(conn.chatRoom.connections, conn)
 }
 
+func (conn *Conn) OnClientAuthenticationLocked(info dtlscore.ClientAuthenticationInfo, err error) {
+	if err != nil {
+		fmt.Printf("chat room client authentication from %q failed: %v\n", conn.AddrLocked(), err)
+		return
+	}
+	if info.Leaf == nil {
+		fmt.Printf("chat room client from %q declined authentication\n", conn.AddrLocked())
+		return
+	}
+	fmt.Printf("chat room client from %q authenticated as %q\n", conn.AddrLocked(), info.Leaf.Subject.String())
+}
+
+func (conn *Conn) OnAddressChangedLocked(oldAddr netip.AddrPort, newAddr netip.AddrPort) {
+	fmt.Printf("chat room client moved from %q to %q\n", oldAddr, newAddr)
+}
+
+func (conn *Conn) OnPathMTUChangedLocked(pathMTU int) {
+	fmt.Printf("chat room client path MTU is %d\n", pathMTU)
+}
+
 func (conn *Conn) OnWriteRecordLocked(earlyData bool, recordBody []byte) (recordSize int, send bool, signalWriteable bool, err error) {
 	conn.chatRoom.mu.Lock()
 	defer conn.chatRoom.mu.Unlock()
@@ -50,11 +71,15 @@ func (conn *Conn) OnReadRecordLocked(earlyData bool, recordBody []byte) error {
 	conn.chatRoom.mu.Lock()
 	defer conn.chatRoom.mu.Unlock()
 
-	switch strings.TrimSpace(string(recordBody)) {
-	case "upds":
-		conn.DebugKeyUpdateLocked(false)
-	case "updsr":
-		conn.DebugKeyUpdateLocked(true)
+	switch command := strings.TrimSpace(string(recordBody)); command {
+	case "upds", "updsr":
+		if err := conn.RequestKeyUpdateLocked(command == "updsr"); err != nil {
+			fmt.Printf("chat room cannot request key update from %q: %v\n", conn.AddrLocked(), err)
+		}
+	case "auth":
+		if err := conn.RequestClientAuthenticationLocked(); err != nil {
+			fmt.Printf("chat room cannot request authentication from %q: %v\n", conn.AddrLocked(), err)
+		}
 	}
 	fmt.Printf("chat room message from %q, sending to %d buddies: %q\n", conn.AddrLocked(), len(conn.chatRoom.connections), recordBody)
 	for buddy := range conn.chatRoom.connections {
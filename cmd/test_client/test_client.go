@@ -30,6 +30,13 @@ func main() {
 	opts.PSKClientIdentities = append(opts.PSKClientIdentities, []byte(chat.PSKClientIdentity))
 	opts.PSKAppendSecret = chat.PSKAppendSecret
 
+	opts.PostHandshakeAuth = true
+	if err := opts.LoadClientCertificate(
+		"../../wolfssl-examples/certs/client-cert.pem",
+		"../../wolfssl-examples/certs/client-key.pem"); err != nil {
+		fmt.Printf("will decline post-handshake authentication: %v\n", err)
+	}
+
 	snd := dtlsudp.NewSender(opts)
 	t := dtlscore.NewTransport(opts, snd, nil)
 	// client := chat.NewClient(t)
@@ -5,6 +5,7 @@ package main
 
 import (
 	"log"
+	"runtime"
 
 	"github.com/hrissan/dtls/cmd/chat"
 	"github.com/hrissan/dtls/dtlscore"
@@ -25,6 +26,7 @@ func main() {
 	opts.ALPN = [][]byte{[]byte("toyrpc/0.2"), []byte("toyrpc/0.3")}
 	opts.ServerDisableHRR = true
 	opts.PSKAppendSecret = chat.PSKAppendSecret
+	opts.ComputeGoroutines = runtime.NumCPU() // pool is run by dtlsudp.GoRunUDP
 
 	if err := opts.LoadServerCertificate(
 		"../../wolfssl-examples/certs/server-cert.pem",
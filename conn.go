@@ -6,6 +6,7 @@ package dtls
 import (
 	"io"
 	"net"
+	"net/netip"
 	"time"
 
 	"github.com/hrissan/dtls/dtlscore"
@@ -52,11 +53,16 @@ func signalCond(cond chan struct{}) {
 }
 
 func (c *Conn) LocalAddr() net.Addr                { return c.localAddr }
-func (c *Conn) RemoteAddr() net.Addr               { return c.remoteAddr }
 func (c *Conn) SetDeadline(t time.Time) error      { return nil } // TODO
 func (c *Conn) SetReadDeadline(t time.Time) error  { return nil } // TODO
 func (c *Conn) SetWriteDeadline(t time.Time) error { return nil } // TODO
 
+func (c *Conn) RemoteAddr() net.Addr {
+	c.tc.Lock()
+	defer c.tc.Unlock()
+	return c.remoteAddr
+}
+
 func (c *Conn) Read(b []byte) (int, error) {
 	if len(b) == 0 {
 		return 0, nil
@@ -114,6 +120,7 @@ func (c *Conn) Close() error {
 	c.tc.Lock()
 	defer c.tc.Unlock()
 	c.closeLocked(nil)
+	_ = c.tc.ShutdownLocked(record.AlertCloseNormal())
 	return c.closeErr
 }
 
@@ -135,14 +142,25 @@ func (c *Conn) OnHandshakeLocked(info dtlscore.HandshakeInfo) {
 func (c *Conn) OnConnectLocked() {
 }
 
+func (c *Conn) OnClientAuthenticationLocked(info dtlscore.ClientAuthenticationInfo, err error) {
+}
+
+func (c *Conn) OnAddressChangedLocked(oldAddr netip.AddrPort, newAddr netip.AddrPort) {
+	c.remoteAddr = net.UDPAddrFromAddrPort(newAddr)
+}
+
+func (c *Conn) OnPathMTUChangedLocked(pathMTU int) {
+	// Write splits data into records itself
+}
+
 func (c *Conn) OnDisconnectLocked(err error) {
 	signalCond(c.condDial)
 	c.closeLocked(err)
 }
 
 func (c *Conn) OnWriteRecordLocked(earlyData bool, recordBody []byte) (recordSize int, send bool, signalWriteable bool, err error) {
-	if c.closed {
-		return 0, false, false, net.ErrClosed
+	if c.closed { // we already initiated shutdown
+		return 0, false, false, nil
 	}
 	if len(c.writing) == 0 {
 		return 0, false, false, nil
@@ -160,8 +178,8 @@ func (c *Conn) OnWriteRecordLocked(earlyData bool, recordBody []byte) (recordSiz
 }
 
 func (conn *Conn) OnReadRecordLocked(earlyData bool, recordBody []byte) error {
-	if conn.closed {
-		return io.EOF
+	if conn.closed { // we already initiated shutdown
+		return nil
 	}
 	if len(recordBody) == 0 {
 		return nil // we do not store empty records, they violate io.Reader contract
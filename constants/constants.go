@@ -34,11 +34,19 @@ const MinFragmentBodySize = 32
 
 const MaxPSKIdentities = 32
 
-// Our implementation's limit. Mostly for checking automatic key update works.
-// Should be >32 even in tests, otherwise KeyUpdate cannot complete before reaching hard limit.
-const MaxProtectionLimitSend = 32
-const MaxProtectionLimitReceive = 32
+// [rfc9146:3] allows up to 255 bytes, but we store both our and peer's CID
+// in every connection, so we limit them to save memory.
+const MaxConnectionIDLength = 20
 
+// [rfc9147:4.4]
+const MinimumPMTUv4 = 576 - 8 - 20  // minus UDP header, minus IPv4 header
+const MinimumPMTUv6 = 1280 - 8 - 40 // minus UDP header, minus IPv6 header
+
+// UDP payload, cannot be larger
+const MaxPMTU = 65535 - 8 - 20
+
+// [rfc9147:4.5.3] soft limit for AEAD limits of suites, we start KeyUpdate when reached,
+// and close connection when hard limit (suite limit itself) is reached.
 // not actual constant, but we do not want a single float in our code base
 func ProtectionSoftLimit(limit uint64) uint64 {
 	return limit * 3 / 4
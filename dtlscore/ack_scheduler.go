@@ -0,0 +1,64 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"time"
+
+	"github.com/hrissan/dtls/record"
+)
+
+// [rfc9147:7.1] We ack immediately when peer is probably waiting for our ack (record arrived out of order,
+// flight is complete, or peer retransmitted something we already processed), otherwise after 1/4 of
+// retransmission timeout, so several records are acked together. Acks are also sent with any datagram
+// we send before that (see constructDatagramLocked), so they are coalesced with our data.
+// Records to ack are counted per connection and reported to Stats with ack, not per record,
+// so receivers of different sockets do not contend on shared counters.
+
+func (conn *Connection) addAckLocked(rn record.Number, immediate bool) {
+	conn.keys.AddAck(rn)
+	immediate = immediate || conn.receivedOutOfOrderLocked(rn)
+	conn.recordsToAck++
+	if immediate {
+		conn.immediateRecordsToAck++
+		conn.sendAckNow = true
+		return
+	}
+	if conn.ackDeadlineUnixNano == 0 {
+		conn.ackDeadlineUnixNano = time.Now().UnixNano() + int64(conn.rtt.timeout()/4)
+		conn.armTimerLocked()
+	}
+}
+
+// record arrived after later one, or some records before it are missing
+func (conn *Connection) receivedOutOfOrderLocked(rn record.Number) bool {
+	if rn.Epoch() == 0 {
+		return false // plaintext records have no replay window
+	}
+	window := &conn.keys.ReceiveNextSeq
+	if conn.keys.NewReceiveKeysSet && rn.Epoch() == conn.keys.ReceiveEpoch {
+		window = &conn.keys.NewReceiveNextSeq
+	}
+	seq := rn.SeqNum()
+	return seq+1 != window.GetNextReceivedSeq() || (seq != 0 && !window.IsSetBit(seq-1))
+}
+
+// called after ack record constructed
+func (conn *Connection) ackSentLocked(recordsAcked int) {
+	conn.tr.opts.Stats.AckSent(conn.addr, int(conn.recordsToAck), int(conn.immediateRecordsToAck), recordsAcked) // widening
+	conn.recordsToAck = 0
+	conn.immediateRecordsToAck = 0
+	if conn.keys.SendAcks.GetBitCount() == 0 {
+		conn.sendAckNow = false
+		conn.ackDeadlineUnixNano = 0
+	}
+}
+
+func (conn *Connection) onAckTimerLocked() {
+	conn.ackDeadlineUnixNano = 0
+	if conn.keys.SendAcks.GetBitCount() != 0 {
+		conn.sendAckNow = true
+		conn.SignalWriteable()
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"crypto/sha256"
+	"net/netip"
+	"testing"
+
+	"github.com/hrissan/dtls/handshake"
+	"github.com/hrissan/dtls/record"
+	"github.com/hrissan/dtls/transport/stats"
+)
+
+func TestAckScheduler(t *testing.T) {
+	conn, _ := newEstablishedTestConnection(netip.MustParseAddrPort("127.0.0.1:1"))
+	opts := conn.tr.opts
+	receive := func(seq uint64) record.Number {
+		conn.keys.ReceiveNextSeq.SetNextReceived(seq + 1)
+		conn.keys.ReceiveNextSeq.SetBit(seq)
+		return record.NumberWith(3, seq)
+	}
+	receive(5)
+	conn.addAckLocked(receive(6), false)
+	if conn.hasDataToSendLocked() || conn.ackDeadlineUnixNano == 0 {
+		t.Fatalf("ack for record in order must be delayed")
+	}
+	conn.addAckLocked(receive(9), false)
+	if !conn.hasDataToSendLocked() {
+		t.Fatalf("ack for record after gap must be sent immediately")
+	}
+	var datagram [1500]byte
+	if _, _, datagramSize, _ := conn.constructDatagram(opts, datagram[:]); datagramSize == 0 {
+		t.Fatalf("ack must be sent")
+	}
+	if conn.sendAckNow || conn.ackDeadlineUnixNano != 0 || conn.keys.SendAcks.GetBitCount() != 0 {
+		t.Fatalf("both acks must be sent in the same record")
+	}
+	if recordsToAck, immediateAcks, acksSent, _ := opts.Stats.(*stats.StatsLog).AckCounters(); recordsToAck != 2 || immediateAcks != 1 || acksSent != 1 || conn.recordsToAck != 0 {
+		t.Fatalf("records to ack must be reported with ack")
+	}
+	conn.addAckLocked(receive(10), false)
+	if conn.hasDataToSendLocked() {
+		t.Fatalf("ack for record in order must be delayed")
+	}
+	conn.onAckTimerLocked()
+	if !conn.hasDataToSendLocked() {
+		t.Fatalf("delayed ack must be sent when timer fires")
+	}
+	_, _, _, _ = conn.constructDatagram(opts, datagram[:])
+	conn.addAckLocked(record.NumberWith(3, 7), false) // late arrival fills the gap
+	if conn.keys.SendAcks.GetBitCount() != 1 || !conn.sendAckNow {
+		t.Fatalf("ack for late record must be sent immediately")
+	}
+}
+
+func TestAckScheduler_EndOfFlight(t *testing.T) {
+	conn, _ := newEstablishedTestConnection(netip.MustParseAddrPort("127.0.0.1:1"))
+	conn.stateID = smIDHandshakeClientExpectCertVerify // expects Certificate, CertificateVerify and Finished from server
+	conn.hctx = newHandshakeContext(sha256.New())
+	rq := &conn.hctx.receivedMessages
+	conn.keys.ReceiveNextSeq.SetBit(5) // no gap before our records
+	seq := uint64(6)
+	receive := func(msgType handshake.MsgType, msgSeq uint16, offset uint32, length uint32, total uint32) {
+		conn.keys.ReceiveNextSeq.SetNextReceived(seq + 1)
+		conn.keys.ReceiveNextSeq.SetBit(seq)
+		fragment := handshake.Fragment{
+			Header: handshake.FragmentHeader{MsgType: msgType, Length: total,
+				FragmentInfo: handshake.FragmentInfo{MsgSeq: msgSeq, FragmentOffset: offset, FragmentLength: length}},
+			Body: make([]byte, length),
+		}
+		if _, err := rq.ReceivedFragment(conn, fragment, record.NumberWith(3, seq)); err != nil {
+			t.Fatalf("failed to receive fragment: %v", err)
+		}
+		seq++
+	}
+	receive(handshake.MsgTypeCertificate, 0, 0, 100, 100)
+	if conn.sendAckNow || conn.ackDeadlineUnixNano == 0 {
+		t.Fatalf("ack for message in the middle of flight must be delayed")
+	}
+	receive(handshake.MsgTypeFinished, 1, 0, 16, 32)
+	if conn.sendAckNow {
+		t.Fatalf("ack for the first fragment of Finished must be delayed")
+	}
+	receive(handshake.MsgTypeFinished, 1, 16, 16, 32)
+	if !conn.sendAckNow || !conn.hasDataToSendLocked() {
+		t.Fatalf("ack for the last message of peer's flight must be sent without delay")
+	}
+	var datagram [1500]byte
+	if _, _, datagramSize, _ := conn.constructDatagram(conn.tr.opts, datagram[:]); datagramSize == 0 || conn.keys.SendAcks.GetBitCount() != 0 {
+		t.Fatalf("all records of the flight must be acked together")
+	}
+}
@@ -66,9 +66,15 @@ func GenerateStatelessHRR(params cookie.Params, datagram []byte, ck []byte) ([]b
 	return datagram, msgBody
 }
 
-func generateEncryptedExtensions(alpnSelected []byte) handshake.Message {
+// recordSizeLimit == 0 means client did not send record_size_limit
+func generateEncryptedExtensions(alpnSelected []byte, recordSizeLimit uint16, rrc bool) handshake.Message {
 	ee := handshake.ExtensionsSet{
 		SupportedGroupsSet: true,
+		RRCSet:             rrc,
+	}
+	if recordSizeLimit != 0 {
+		ee.RecordSizeLimitSet = true
+		ee.RecordSizeLimit = recordSizeLimit
 	}
 	ee.SupportedGroups.SECP256R1 = true
 	ee.SupportedGroups.SECP384R1 = true
@@ -89,13 +95,21 @@ func generateEncryptedExtensions(alpnSelected []byte) handshake.Message {
 	}
 }
 
-func generateServerCertificate(opts *Options) handshake.Message {
+func generateCertificate(requestContext []byte, chain [][]byte, ocspStaple []byte) handshake.Message {
 	msg := handshake.MsgCertificate{
-		CertificatesLength: len(opts.ServerCertificate.Certificate),
+		RequestContext:     requestContext,
+		CertificatesLength: len(chain),
 	}
-	for i, certData := range opts.ServerCertificate.Certificate {
+	for i, certData := range chain {
 		msg.Certificates[i].CertData = certData // those slices are not retained beyond this func
 	}
+	if len(ocspStaple) != 0 && len(chain) != 0 { // [rfc8446:4.4.2.1] in the leaf CertificateEntry
+		var ext handshake.ExtensionsSet
+		ext.StatusRequestSet = true
+		ext.StatusRequest.OCSP = true
+		ext.StatusRequest.OCSPResponse = ocspStaple
+		msg.Certificates[0].SetExtensions(&ext)
+	}
 	messageBody := msg.Write(nil) // TODO - reuse message bodies in a rope
 	return handshake.Message{
 		MsgType: handshake.MsgTypeCertificate,
@@ -103,18 +117,15 @@ func generateServerCertificate(opts *Options) handshake.Message {
 	}
 }
 
-func generateServerCertificateVerify(opts *Options, conn *Connection, hctx *handshakeContext) (handshake.Message, error) {
+// transcriptHash must contain all messages up to Certificate
+func generateCertificateVerify(opts *Options, roleServer bool, privateRsa *rsa.PrivateKey, transcriptHash ciphersuite.Hash) (handshake.Message, error) {
 	msg := handshake.MsgCertificateVerify{
 		SignatureScheme: handshake.SignatureAlgorithm_RSA_PSS_RSAE_SHA256,
 	}
 
 	// [rfc8446:4.4.3] - certificate verification
-	var certVerifyTranscriptHash ciphersuite.Hash
-	certVerifyTranscriptHash.SetSum(hctx.transcriptHasher)
-
-	sigMessageHash := signature.CalculateCoveredContentHash(sha256.New(), certVerifyTranscriptHash.GetValue())
+	sigMessageHash := signature.CalculateCoveredContentHash(sha256.New(), roleServer, transcriptHash.GetValue())
 
-	privateRsa := opts.ServerCertificate.PrivateKey.(*rsa.PrivateKey)
 	sig, err := signature.CreateSignature_RSA_PSS_RSAE_SHA256(opts.Rnd, privateRsa, sigMessageHash.GetValue())
 	if err != nil {
 		fmt.Printf("create signature error: %v\n", err)
@@ -129,7 +140,7 @@ func generateServerCertificateVerify(opts *Options, conn *Connection, hctx *hand
 	}, nil
 }
 
-func (conn *Connection) onClientHello2Locked(opts *Options, addr netip.AddrPort, serverUsedHRR bool,
+func (conn *Connection) onClientHello2Locked(opts *Options, shard int, addr netip.AddrPort, localAddr netip.Addr, serverUsedHRR bool,
 	earlySecret ciphersuite.Hash, pskSelected bool, pskSelectedIdentity uint16, alpnSelected []byte,
 	msgClientHello handshake.MsgClientHello, params cookie.Params,
 	transcriptHasher hash.Hash, clientEarlyTrafficSecret ciphersuite.Hash) error {
@@ -141,18 +152,30 @@ func (conn *Connection) onClientHello2Locked(opts *Options, addr netip.AddrPort,
 		if params.TimestampUnixNano <= conn.cookieTimestampUnixNano {
 			return nil // simply ignore
 		}
+		if !conn.tr.reserveHandshakeSlot() {
+			return dtlserrors.WarnHandshakeLimit // keep existing connection
+		}
+		if conn.closeErr == nil {
+			conn.closeErr = dtlserrors.ErrConnectionReplaced
+		}
 		conn.resetToClosedLocked(false)
 	}
 	conn.stateID = smIDHandshakeServerCalcServerHello2
+	conn.shard = uint8(shard) // truncation, checked in NewShardedTransport
 	conn.keys.SuiteID = params.CipherSuite
 	conn.addr = addr
+	conn.localAddr = localAddr
 	conn.cookieTimestampUnixNano = params.TimestampUnixNano
 	conn.tr.addToMap(conn, addr)
 
 	hctx := newHandshakeContext(transcriptHasher)
 	conn.hctx = hctx
+	conn.inHandshake.Store(true)
+	conn.startHandshakeTimerLocked(opts)
+	conn.tr.addHandshake(conn, hctx)
 	hctx.serverUsedHRR = serverUsedHRR // we do not use it anywhere for now, but set anyway
 	hctx.ALPNSelected = alpnSelected
+	hctx.postHandshakeAuth = msgClientHello.Extensions.PostHandshakeAuthSet
 
 	suite := conn.keys.Suite()
 
@@ -165,19 +188,53 @@ func (conn *Connection) onClientHello2Locked(opts *Options, addr netip.AddrPort,
 	}
 	fmt.Printf("start handshake keyShareSet=%v initial hello transcript hash(hex): %x\n", params.KeyShareSet, params.TranscriptHash.GetValue())
 	opts.Rnd.ReadMust(hctx.localRandom[:])
-	hctx.ComputeKeyShare(opts.Rnd)
 	hctx.earlySecret = earlySecret
+	hctx.pskSelected = pskSelected
+	hctx.pskSelectedIdentity = pskSelectedIdentity
+	hctx.sendOCSPStaple = msgClientHello.Extensions.StatusRequestSet
 
 	if clientEarlyTrafficSecret != (ciphersuite.Hash{}) {
 		fmt.Printf("server early traffic secret: %x\n", clientEarlyTrafficSecret.GetValue())
-		conn.keys.ReceiveSymmetric = suite.ResetSymmetricKeys(conn.keys.ReceiveSymmetric, clientEarlyTrafficSecret)
+		conn.keys.ReceiveSymmetric = suite.ResetSymmetricKeys(conn.keys.ReceiveSymmetric, clientEarlyTrafficSecret, false)
 		conn.keys.ReceiveEpoch = 1
 		conn.debugPrintKeys()
 	}
 
+	if opts.UseConnectionID && msgClientHello.Extensions.ConnectionIDSet {
+		if err := conn.setSendCIDLocked(msgClientHello.Extensions.ConnectionID); err != nil {
+			return err
+		}
+		if err := conn.assignReceiveCIDLocked(opts); err != nil {
+			return err
+		}
+		hctx.sendConnectionID = true
+		conn.rrcNegotiated = msgClientHello.Extensions.RRCSet
+	}
+	if opts.PlaintextSequenceNumbers && msgClientHello.Extensions.PlaintextSequenceNumberSet {
+		conn.keys.DoNotEncryptSequenceNumbers = true // before handshake keys are computed
+	}
+	if msgClientHello.Extensions.RecordSizeLimitSet {
+		// [rfc8449:4] we must not send records larger than protocol allows, even if peer allows it
+		conn.sendRecordSizeLimit = min(msgClientHello.Extensions.RecordSizeLimit, record.MaxPlaintextRecordLength+1)
+	}
+
+	conn.handler.OnConnectLocked()
+
+	return conn.startComputationLocked(opts, computation{
+		kind:         computeServerKeyShare,
+		peerKeyShare: msgClientHello.Extensions.KeyShare.X25519PublicKey,
+	})
+}
+
+// server flight up to Certificate, then certificate_verify is computed
+func (conn *Connection) onServerKeyShareComputedLocked(opts *Options, x25519Secret *ecdh.PrivateKey, sharedSecret []byte) error {
+	hctx := conn.hctx
+	suite := conn.keys.Suite()
+	hctx.x25519Secret = x25519Secret
+
 	serverHello := handshake.MsgServerHello{
 		Random:      hctx.localRandom,
-		CipherSuite: params.CipherSuite,
+		CipherSuite: conn.keys.SuiteID,
 	}
 	serverHello.Extensions.SupportedVersionsSet = true
 	serverHello.Extensions.SupportedVersions.SelectedVersion = handshake.DTLS_VERSION_13
@@ -185,8 +242,14 @@ func (conn *Connection) onClientHello2Locked(opts *Options, addr netip.AddrPort,
 	serverHello.Extensions.KeyShare.X25519PublicKeySet = true
 	copy(serverHello.Extensions.KeyShare.X25519PublicKey[:], hctx.x25519Secret.PublicKey().Bytes())
 
-	serverHello.Extensions.PreSharedKeySet = pskSelected
-	serverHello.Extensions.PreSharedKey.SelectedIdentity = pskSelectedIdentity
+	if hctx.sendConnectionID {
+		serverHello.Extensions.ConnectionIDSet = true
+		serverHello.Extensions.ConnectionID = conn.receiveCIDLocked() // empty if we do not need it
+	}
+	serverHello.Extensions.PlaintextSequenceNumberSet = conn.keys.DoNotEncryptSequenceNumbers
+
+	serverHello.Extensions.PreSharedKeySet = hctx.pskSelected
+	serverHello.Extensions.PreSharedKey.SelectedIdentity = hctx.pskSelectedIdentity
 
 	// TODO - get body from the rope
 	serverHelloBody := serverHello.Write(nil)
@@ -199,56 +262,55 @@ func (conn *Connection) onClientHello2Locked(opts *Options, addr netip.AddrPort,
 		panic("pushing ServerHello must never fail")
 	}
 
-	conn.handler.OnConnectLocked()
-
-	// TODO - move to calculator goroutine
-	remotePublic, err := ecdh.X25519().NewPublicKey(msgClientHello.Extensions.KeyShare.X25519PublicKey[:])
-	if err != nil {
-		panic("curve25519.X25519 failed")
-	}
-	sharedSecret, err := hctx.x25519Secret.ECDH(remotePublic)
-	if err != nil {
-		panic("curve25519.X25519 failed")
-	}
-
 	var handshakeTranscriptHash ciphersuite.Hash
 	handshakeTranscriptHash.SetSum(hctx.transcriptHasher)
 
 	hctx.masterSecret, hctx.handshakeTrafficSecretSend, hctx.handshakeTrafficSecretReceive =
 		conn.keys.ComputeHandshakeKeys(suite, true, hctx.earlySecret, sharedSecret, handshakeTranscriptHash)
-	hctx.SendSymmetricEpoch2 = suite.ResetSymmetricKeys(hctx.SendSymmetricEpoch2, hctx.handshakeTrafficSecretSend)
+	hctx.SendSymmetricEpoch2 = suite.ResetSymmetricKeys(hctx.SendSymmetricEpoch2, hctx.handshakeTrafficSecretSend, conn.keys.DoNotEncryptSequenceNumbers)
 	conn.debugPrintKeys()
-	if err := hctx.PushMessage(conn, generateEncryptedExtensions(hctx.ALPNSelected)); err != nil {
+	var recordSizeLimit uint16
+	if conn.sendRecordSizeLimit != 0 {
+		recordSizeLimit = opts.recordSizeLimit()
+	}
+	if err := hctx.PushMessage(conn, generateEncryptedExtensions(hctx.ALPNSelected, recordSizeLimit, conn.rrcNegotiated)); err != nil {
 		return err
 	}
-
-	if !pskSelected {
-		if err := hctx.PushMessage(conn, generateServerCertificate(opts)); err != nil {
-			return err
-		}
-
-		// TODO - offload to calculator goroutine
-		msgCertificateVerify, err := generateServerCertificateVerify(opts, conn, hctx)
-		if err != nil {
-			return err // TODO - test on this path. Should close connection immediately
-		}
-		if err := hctx.PushMessage(conn, msgCertificateVerify); err != nil {
-			return err
-		}
+	if hctx.pskSelected {
+		return conn.finishServerFlightLocked()
+	}
+	var ocspStaple []byte
+	if hctx.sendOCSPStaple {
+		ocspStaple = conn.tr.ocspStaple()
 	}
+	if err := hctx.PushMessage(conn, generateCertificate(nil, opts.ServerCertificate.Certificate, ocspStaple)); err != nil {
+		return err
+	}
+	c := computation{kind: computeServerCertVerify}
+	c.transcriptHash.SetSum(hctx.transcriptHasher)
+	conn.stateID = smIDHandshakeServerCalcCertVerify
+	return conn.startComputationLocked(opts, c)
+}
+
+func (conn *Connection) finishServerFlightLocked() error {
+	hctx := conn.hctx
+	suite := conn.keys.Suite()
 	if err := hctx.PushMessage(conn, hctx.generateFinished(conn)); err != nil {
 		return err
 	}
 
+	var handshakeTranscriptHash ciphersuite.Hash
 	handshakeTranscriptHash.SetSum(hctx.transcriptHasher)
 	conn.keys.ComputeApplicationTrafficSecret(suite, true, hctx.masterSecret, handshakeTranscriptHash)
 
-	conn.keys.SendSymmetric = suite.ResetSymmetricKeys(conn.keys.SendSymmetric, conn.keys.SendApplicationTrafficSecret)
+	conn.keys.SendSymmetric = suite.ResetSymmetricKeys(conn.keys.SendSymmetric, conn.keys.SendApplicationTrafficSecret, conn.keys.DoNotEncryptSequenceNumbers)
 	conn.keys.SendEpoch = 3
 	conn.keys.SendNextSeq = 0
+	conn.startSendKeysUsageLocked()
 	// Though we have keys for epoch 3 now, from our user's POV, we are sending
 	// early data until we verify client's finished.
 
 	conn.stateID = smIDHandshakeServerExpectFinished
-	return nil
+	hctx.CanDeliveryMessages = true
+	return hctx.DeliverReceivedMessages(conn)
 }
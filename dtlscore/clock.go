@@ -61,9 +61,7 @@ func (cl *Clock) Close() {
 func (cl *Clock) GoRun() {
 	t := time.NewTimer(time.Hour)
 	defer t.Stop()
-	if t.Stop() {
-		<-t.C
-	}
+	t.Stop() // since go 1.23, no stale values are received after Stop or Reset
 	for {
 		cl.mu.Lock()
 		var fireDur time.Duration
@@ -93,9 +91,7 @@ func (cl *Clock) GoRun() {
 		select {
 		case <-t.C:
 		case <-cl.cond:
-			if t.Stop() {
-				<-t.C
-			}
+			t.Stop()
 		}
 	}
 }
@@ -111,7 +107,7 @@ func (cl *Clock) SetTimer(timer *Timer, deadline time.Time) {
 	cl.mu.Lock()
 	defer cl.mu.Unlock()
 	fireTimeUnixNano := deadline.UnixNano()
-	if fireTimeUnixNano >= timer.fireTimeUnixNano {
+	if timer.fireTimeUnixNano != 0 && fireTimeUnixNano >= timer.fireTimeUnixNano {
 		// for applications which have watchdog timers per connection,
 		// which they reset/move forward on each packet.
 		// we will not touch heap, timer will fire, where user will have to
@@ -0,0 +1,78 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"sync"
+
+	"github.com/hrissan/dtls/circular"
+	"github.com/hrissan/dtls/transport/stats"
+)
+
+// Heavy handshake computations (ECDHE, signing and verifying certificate_verify) are done by
+// Options.ComputeGoroutines goroutines, so reading goroutine is never blocked for long.
+// Connections waiting for computations are in round-robin queue, each connection is in the queue
+// at most once, and has at most one pending computation (see handshake_compute.go).
+type ComputePool struct {
+	stats stats.Stats
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	shutdown bool
+
+	queue circular.Buffer[*Connection]
+}
+
+func NewComputePool(opts *Options) *ComputePool {
+	cp := &ComputePool{stats: opts.Stats}
+	cp.cond = sync.NewCond(&cp.mu)
+	if opts.Preallocate {
+		cp.queue.Reserve(opts.MaxHandshakes)
+	}
+	return cp
+}
+
+func (cp *ComputePool) Close() {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.shutdown = true
+	cp.queue.Clear() // connections will be closed by transport
+	cp.cond.Broadcast()
+}
+
+// blocks until Close() called, transport owner must run Options.ComputeGoroutines of them
+func (cp *ComputePool) GoRun() {
+	cp.mu.Lock()
+	for {
+		for !cp.shutdown && cp.queue.Len() == 0 {
+			cp.cond.Wait()
+		}
+		if cp.shutdown {
+			cp.mu.Unlock()
+			return
+		}
+		conn := cp.queue.PopFront()
+		conn.inComputeQueue = false
+		depth := cp.queue.Len()
+		cp.mu.Unlock()
+		cp.stats.ComputeQueueDepth(depth)
+		conn.onCompute()
+		cp.mu.Lock()
+	}
+}
+
+// called under connection lock, so order of locks is conn.Lock(), computePool.Lock()
+func (cp *ComputePool) addConnection(conn *Connection) {
+	cp.mu.Lock()
+	if conn.inComputeQueue || cp.shutdown {
+		cp.mu.Unlock()
+		return
+	}
+	conn.inComputeQueue = true
+	cp.queue.PushBack(conn)
+	depth := cp.queue.Len()
+	cp.cond.Signal()
+	cp.mu.Unlock()
+	cp.stats.ComputeQueueDepth(depth)
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"crypto/sha256"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/hrissan/dtls/dtlserrors"
+)
+
+func newComputeTestConnection() *Connection {
+	conn, _ := newEstablishedTestConnection(netip.MustParseAddrPort("127.0.0.1:1"))
+	conn.tr.opts.ComputeGoroutines = 1
+	conn.stateID = smIDHandshakeClientExpectCertVerify
+	conn.hctx = newHandshakeContext(sha256.New())
+	return conn
+}
+
+func TestCompute_Pool(t *testing.T) {
+	conn := newComputeTestConnection()
+	cp := conn.tr.ComputePool()
+	go cp.GoRun()
+	defer cp.Close()
+
+	conn.Lock()
+	conn.stateID = smIDHandshakeClientCalcCertVerify
+	err := conn.startComputationLocked(conn.tr.opts, computation{kind: computeClientCertVerify, certData: []byte{1, 2, 3}})
+	if err != nil || conn.hctx.CanDeliveryMessages {
+		t.Fatalf("computation must be offloaded, while received messages wait")
+	}
+	conn.Unlock()
+	for i := 0; ; i++ {
+		conn.Lock()
+		stateID, closeErr := conn.stateID, conn.closeErr
+		conn.Unlock()
+		if stateID == smIDShutdown {
+			if !errors.Is(closeErr, dtlserrors.ErrCertificateLoadError) {
+				t.Fatalf("connection must be closed with computation error, got %v", closeErr)
+			}
+			break
+		}
+		if i == 1000 {
+			t.Fatalf("computation result was not applied")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCompute_Inline(t *testing.T) {
+	conn := newComputeTestConnection()
+	opts := *conn.tr.opts
+	opts.ComputeGoroutines = 0
+
+	conn.stateID = smIDHandshakeClientCalcCertVerify
+	err := conn.startComputationLocked(&opts, computation{kind: computeClientCertVerify, certData: []byte{1, 2, 3}})
+	if err != dtlserrors.ErrCertificateLoadError || conn.hctx.computation.kind != computeNone {
+		t.Fatalf("reading goroutine must compute and return error, got %v", err)
+	}
+}
+
+func TestCompute_StaleResult(t *testing.T) {
+	conn := newComputeTestConnection()
+	conn.stateID = smIDHandshakeClientCalcCertVerify
+	_ = conn.startComputationLocked(conn.tr.opts, computation{kind: computeClientCertVerify, certData: []byte{1, 2, 3}})
+	conn.tr.ComputePool().addConnection(conn) // must not be added twice
+	if conn.tr.ComputePool().queue.Len() != 1 {
+		t.Fatalf("connection must be in compute queue once")
+	}
+	// handshake replaced while connection waits in the queue
+	conn.hctx = newHandshakeContext(sha256.New())
+	conn.stateID = smIDHandshakeClientExpectCertVerify
+	conn.onCompute()
+	if conn.stateID != smIDHandshakeClientExpectCertVerify {
+		t.Fatalf("result of stale computation must be ignored")
+	}
+}
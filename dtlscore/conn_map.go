@@ -0,0 +1,169 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"encoding/binary"
+	"hash/maphash"
+	"net/netip"
+	"sync"
+)
+
+// Every datagram looks up connection by address (and by CID for ciphertext with CID).
+// With single map under Transport.mu, several reading goroutines contend on that mutex,
+// so maps are split into shards by seeded hash (attacker cannot easily choose addresses of the same shard),
+// each shard with its own mutex. Shard mutexes are leaf locks, we never take other locks
+// (or second shard mutex) while holding one.
+const connMapShards = 64
+
+type connMapShard struct {
+	mu      sync.Mutex
+	connMap map[netip.AddrPort]*Connection
+	cidMap  map[string]*Connection // [rfc9146] only connections which have our CID
+	_       [64]byte               // mutexes of neighbour shards in different cache lines
+}
+
+func (t *Transport) initConnMaps(opts *Options) {
+	t.mapSeed = maphash.MakeSeed()
+	t.addrSeed = maphash.Bytes(t.mapSeed, nil) // random
+	for i := range t.mapShards {
+		s := &t.mapShards[i]
+		if !opts.Preallocate {
+			s.connMap = map[netip.AddrPort]*Connection{}
+			s.cidMap = map[string]*Connection{}
+			continue
+		}
+		// shards are not perfectly even, some will still grow a bit
+		perShard := opts.MaxConnections/connMapShards + 1
+		s.connMap = make(map[netip.AddrPort]*Connection, perShard)
+		if opts.UseConnectionID && opts.CIDLength != 0 {
+			s.cidMap = make(map[string]*Connection, perShard)
+		} else {
+			s.cidMap = map[string]*Connection{}
+		}
+	}
+}
+
+// cheaper than maphash, attacker who finds addresses of the same shard only gets single map under single mutex
+func (t *Transport) addrShard(addr netip.AddrPort) *connMapShard {
+	ip := addr.Addr().As16() // zone is ignored, addresses differing only by zone share shard
+	h := (binary.LittleEndian.Uint64(ip[:8]) ^ t.addrSeed) * 0x9E3779B97F4A7C15
+	h ^= (binary.LittleEndian.Uint64(ip[8:]) + uint64(addr.Port())) * 0xC2B2AE3D27D4EB4F // widening
+	// IPv4 is in high bits, mix them down (splitmix64 finalizer)
+	h ^= h >> 31
+	h *= 0xBF58476D1CE4E5B9
+	h ^= h >> 29
+	return &t.mapShards[h%connMapShards]
+}
+
+func (t *Transport) cidShard(cid []byte) *connMapShard {
+	return &t.mapShards[maphash.Bytes(t.mapSeed, cid)%connMapShards]
+}
+
+func (t *Transport) findConnection(addr netip.AddrPort) *Connection {
+	s := t.addrShard(addr)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connMap[addr]
+}
+
+func (t *Transport) findConnectionByCID(cid []byte) *Connection {
+	s := t.cidShard(cid)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cidMap[string(cid)] // no allocation for lookup
+}
+
+// call under connection's mutex to maintain state invariant that
+// closed connections are not in the map, while !closed are in the map
+func (t *Transport) addToMap(conn *Connection, addr netip.AddrPort) {
+	s := t.addrShard(addr)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.connMap[addr]; ok {
+		panic("connection magically appeared in the map")
+	}
+	s.connMap[addr] = conn
+}
+
+// call under connection's mutex to maintain state invariant that
+// closed connections are not in the map, while !closed are in the map
+func (t *Transport) removeFromMap(conn *Connection, addr netip.AddrPort, returnToPool bool) {
+	t.deleteFromMap(conn, addr)
+	if !returnToPool {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.opts.RoleServer { // For now, reuse connections on server only
+		t.connPool.PushBack(conn)
+	} else {
+		t.createdConnections--
+	}
+}
+
+func (t *Transport) deleteFromMap(conn *Connection, addr netip.AddrPort) {
+	s := t.addrShard(addr)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c2, ok := s.connMap[addr]
+	if !ok || c2 != conn {
+		panic("connection magically replaced in the map")
+	}
+	delete(s.connMap, addr)
+}
+
+// call under connection's mutex to maintain state invariant that
+// !closed connections are in the map with their current address
+func (t *Transport) moveInMap(conn *Connection, oldAddr netip.AddrPort, newAddr netip.AddrPort) bool {
+	s := t.addrShard(newAddr)
+	s.mu.Lock()
+	if _, ok := s.connMap[newAddr]; ok {
+		s.mu.Unlock()
+		return false // other connection (or handshake) from the same address
+	}
+	s.connMap[newAddr] = conn
+	s.mu.Unlock()
+	// for a moment connection is found by both addresses, this is ok, because
+	// lookup result can be stale anyway, it is used after shard mutex is released
+	t.deleteFromMap(conn, oldAddr)
+	return true
+}
+
+// call under connection's mutex, returns false if cid is used by other connection
+func (t *Transport) addToCIDMap(conn *Connection, cid []byte) bool {
+	s := t.cidShard(cid)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.cidMap[string(cid)]; ok {
+		return false
+	}
+	s.cidMap[string(cid)] = conn
+	return true
+}
+
+// call under connection's mutex
+func (t *Transport) removeFromCIDMap(conn *Connection, cid []byte) {
+	s := t.cidShard(cid)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c2, ok := s.cidMap[string(cid)]
+	if !ok || c2 != conn {
+		panic("connection magically replaced in the CID map")
+	}
+	delete(s.cidMap, string(cid))
+}
+
+// snapshot, connections can be added or removed right after shard is visited
+func (t *Transport) appendConnections(conns []*Connection) []*Connection {
+	for i := range t.mapShards {
+		s := &t.mapShards[i]
+		s.mu.Lock()
+		for _, conn := range s.connMap {
+			conns = append(conns, conn)
+		}
+		s.mu.Unlock()
+	}
+	return conns
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"fmt"
+	"net/netip"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hrissan/dtls/dtlsrand"
+	"github.com/hrissan/dtls/transport/stats"
+)
+
+func newConnMapTestTransport() *Transport {
+	opts := DefaultTransportOptions(true, dtlsrand.CryptoRand(), stats.NewStatsLogVerbose())
+	opts.UseConnectionID = true
+	opts.CIDLength = 4
+	opts.Preallocate = false
+	return NewTransport(opts, &statelessSender{}, nil)
+}
+
+func connMapTestAddr(i int) netip.AddrPort {
+	return netip.AddrPortFrom(netip.AddrFrom4([4]byte{10, byte(i >> 16), byte(i >> 8), byte(i)}), uint16(1000+i%1000)) // truncation
+}
+
+func TestConnMap(t *testing.T) {
+	tr := newConnMapTestTransport()
+	conns := make([]*Connection, 1000)
+	for i := range conns {
+		conns[i] = &Connection{}
+		tr.addToMap(conns[i], connMapTestAddr(i))
+	}
+	for i, conn := range conns {
+		if tr.findConnection(connMapTestAddr(i)) != conn {
+			t.Fatalf("connection %d not found by address", i)
+		}
+	}
+	if n := len(tr.appendConnections(nil)); n != len(conns) {
+		t.Fatalf("must have %d connections, got %d", len(conns), n)
+	}
+	for i := range tr.mapShards {
+		if len(tr.mapShards[i].connMap) == 0 {
+			t.Fatalf("shard %d is empty, addresses are not distributed evenly", i)
+		}
+	}
+	newAddr := connMapTestAddr(len(conns))
+	if tr.moveInMap(conns[0], connMapTestAddr(0), connMapTestAddr(1)) {
+		t.Fatalf("must not move to address of other connection")
+	}
+	if !tr.moveInMap(conns[0], connMapTestAddr(0), newAddr) ||
+		tr.findConnection(newAddr) != conns[0] || tr.findConnection(connMapTestAddr(0)) != nil {
+		t.Fatalf("connection must be moved to new address")
+	}
+	cid := []byte{1, 2, 3, 4}
+	if !tr.addToCIDMap(conns[1], cid) || tr.addToCIDMap(conns[2], cid) {
+		t.Fatalf("CID must belong to single connection")
+	}
+	if tr.findConnectionByCID(cid) != conns[1] {
+		t.Fatalf("connection not found by CID")
+	}
+	tr.removeFromCIDMap(conns[1], cid)
+	tr.removeFromMap(conns[1], connMapTestAddr(1), true)
+	if tr.findConnectionByCID(cid) != nil || tr.findConnection(connMapTestAddr(1)) != nil || tr.connPool.Len() != 1 {
+		t.Fatalf("removed connection must be in the pool only")
+	}
+}
+
+// what we had before sharding, for comparison
+type singleMutexMap struct {
+	mu      sync.Mutex
+	connMap map[netip.AddrPort]*Connection
+}
+
+func (m *singleMutexMap) findConnection(addr netip.AddrPort) *Connection {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.connMap[addr]
+}
+
+const connMapBenchConnections = 100_000
+
+// run with -cpu=1,4,16 to see contention, parallelism multiplies GOMAXPROCS
+func benchmarkConnMapLookup(b *testing.B, find func(addr netip.AddrPort) *Connection) {
+	runtime.GC() // setup garbage must not be scanned during benchmark
+	b.ResetTimer()
+	var seed atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		i := int(seed.Add(7919)) // truncation, readers start at different connections
+		for pb.Next() {
+			if find(connMapTestAddr(i%connMapBenchConnections)) == nil {
+				panic("connection not found")
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkConnMap_Lookup(b *testing.B) {
+	tr := newConnMapTestTransport()
+	single := &singleMutexMap{connMap: map[netip.AddrPort]*Connection{}}
+	for i := 0; i < connMapBenchConnections; i++ {
+		conn := &Connection{}
+		tr.addToMap(conn, connMapTestAddr(i))
+		single.connMap[connMapTestAddr(i)] = conn
+	}
+	for _, parallelism := range []int{1, 4} {
+		b.Run(fmt.Sprintf("mutex/parallelism=%d", parallelism), func(b *testing.B) {
+			b.SetParallelism(parallelism)
+			benchmarkConnMapLookup(b, single.findConnection)
+		})
+		b.Run(fmt.Sprintf("sharded/parallelism=%d", parallelism), func(b *testing.B) {
+			b.SetParallelism(parallelism)
+			benchmarkConnMapLookup(b, tr.findConnection)
+		})
+	}
+}
+
+// lookups while connections are constantly added and removed, as during handshake flood
+func BenchmarkConnMap_LookupWithChurn(b *testing.B) {
+	tr := newConnMapTestTransport()
+	for i := 0; i < connMapBenchConnections; i++ {
+		tr.addToMap(&Connection{}, connMapTestAddr(i))
+	}
+	var seed atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		i := int(seed.Add(1)) // truncation
+		conn := &Connection{}
+		addr := connMapTestAddr(connMapBenchConnections + i) // each goroutine has own address
+		for pb.Next() {
+			if i%16 == 0 {
+				tr.addToMap(conn, addr)
+				tr.deleteFromMap(conn, addr)
+			}
+			_ = tr.findConnection(connMapTestAddr(i % connMapBenchConnections))
+			i++
+		}
+	})
+}
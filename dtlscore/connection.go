@@ -9,7 +9,9 @@ import (
 	"net/netip"
 	"strconv"
 	"sync"
+	"sync/atomic"
 
+	"github.com/hrissan/dtls/constants"
 	"github.com/hrissan/dtls/dtlserrors"
 	"github.com/hrissan/dtls/keys"
 	"github.com/hrissan/dtls/record"
@@ -27,6 +29,10 @@ type Connection struct {
 	// variables below mu are protected by mu, except where noted
 	mu   sync.Mutex
 	addr netip.AddrPort // cleared when conn is removed from map, set when added
+	// our address peer sends datagrams to, we send from it, otherwise on multi-homed host replies from socket
+	// bound to wildcard address can come from another address, and peer drops them. Invalid if unknown.
+	localAddr netip.Addr
+
 	keys keys.Keys
 
 	// connection with newer cookie replaces previous one
@@ -39,7 +45,8 @@ type Connection struct {
 	sentKeyUpdateRN        record.Number // if != 0, already sent, on resend overwrite rn
 	sentNewSessionTicketRN record.Number // if != 0, already sent, on resend overwrite rn
 
-	hctx *handshakeContext // handshakeContext content is also protected by mutex above
+	hctx *handshakeContext  // handshakeContext content is also protected by mutex above
+	pha  *postHandshakeAuth // only if post_handshake_auth negotiated, also protected by mutex above
 
 	// Messages are protocol above records, these counters do not reset for connection lifetime.
 	// If any reaches 2^16, connection will be closed by both peers.
@@ -50,11 +57,52 @@ type Connection struct {
 	sendKeyUpdateMessageSeq        uint16 // != 0 if set
 	sendKeyUpdateUpdateRequested   bool   // fully defines content of KeyUpdate we are sending
 
-	sendAlert record.Alert // if Level == 0, do not need to send an alert
+	// [rfc8449] record_size_limit sent by peer, 0 if not negotiated.
+	// Limits our protected records, and if set, we enforce our own limit on received records.
+	sendRecordSizeLimit uint16
+
+	// [rfc9146] see connection_id.go
+	receiveCID     [constants.MaxConnectionIDLength]byte // Options.CIDLength bytes, registered in transport if set
+	sendCID        [constants.MaxConnectionIDLength]byte
+	sendCIDLength  uint8
+	receiveCIDSet  bool
+	rrcNegotiated  bool            // [draft-ietf-tls-dtls-rrc] we validate peer address changes
+	pathValidation *pathValidation // only while address validation is in progress, see path_validation.go
+	pmtu           pmtuDiscovery   // [rfc8899] see pmtu.go
 
-	stateID stateMachineStateID // index in global table
+	sendAlert record.Alert // if Level == 0, do not need to send an alert
+	closeErr  error        // set once during transition to shutdown, passed to OnDisconnectLocked
+
+	sentDatagramTail uint64 // to check stateless reset from peer, see stateless_reset.go
+
+	// usage of current send keys for KeyUpdate policy, see key_update.go
+	sendKeysStartUnixNano int64
+	sendKeysBytes         uint64
+
+	peerAckedRN record.Number // highest record peer acked, for HeaderProfileCompact
+
+	// single timer for all deadlines, see timeouts.go
+	timer                      Timer
+	lastReceiveUnixNano        int64 // last authenticated record from peer, for Options.IdleTimeout
+	retransmitDeadlineUnixNano int64 // [rfc9147:5.8] 0 if nothing to retransmit
+	ackDeadlineUnixNano        int64 // [rfc9147:7.1] 0 if no delayed acks
+	recordsToAck               int32 // since last ack sent, reported with it to Stats.AckSent
+	immediateRecordsToAck      int32 // part of recordsToAck which required immediate ack
+	rtt                        rttEstimator
+	retransmits                uint8 // in a row without ack, for Options.MaxRetransmissions
+	icmpErrorUnixNano          int64 // last counted ICMP error, see icmp.go
+
+	stateID       stateMachineStateID // index in global table
+	shard         uint8               // index of socket (and sender) connection sticks to
+	sendKeepalive bool                // see keepalive.go
+	sendAckNow    bool                // see ack_scheduler.go
+	icmpErrors    uint8               // since last authenticated record, see icmp.go
 	// intrusive, must not be changed except by sender, protected by sender mutex
 	inSenderQueue bool
+	// hctx != nil, sender reads it without connection's mutex to choose scheduling class
+	inHandshake atomic.Bool
+	// intrusive, must not be changed except by compute pool, protected by compute pool mutex
+	inComputeQueue bool
 }
 
 func (conn *Connection) Lock()   { conn.mu.Lock() }
@@ -80,20 +128,47 @@ func (conn *Connection) SenderAddToQueue() bool {
 	return true
 }
 
-func (conn *Connection) SenderConstructDatagram(datagram []byte) (addr netip.AddrPort, datagramSize int, addToSendQueue bool) {
+// sender interface, connections in handshake are scheduled separately from established ones
+func (conn *Connection) SenderInHandshake() bool {
+	return conn.inHandshake.Load()
+}
+
+func (conn *Connection) SenderConstructDatagram(datagram []byte) (addr netip.AddrPort, localAddr netip.Addr, datagramSize int, addToSendQueue bool) {
 	return conn.constructDatagram(conn.tr.opts, datagram)
 }
 
 // if we want some logic once during transition to shutdown, use returned value
 func (conn *Connection) ShutdownLocked(alert record.Alert) (switchedToShutdown bool) {
+	return conn.shutdownLocked(alert, &dtlserrors.AlertError{Alert: alert})
+}
+
+// closes connection due to local error, sending alert corresponding to it
+func (conn *Connection) failLocked(err error) (switchedToShutdown bool) {
+	alert := dtlserrors.AlertFromError(err)
+	return conn.shutdownLocked(alert, &dtlserrors.AlertError{Alert: alert, Err: err})
+}
+
+func (conn *Connection) fail(err error) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	_ = conn.failLocked(err)
+}
+
+// alert is sent if Level != 0, closeErr is passed to OnDisconnectLocked
+func (conn *Connection) shutdownLocked(alert record.Alert, closeErr error) (switchedToShutdown bool) {
 	if conn.stateID == smIDClosed || conn.stateID == smIDShutdown {
 		return false
 	}
 	conn.sendAlert = alert
+	conn.closeErr = closeErr
 	conn.stateID = smIDShutdown
 
-	// cancel handshake
-	conn.hctx = nil // TODO - reuse
+	// cancel handshake, but keep epoch 2 keys to protect alert
+	if conn.hctx != nil {
+		conn.hctx.sendQueue.Clear()
+	}
+	conn.pha = nil
+	conn.pathValidation = nil
 
 	// cancel post-handshake messages
 	conn.sendNewSessionTicketMessageSeq = 0
@@ -121,6 +196,7 @@ func (conn *Connection) resetToClosedLocked(returnToPool bool) {
 
 	conn.tr.removeFromMap(conn, conn.addr, returnToPool)
 	conn.addr = netip.AddrPort{}
+	conn.localAddr = netip.Addr{}
 
 	conn.keys = keys.Keys{}
 	conn.cookieTimestampUnixNano = 0
@@ -128,7 +204,8 @@ func (conn *Connection) resetToClosedLocked(returnToPool bool) {
 	conn.sentKeyUpdateRN = record.Number{}
 	conn.sentNewSessionTicketRN = record.Number{}
 
-	conn.hctx = nil // TODO - reuse
+	conn.releaseHandshakeLocked()
+	conn.pha = nil
 
 	conn.nextMessageSeqSend = 0
 	conn.nextMessageSeqReceive = 0
@@ -137,11 +214,38 @@ func (conn *Connection) resetToClosedLocked(returnToPool bool) {
 	conn.sendKeyUpdateMessageSeq = 0
 	conn.sendKeyUpdateUpdateRequested = false
 
+	conn.sendRecordSizeLimit = 0
+
+	conn.removeReceiveCIDLocked()
+	conn.sendCIDLength = 0
+	conn.rrcNegotiated = false
+	conn.pathValidation = nil
+	conn.pmtu = pmtuDiscovery{}
+
 	conn.sendAlert = record.Alert{}
+	conn.sentDatagramTail = 0
+	conn.sendKeysStartUnixNano = 0
+	conn.sendKeysBytes = 0
+	conn.sendKeepalive = false
+	conn.peerAckedRN = record.Number{}
+
+	conn.tr.clock.StopTimer(&conn.timer)
+	conn.lastReceiveUnixNano = 0
+	conn.retransmitDeadlineUnixNano = 0
+	conn.ackDeadlineUnixNano = 0
+	conn.recordsToAck = 0
+	conn.immediateRecordsToAck = 0
+	conn.sendAckNow = false
+	conn.rtt = rttEstimator{}
+	conn.retransmits = 0
+	conn.icmpErrorUnixNano = 0
+	conn.icmpErrors = 0
+	closeErr := conn.closeErr
+	conn.closeErr = nil
 
 	// for now, call exactly once for each !closed -> closed change
 	// TODO - call only if we called OnConnectLocked
-	conn.handler.OnDisconnectLocked(nil)
+	conn.handler.OnDisconnectLocked(closeErr)
 }
 
 func (conn *Connection) startConnection(tr *Transport, handler ConnectionHandler, addr netip.AddrPort) error {
@@ -150,26 +254,39 @@ func (conn *Connection) startConnection(tr *Transport, handler ConnectionHandler
 	if conn.stateID != smIDClosed {
 		return ErrConnectionInProgress
 	}
+	if !tr.reserveHandshakeSlot() {
+		return dtlserrors.WarnHandshakeLimit
+	}
+	conn.shard = tr.nextShardForClient()
 	hctx := newHandshakeContext(nil) // TODO - take from pool
 	tr.opts.Rnd.ReadMust(hctx.localRandom[:])
 	// We'd like to postpone ECC until HRR, but wolfssl requires key_share in the first client_hello
 	// TODO - offload to separate goroutine
 	// TODO - contact wolfssl team?
-	hctx.ComputeKeyShare(tr.opts.Rnd)
+	hctx.x25519Secret = tr.keyShares.take()
 
 	conn.tr = tr
 	conn.handler = handler
+	if tr.opts.UseConnectionID {
+		if err := conn.assignReceiveCIDLocked(tr.opts); err != nil {
+			tr.cancelHandshakeSlot()
+			return err
+		}
+	}
 
 	conn.stateID = smIDHandshakeClientExpectServerHRR
 	conn.addr = addr
 	conn.tr.addToMap(conn, addr)
 
 	conn.hctx = hctx
+	conn.inHandshake.Store(true)
+	conn.startHandshakeTimerLocked(tr.opts)
+	tr.addHandshake(conn, hctx)
 
 	clientHelloMsg := hctx.generateClientHello(conn, true, tr.opts, false, nil)
 
 	if err := hctx.PushMessageNoHasher(conn, clientHelloMsg); err != nil {
-		conn.hctx = nil // TODO - reuse
+		conn.releaseHandshakeLocked()
 		return err
 	}
 	return nil
@@ -202,16 +319,6 @@ func (conn *Connection) keyUpdateInProgress() bool {
 	return conn.sendKeyUpdateMessageSeq != 0
 }
 
-// TODO - remove after testing
-func (conn *Connection) DebugKeyUpdateLocked(updateRequested bool) {
-	if err := conn.keyUpdateStart(updateRequested); err != nil {
-		fmt.Printf("dtls: DebugKeyUpdateLocked returned error: %v\n", err)
-		return
-	}
-	fmt.Printf("dtls: DebugKeyUpdateLocked updateRequested: %v\n", updateRequested)
-	conn.SignalWriteable()
-}
-
 func (conn *Connection) keyUpdateStart(updateRequested bool) error {
 	if conn.keyUpdateInProgress() {
 		return nil
@@ -1,5 +1,10 @@
 package dtlscore
 
+import (
+	"crypto/x509"
+	"net/netip"
+)
+
 // Motivation for event-based interface is we have a single datagram reading goroutine,
 // and so for short requests we can call user handler on the same buffer we used for reading
 // and decrypting, and user code often can parse the same bytes and make some state machine
@@ -31,6 +36,8 @@ type ConnectionHandler interface {
 
 	// application must remove connection from all data structures.
 	// connection will be reused immediately after method returns
+	// err is *dtlserrors.AlertError if alert was sent or received (close_notify for normal close),
+	// *dtlserrors.Error if connection was closed without alert, or error from StartConnection.
 	OnDisconnectLocked(err error)
 
 	// if connection was register for send with transport, this method will be called
@@ -43,17 +50,39 @@ type ConnectionHandler interface {
 	// to send short record (application may prefer to send longer record on the next call).
 	OnWriteRecordLocked(earlyData bool, recordBody []byte) (recordSize int, send bool, signalWriteable bool, err error)
 
-	// every record sent will be delivered as is. Sent empty records are delivered as empty records.
+	// every record sent will be delivered as is. Sent empty records are not delivered,
+	// some implementations use them as keepalive.
 	// record points to buffer inside transport and must not be retained.
 	// bytes are guaranteed to be valid only during the call.
 	// if application returns error, connection close will be initiated, expect OnDisconnect in the near future.
 	OnReadRecordLocked(earlyData bool, recordBody []byte) error
+
+	// Called on server with the result of post-handshake authentication requested by
+	// Connection.RequestClientAuthenticationLocked. If err != nil, client failed to prove
+	// it owns the certificate. If client declined, err is nil and info.Certificates is empty.
+	OnClientAuthenticationLocked(info ClientAuthenticationInfo, err error)
+
+	// Called when peer moved to the new address (for example, NAT rebinding) and proved
+	// it is reachable there. Only possible if connection ID and rrc extensions were negotiated.
+	OnAddressChangedLocked(oldAddr netip.AddrPort, newAddr netip.AddrPort)
+
+	// [rfc8899] Called when path MTU discovery confirmed larger datagrams reach peer, or when
+	// path MTU is reset to Options.PMTUMin after address change. Records passed to OnWriteRecordLocked
+	// are sized by path MTU, so application can use it to decide how much to put in each record.
+	OnPathMTUChangedLocked(pathMTU int)
 }
 
 type HandshakeInfo struct {
 	ALPNSelected []byte
 }
 
+type ClientAuthenticationInfo struct {
+	// certificate chain is not verified, this is the task for application,
+	// we only check client owns private key for the leaf.
+	Certificates [][]byte // DER-encoded, leaf first
+	Leaf         *x509.Certificate
+}
+
 type TransportHandler interface {
 	OnNewConnection() (*Connection, ConnectionHandler)
 }
@@ -0,0 +1,76 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"github.com/hrissan/dtls/constants"
+	"github.com/hrissan/dtls/dtlserrors"
+	"github.com/hrissan/dtls/record"
+)
+
+// [rfc9146] [rfc9147:9] Each side tells peer which CID it wants to receive in connection_id
+// extension of ClientHello and ServerHello. Ciphertext records with CID are routed by CID,
+// other records by address. Our CIDs have fixed length (Options.CIDLength).
+// Peer address changes are validated before we follow them, see path_validation.go
+
+// generator can produce the same CID again, for example if it encodes little randomness
+const maxCIDGenerateAttempts = 8
+
+func (conn *Connection) receiveCIDLocked() []byte {
+	if !conn.receiveCIDSet {
+		return nil
+	}
+	return conn.receiveCID[:conn.tr.opts.CIDLength]
+}
+
+// does nothing if we do not need peer to send us CID
+func (conn *Connection) assignReceiveCIDLocked(opts *Options) error {
+	if opts.CIDLength == 0 || conn.receiveCIDSet {
+		return nil
+	}
+	cid := conn.receiveCID[:opts.CIDLength]
+	for i := 0; i != maxCIDGenerateAttempts; i++ {
+		if opts.CIDGenerator != nil {
+			opts.CIDGenerator(cid)
+		} else {
+			opts.Rnd.ReadMust(cid)
+		}
+		if opts.CIDSteering {
+			cid[0] = conn.shard
+		}
+		if conn.tr.addToCIDMap(conn, cid) {
+			conn.receiveCIDSet = true
+			return nil
+		}
+	}
+	return dtlserrors.ErrConnectionIDCollision
+}
+
+func (conn *Connection) removeReceiveCIDLocked() {
+	if !conn.receiveCIDSet {
+		return
+	}
+	conn.tr.removeFromCIDMap(conn, conn.receiveCIDLocked())
+	conn.receiveCIDSet = false
+	conn.receiveCID = [constants.MaxConnectionIDLength]byte{}
+}
+
+func (conn *Connection) setSendCIDLocked(cid []byte) error {
+	if len(cid) > len(conn.sendCID) {
+		return dtlserrors.ErrConnectionIDTooLong
+	}
+	conn.sendCIDLength = uint8(copy(conn.sendCID[:], cid)) // truncation, checked above
+	return nil
+}
+
+// [rfc9146:6] peer address is updated only by record newer than any record received before.
+func (conn *Connection) isNewestReceivedLocked(rn record.Number) bool {
+	if rn.Epoch() != conn.keys.ReceiveEpoch {
+		return false
+	}
+	if conn.keys.NewReceiveKeysSet {
+		return rn.SeqNum()+1 == conn.keys.NewReceiveNextSeq.GetNextReceivedSeq()
+	}
+	return rn.SeqNum()+1 == conn.keys.ReceiveNextSeq.GetNextReceivedSeq()
+}
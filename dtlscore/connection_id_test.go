@@ -0,0 +1,76 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/hrissan/dtls/ciphersuite"
+	"github.com/hrissan/dtls/dtlserrors"
+	"github.com/hrissan/dtls/dtlsrand"
+	"github.com/hrissan/dtls/record"
+	"github.com/hrissan/dtls/transport/stats"
+)
+
+func TestConnectionID_AssignAndRoute(t *testing.T) {
+	opts := DefaultTransportOptions(false, dtlsrand.CryptoRand(), stats.NewStatsLogVerbose())
+	opts.UseConnectionID = true
+	opts.CIDLength = 4
+	opts.CIDGenerator = func(cid []byte) { copy(cid, "\x01\x02\x03\x04") }
+	tr := NewTransport(opts, &statelessSender{}, nil)
+
+	var conns [2]Connection
+	var handlers [2]disconnectHandler
+	for i := range conns {
+		handlers[i].disconnected = make(chan error, 1)
+	}
+	if err := tr.StartConnection(&conns[0], &handlers[0], netip.MustParseAddrPort("127.0.0.1:1")); err != nil {
+		t.Fatalf("failed to start connection: %v", err)
+	}
+	if err := tr.StartConnection(&conns[1], &handlers[1], netip.MustParseAddrPort("127.0.0.1:2")); err != dtlserrors.ErrConnectionIDCollision {
+		t.Fatalf("generator collision must be detected, got %v", err)
+	}
+	if tr.findConnectionByCID([]byte{1, 2, 3, 4}) != &conns[0] {
+		t.Fatalf("connection not found by CID")
+	}
+	conns[0].mu.Lock()
+	conns[0].resetToClosedLocked(false)
+	conns[0].mu.Unlock()
+	if tr.findConnectionByCID([]byte{1, 2, 3, 4}) != nil {
+		t.Fatalf("closed connection must be removed from CID map")
+	}
+}
+
+func TestConnectionID_ProtectRecordWithCID(t *testing.T) {
+	opts := DefaultTransportOptions(false, dtlsrand.CryptoRand(), nil)
+	conn := &Connection{tr: NewTransport(opts, &statelessSender{}, nil)}
+	conn.keys.SuiteID = ciphersuite.TLS_AES_128_GCM_SHA256
+	var secret ciphersuite.Hash
+	secret.SetZero(32)
+	conn.keys.SendSymmetric = conn.keys.Suite().ResetSymmetricKeys(nil, secret, false)
+	conn.keys.SendEpoch = 3
+	if err := conn.setSendCIDLocked([]byte{7, 7, 7}); err != nil {
+		t.Fatalf("failed to set CID: %v", err)
+	}
+	var datagram [256]byte
+	hdrSize := conn.recordHeaderSize(opts, conn.keys.SendEpoch, conn.keys.SendNextSeq, false)
+	insideBody, ok := conn.prepareProtect(conn.keys.SendSymmetric, datagram[:], hdrSize, 0)
+	if !ok || hdrSize != record.OutgoingCiphertextRecordHeader16+3 {
+		t.Fatalf("wrong header size %d", hdrSize)
+	}
+	recordSize, _, err := conn.protectRecord(conn.keys.SendSymmetric, conn.keys.SendEpoch, &conn.keys.SendNextSeq,
+		record.RecordTypeApplicationData, datagram[:], 0, hdrSize, copy(insideBody, "hello"))
+	if err != nil {
+		t.Fatalf("failed to protect: %v", err)
+	}
+	var hdr record.Encrypted
+	n, err := hdr.Parse(datagram[:recordSize], 3)
+	if err != nil || n != recordSize || !hdr.HasCID() || string(hdr.CID) != "\x07\x07\x07" {
+		t.Fatalf("failed to parse record with CID: %v", err)
+	}
+	if err := conn.setSendCIDLocked(make([]byte, 21)); err != dtlserrors.ErrConnectionIDTooLong {
+		t.Fatalf("long CID must be rejected, got %v", err)
+	}
+}
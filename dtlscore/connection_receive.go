@@ -6,6 +6,8 @@ package dtlscore
 import (
 	"fmt"
 	"math"
+	"net/netip"
+	"time"
 
 	"github.com/hrissan/dtls/dtlserrors"
 	"github.com/hrissan/dtls/handshake"
@@ -14,7 +16,7 @@ import (
 	"github.com/hrissan/dtls/replay"
 )
 
-func (conn *Connection) receivedCiphertextRecord(opts *Options, hdr record.Encrypted) error {
+func (conn *Connection) receivedCiphertextRecord(opts *Options, hdr record.Encrypted, addr netip.AddrPort, localAddr netip.Addr) error {
 	conn.mu.Lock()
 	defer conn.mu.Unlock()
 	if err := conn.checkReceiveLimits(); err != nil {
@@ -25,11 +27,24 @@ func (conn *Connection) receivedCiphertextRecord(opts *Options, hdr record.Encry
 		// either garbage, attack or epoch wrapping
 		return err
 	}
+	if err := conn.checkReceivedRecordSize(opts, hdr, rn); err != nil {
+		return err // fatal, alert is sent by caller
+	}
+	if hdr.HasCID() {
+		conn.migrateLocked(opts, addr, localAddr, rn, len(hdr.Header)+len(hdr.Ciphertext))
+	}
+	if addr == conn.addr && localAddr.IsValid() { // peer can send to another of our addresses, we follow
+		conn.localAddr = localAddr
+	}
+	if opts.IdleTimeout > 0 || opts.KeepaliveInterval > 0 { // we do not believe plaintext records, they do not prolong connection
+		conn.lastReceiveUnixNano = time.Now().UnixNano()
+	}
+	conn.icmpErrors = 0 // peer is alive
 	fmt.Printf("dtls: ciphertext deprotected with rn={%d,%d} cid(hex): %x from %v, body(hex): %x\n", rn.Epoch(), rn.SeqNum(), hdr.CID, conn.addr, recordBody)
 	// [rfc9147:4.1]
 	switch contentType { // TODO - call StateMachine here
 	case record.RecordTypeAlert:
-		return conn.receivedAlertLocked(true, recordBody)
+		return conn.receivedAlertLocked(recordBody)
 	case record.RecordTypeAck:
 		// does not depend on conn.state()
 		return conn.receivedEncryptedAckLocked(opts, recordBody, rn)
@@ -38,26 +53,35 @@ func (conn *Connection) receivedCiphertextRecord(opts *Options, hdr record.Encry
 		return conn.receivedApplicationDataLocked(recordBody, rn)
 	case record.RecordTypeHandshake:
 		return conn.receivedEncryptedHandshakeRecordLocked(opts, recordBody, rn)
+	case record.RecordTypeReturnRoutabilityCheck:
+		return conn.receivedRRCLocked(opts, recordBody, addr, localAddr)
 	}
 	return dtlserrors.ErrUnknownInnerPlaintextRecordType
 }
 
-func (conn *Connection) receivedAlertLocked(encrypted bool, recordBody []byte) error {
+func (conn *Connection) receivedAlertLocked(recordBody []byte) error {
 	// record with an Alert type MUST contain exactly one message. [rfc8446:5.1]
 	var alert record.Alert
 	if err := alert.Parse(recordBody); err != nil {
 		return err
 	}
-	if encrypted && alert.IsFatal() {
-		_ = conn.ShutdownLocked(alert)
+	fmt.Printf("dtls: got alert record (encrypted) %v from %v\n", alert, conn.addr)
+	closeErr := &dtlserrors.AlertError{Alert: alert, Remote: true}
+	switch {
+	case alert.IsError(): // [rfc8446:6.2] we must not send anything after error alert
+		_ = conn.shutdownLocked(record.Alert{}, closeErr)
+	case alert.Description == record.AlertCloseNotify: // [rfc8446:6.1] respond with our own close_notify
+		_ = conn.shutdownLocked(record.AlertCloseNormal(), closeErr)
 	}
-	// TODO - beware of unencrypted alert!
-	fmt.Printf("dtls: got alert record (encrypted=%v) fatal=%v description=%d from %v\n", encrypted, alert.IsFatal(), alert.Description, conn.addr)
+	// user_canceled is followed by close_notify, so we ignore it
 	return nil
 }
 
 func (conn *Connection) receivedApplicationDataLocked(recordBody []byte, rn record.Number) error {
 	fmt.Printf("dtls: got application data record (encrypted) %d bytes from %v, message: %q\n", len(recordBody), conn.addr, recordBody)
+	if len(recordBody) == 0 { // some implementations send empty records as keepalive
+		return nil
+	}
 	return conn.handler.OnReadRecordLocked(rn.Epoch() == 1, recordBody)
 }
 
@@ -96,31 +120,16 @@ func (conn *Connection) receivedEncryptedHandshakeRecordLocked(opts *Options, re
 	return nil
 }
 
-func (conn *Connection) receivedNewSessionTicket(opts *Options, fragment handshake.Fragment, rn record.Number) error {
-	if conn.nextMessageSeqReceive == math.MaxUint16 {
-		return dtlserrors.ErrReceivedMessageSeqOverflow
-	}
-	conn.keys.AddAck(rn)
-	conn.nextMessageSeqReceive++                          // never due to check above
+func (conn *Connection) receivedNewSessionTicket(opts *Options, msg handshake.Message) error {
 	fmt.Printf("received and ignored NewSessionTicket\n") // TODO
 	return nil
 }
 
-func (conn *Connection) receivedKeyUpdate(opts *Options, fragment handshake.Fragment, rn record.Number) error {
+func (conn *Connection) receivedKeyUpdate(opts *Options, msg handshake.Message) error {
 	var msgKeyUpdate handshake.MsgKeyUpdate
-	if err := msgKeyUpdate.Parse(fragment.Body); err != nil {
+	if err := msgKeyUpdate.Parse(msg.Body); err != nil {
 		return dtlserrors.ErrKeyUpdateMessageParsing
 	}
-	fmt.Printf("KeyUpdate parsed: %+v\n", msgKeyUpdate)
-	if conn.hctx != nil {
-		opts.Stats.Warning(conn.addr, dtlserrors.ErrPostHandshakeMessageDuringHandshake)
-		return nil
-	}
-	if conn.nextMessageSeqReceive == math.MaxUint16 {
-		return dtlserrors.ErrReceivedMessageSeqOverflow
-	}
-	conn.keys.AddAck(rn)
-	conn.nextMessageSeqReceive++ // never due to check above
 	fmt.Printf("received KeyUpdate (%+v), expecting to receive record with the next epoch\n", msgKeyUpdate)
 	conn.removeOldReceiveKeys()
 	if err := conn.generateNewReceiveKeys(); err != nil {
@@ -159,7 +168,10 @@ func (conn *Connection) generateNewReceiveKeys() error {
 	}
 	conn.keys.NewReceiveKeysSet = true
 	conn.keys.ReceiveEpoch++
-	conn.keys.NewReceiveSymmetric = conn.keys.Suite().ResetSymmetricKeys(conn.keys.NewReceiveSymmetric, conn.keys.ReceiveApplicationTrafficSecret)
+	conn.keys.NewReceiveSymmetric = conn.keys.Suite().ResetSymmetricKeys(conn.keys.NewReceiveSymmetric, conn.keys.ReceiveApplicationTrafficSecret, conn.keys.DoNotEncryptSequenceNumbers)
+	if conn.pha != nil {
+		conn.pha.receiveTrafficSecret = conn.keys.ReceiveApplicationTrafficSecret
+	}
 	conn.keys.ReceiveApplicationTrafficSecret = keys.ComputeNextApplicationTrafficSecret(conn.keys.Suite(), "receive", conn.keys.ReceiveApplicationTrafficSecret)
 	conn.debugPrintKeys()
 	return nil
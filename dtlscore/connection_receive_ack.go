@@ -27,15 +27,28 @@ func (conn *Connection) receivedEncryptedAckLocked(opts *Options, recordData []b
 		if rn.Epoch() < beingAckedRn.Epoch() && beingAckedRn.Epoch() < 3 { // ack record cannot ack future epochs
 			continue
 		}
+		conn.rtt.recordAcked(beingAckedRn)
+		conn.updatePeerAckedLocked(beingAckedRn)
 		if conn.hctx != nil {
-			conn.hctx.sendQueue.Ack(conn, beingAckedRn)
+			conn.hctx.sendQueue.Ack(beingAckedRn)
 		}
+		if ex := conn.postHandshakeExchange(); ex != nil {
+			ex.sendQueue.Ack(beingAckedRn)
+		}
+		conn.receivedPMTUProbeAckLocked(opts, beingAckedRn)
 		conn.processKeyUpdateAck(beingAckedRn)
 		conn.processNewSessionTicketAck(beingAckedRn)
 	}
+	conn.retransmits = 0 // peer is alive and receives our records
+	if conn.hctx != nil {
+		conn.updateHandshakeBudgetLocked(true) // acked messages are removed from send queue
+	}
 	if epochSeqOverflowCounter != 0 {
 		opts.Stats.Warning(conn.addr, dtlserrors.WarnAckEpochSeqnumOverflow)
 	}
+	if conn.pha != nil {
+		conn.pha.maybeFinishExchange()
+	}
 	// if all messages from epoch 2 acked, then switch sending epoch
 	if conn.stateID == smIDHandshakeClientExpectFinishedAck && conn.hctx.sendQueue.Len() == 0 {
 		if !conn.keys.NewReceiveKeysSet || conn.keys.ReceiveEpoch != 3 { // should be [2] [3] here
@@ -43,8 +56,9 @@ func (conn *Connection) receivedEncryptedAckLocked(opts *Options, recordData []b
 		}
 		conn.removeOldReceiveKeys() // [2] [3] -> [3] [.]
 		alpnSelected := conn.hctx.ALPNSelected
-		conn.hctx = nil // TODO - reuse into pool
+		conn.releaseHandshakeLocked()
 		conn.stateID = smIDPostHandshake
+		conn.finishHandshakeTimerLocked()
 		conn.handler.OnHandshakeLocked(HandshakeInfo{ALPNSelected: alpnSelected})
 		conn.SignalWriteable()
 	}
@@ -76,8 +90,9 @@ func (conn *Connection) processKeyUpdateAck(rn record.Number) {
 	conn.sendKeyUpdateUpdateRequested = false // must not be necessary
 	// now when we received ack for KeyUpdate, we must update our keys
 	conn.keys.SendApplicationTrafficSecret = keys.ComputeNextApplicationTrafficSecret(conn.keys.Suite(), "send", conn.keys.SendApplicationTrafficSecret)
-	conn.keys.SendSymmetric = conn.keys.Suite().ResetSymmetricKeys(conn.keys.SendSymmetric, conn.keys.SendApplicationTrafficSecret)
+	conn.keys.SendSymmetric = conn.keys.Suite().ResetSymmetricKeys(conn.keys.SendSymmetric, conn.keys.SendApplicationTrafficSecret, conn.keys.DoNotEncryptSequenceNumbers)
 	conn.keys.SendEpoch++
 	conn.keys.SendNextSeq = 0
+	conn.startSendKeysUsageLocked()
 	conn.debugPrintKeys()
 }
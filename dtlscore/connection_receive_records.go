@@ -18,11 +18,15 @@ func (conn *Connection) checkReceiveLimits() error {
 	if conn.keys.ReceiveEpoch == 0 {
 		return dtlserrors.WarnCannotDecryptInEpoch0
 	}
-	hardLimit := min(conn.keys.SequenceNumberLimit(), constants.MaxProtectionLimitReceive)
+	failedLimit := conn.keys.FailedDeprotectionLimit()
+	if conn.keys.FailedDeprotection >= failedLimit || conn.keys.NewReceiveFailedDeprotection >= failedLimit {
+		return dtlserrors.ErrReceiveIntegrityLimit
+	}
+	hardLimit := conn.sequenceNumberLimitLocked(conn.tr.opts)
 	softLimit := constants.ProtectionSoftLimit(hardLimit)
 
-	received := conn.keys.FailedDeprotection + conn.keys.ReceiveNextSeq.GetNextReceivedSeq()
-	receivedNew := conn.keys.NewReceiveFailedDeprotection + conn.keys.NewReceiveNextSeq.GetNextReceivedSeq()
+	received := conn.keys.ReceiveNextSeq.GetNextReceivedSeq()
+	receivedNew := conn.keys.NewReceiveNextSeq.GetNextReceivedSeq()
 	if received >= hardLimit || receivedNew >= hardLimit {
 		return dtlserrors.ErrReceiveRecordSeqOverflowNextEpoch
 	}
@@ -48,6 +52,19 @@ func (conn *Connection) checkReceiveLimits() error {
 	return conn.keyUpdateStart(true)
 }
 
+// [rfc8449:4] An endpoint that receives a record larger than its advertised limit MUST
+// generate a fatal "record_overflow" alert. Called only for successfully deprotected records.
+func (conn *Connection) checkReceivedRecordSize(opts *Options, hdr record.Encrypted, rn record.Number) error {
+	if conn.sendRecordSizeLimit == 0 || rn.Epoch() < 2 {
+		return nil // not negotiated, or early data sent before peer learned our limit
+	}
+	sealSize, _ := conn.keys.ReceiveSymmetric.RecordOverhead()
+	if len(hdr.Ciphertext)-sealSize > int(opts.recordSizeLimit()) { // widening
+		return dtlserrors.ErrRecordOverflow
+	}
+	return nil
+}
+
 // returns contentType == 0 (which is impossible due to padding format) with err == nil when replay detected
 func (conn *Connection) deprotectLocked(hdr record.Encrypted) ([]byte, record.Number, byte, error) {
 	if conn.keys.ReceiveEpoch == 0 {
@@ -107,13 +124,12 @@ func (conn *Connection) deprotectLocked(hdr record.Encrypted) ([]byte, record.Nu
 }
 
 func (conn *Connection) deprotectWithKeysLocked(keys ciphersuite.SymmetricKeys, hdr record.Encrypted, expectedSN uint64) (recordBody []byte, seq uint64, contentType byte, err error) {
-	if !conn.keys.DoNotEncryptSequenceNumbers {
-		mask, err := keys.EncryptSeqMask(hdr.Ciphertext)
-		if err != nil {
-			return nil, 0, 0, err
-		}
-		encryptSequenceNumbers(hdr.SeqNum, mask)
+	// zero mask if sequence numbers are not encrypted
+	mask, err := keys.EncryptSeqMask(hdr.Ciphertext)
+	if err != nil {
+		return nil, 0, 0, err
 	}
+	encryptSequenceNumbers(hdr.SeqNum, mask)
 	decryptedSeqData, seq := hdr.ClosestSequenceNumber(hdr.SeqNum, expectedSN)
 	fmt.Printf("decrypted SN: %d, closest: %d\n", decryptedSeqData, seq)
 
@@ -17,7 +17,7 @@ import (
 )
 
 func (conn *Connection) SignalWriteable() {
-	conn.tr.snd.RegisterConnectionForSend(conn)
+	conn.tr.snds[conn.shard].RegisterConnectionForSend(conn)
 }
 
 func (conn *Connection) hasDataToSend() bool {
@@ -33,7 +33,10 @@ func (conn *Connection) hasDataToSendLocked() bool {
 	if hctx != nil && hctx.sendQueue.HasDataToSend() {
 		return true
 	}
-	if conn.keys.SendEpoch != 0 && conn.keys.SendAcks.GetBitCount() != 0 {
+	if ex := conn.postHandshakeExchange(); ex != nil && ex.sendQueue.HasDataToSend() {
+		return true
+	}
+	if conn.sendAckNow && conn.keys.SendEpoch != 0 && conn.keys.SendAcks.GetBitCount() != 0 {
 		return true
 	}
 	if conn.keyUpdateInProgress() && (conn.sentKeyUpdateRN == record.Number{}) {
@@ -42,21 +45,37 @@ func (conn *Connection) hasDataToSendLocked() bool {
 	if conn.sendNewSessionTicketMessageSeq != 0 && (conn.sentNewSessionTicketRN == record.Number{}) {
 		return true
 	}
+	if conn.hasPathDataToSendLocked() {
+		return true
+	}
+	if conn.sendKeepalive && conn.keys.SendSymmetric != nil {
+		return true
+	}
 	return conn.sendAlert != (record.Alert{})
 }
 
 // must not write over len(datagram), returns part of datagram filled
-func (conn *Connection) constructDatagram(opts *Options, datagram []byte) (addr netip.AddrPort, datagramSize int, addToSendQueue bool) {
+func (conn *Connection) constructDatagram(opts *Options, datagram []byte) (addr netip.AddrPort, localAddr netip.Addr, datagramSize int, addToSendQueue bool) {
 	conn.mu.Lock()
 	defer conn.mu.Unlock()
 	addr = conn.addr
+	localAddr = conn.localAddr
 	var err error
 
-	datagramSize, addToSendQueue, err = conn.constructDatagramLocked(opts, datagram)
+	if pathAddr, pathLocalAddr, pathSize, pathErr := conn.constructPathDatagramLocked(opts, datagram); pathSize != 0 || pathErr != nil {
+		addr, localAddr, datagramSize, addToSendQueue, err = pathAddr, pathLocalAddr, pathSize, true, pathErr
+	} else {
+		datagram = datagram[:min(len(datagram), conn.pathMTULocked(opts))]
+		datagramSize, addToSendQueue, err = conn.constructDatagramLocked(opts, datagram)
+		if datagramSize >= statelessResetTailSize {
+			conn.sentDatagramTail = datagramTail(datagram[:datagramSize])
+		}
+	}
+	conn.updateRetransmitDeadlineLocked()
 	// TODO - return dtls.Error from constructDatagramLocked so we can get to alert without cast
 	// and cannot return some other error type
-	if err != nil && conn.ShutdownLocked(record.Alert{Level: record.AlerLevelFatal, Description: 22}) {
-		fmt.Printf("seq overflow or another serious problem in connection to: %v\n", addr)
+	if err != nil && conn.failLocked(err) {
+		fmt.Printf("seq overflow or another serious problem in connection to: %v: %v\n", addr, err)
 	}
 	if conn.stateID == smIDShutdown && conn.sendAlert == (record.Alert{}) {
 		// We need to call onDisconnect from our reactor, so when shutdown state is set, we register
@@ -90,7 +109,8 @@ func (conn *Connection) constructDatagramLocked(opts *Options, datagram []byte)
 	if hctx != nil {
 		// we decided to first send our messages, then acks.
 		// because message has a chance to ack the whole flight
-		if recordSize, endDatagramNow, err := hctx.sendQueue.ConstructDatagram(conn, opts, datagram[datagramSize:]); err != nil {
+		if recordSize, endDatagramNow, err := hctx.sendQueue.ConstructDatagram(conn, opts, datagram[datagramSize:],
+			hctx.SendSymmetricEpoch2, 2, &hctx.SendNextSeqEpoch2); err != nil {
 			return 0, false, err
 		} else {
 			datagramSize += recordSize
@@ -103,6 +123,14 @@ func (conn *Connection) constructDatagramLocked(opts *Options, datagram []byte)
 		//	return datagramSize, true, nil
 		//}
 	}
+	if ex := conn.postHandshakeExchange(); ex != nil {
+		if recordSize, _, err := ex.sendQueue.ConstructDatagram(conn, opts, datagram[datagramSize:],
+			conn.keys.SendSymmetric, conn.keys.SendEpoch, &conn.keys.SendNextSeq); err != nil {
+			return 0, false, err
+		} else {
+			datagramSize += recordSize
+		}
+	}
 	if conn.keyUpdateInProgress() && (conn.sentKeyUpdateRN == record.Number{}) {
 		msgBody := make([]byte, 0, 1) // must be stack-allocated
 		msgKeyUpdate := handshake.MsgKeyUpdate{UpdateRequested: conn.sendKeyUpdateUpdateRequested}
@@ -126,6 +154,7 @@ func (conn *Connection) constructDatagramLocked(opts *Options, datagram []byte)
 			}
 			datagramSize += recordSize
 			conn.sentKeyUpdateRN = rn
+			conn.rtt.recordSent(rn)
 		}
 		//uncomment to separate datagram by record type
 		//if datagramSize != 0 {
@@ -147,6 +176,9 @@ func (conn *Connection) constructDatagramLocked(opts *Options, datagram []byte)
 		//	return datagramSize, true, nil
 		//}
 	}
+	if conn.stateID == smIDShutdown { // no user data after alert
+		return datagramSize, false, nil
+	}
 	if conn.keys.SendSymmetric == nil {
 		return datagramSize, conn.hasDataToSendLocked(), nil
 	}
@@ -159,7 +191,9 @@ func (conn *Connection) constructDatagramLocked(opts *Options, datagram []byte)
 	//	return datagramSize, true, nil
 	//}
 	userPadding := rand.Intn(4) // TODO - remove
-	hdrSize, insideBody, ok := prepareProtect(conn.keys.SendSymmetric, datagram[datagramSize:], opts.Use8BitSeq, userPadding)
+	// user record is always the last one
+	hdrSize := conn.recordHeaderSize(opts, conn.keys.SendEpoch, conn.keys.SendNextSeq, true)
+	insideBody, ok := conn.prepareProtect(conn.keys.SendSymmetric, datagram[datagramSize:], hdrSize, userPadding)
 	if !ok || len(insideBody) < constants.MinFragmentBodySize {
 		return datagramSize, true, nil
 	}
@@ -170,6 +204,9 @@ func (conn *Connection) constructDatagramLocked(opts *Options, datagram []byte)
 	if insideSize > len(insideBody) {
 		panic("ciphertext user handler overflows allowed record")
 	}
+	if !send && conn.sendKeepalive && datagramSize == 0 {
+		send, insideSize = true, 0 // empty record, see keepalive.go
+	}
 	if send {
 		recordSize, _, err := conn.protectRecord(
 			conn.keys.SendSymmetric, conn.keys.SendEpoch, &conn.keys.SendNextSeq,
@@ -178,6 +215,7 @@ func (conn *Connection) constructDatagramLocked(opts *Options, datagram []byte)
 			return 0, false, err
 		}
 		datagramSize += recordSize
+		conn.sendKeepalive = false // any record in datagram refreshes NAT bindings
 	}
 	return datagramSize, wr || conn.hasDataToSendLocked(), nil
 }
@@ -202,7 +240,8 @@ func (conn *Connection) constructDatagramAcks(opts *Options, datagramLeft []byte
 	}
 
 	userPadding := rand.Intn(4) // TODO - remove
-	hdrSize, insideBody, ok := prepareProtect(sendSymmetric, datagramLeft, opts.Use8BitSeq, userPadding)
+	hdrSize := conn.recordHeaderSize(opts, sendEpoch, *sendNextSeq, false)
+	insideBody, ok := conn.prepareProtect(sendSymmetric, datagramLeft, hdrSize, userPadding)
 	if !ok || len(insideBody) < record.AckHeaderSize+record.AckElementSize { // not a single one fits
 		return 0, nil
 	}
@@ -234,6 +273,7 @@ func (conn *Connection) constructDatagramAcks(opts *Options, datagramLeft []byte
 	if err != nil {
 		return 0, err
 	}
+	conn.ackSentLocked(acksCount)
 	return recordSize, nil
 }
 
@@ -251,7 +291,9 @@ func (conn *Connection) constructDatagramAlert(opts *Options, datagramLeft []byt
 		return 0, nil
 	}
 	userPadding := rand.Intn(4) // TODO - remove
-	hdrSize, insideBody, ok := prepareProtect(sendSymmetric, datagramLeft, opts.Use8BitSeq, userPadding)
+	// in shutdown state, nothing is sent after alert
+	hdrSize := conn.recordHeaderSize(opts, sendEpoch, *sendNextSeq, conn.stateID == smIDShutdown)
+	insideBody, ok := conn.prepareProtect(sendSymmetric, datagramLeft, hdrSize, userPadding)
 	if !ok || len(insideBody) < record.AlertSize {
 		return 0, nil
 	}
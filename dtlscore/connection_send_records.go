@@ -40,7 +40,8 @@ func (conn *Connection) constructHandshakeEncryptedRecord(
 		Body: handshakeMsg.Body,
 	}
 	userPadding := rand.Intn(4) // TODO - remove
-	hdrSize, insideBody, ok := prepareProtect(sendSymmetric, datagramLeft, opts.Use8BitSeq, userPadding)
+	hdrSize := conn.recordHeaderSize(opts, sendEpoch, *sendNextSeq, false)
+	insideBody, ok := conn.prepareProtect(sendSymmetric, datagramLeft, hdrSize, userPadding)
 	if !ok || len(insideBody) <= handshake.FragmentHeaderSize {
 		return
 	}
@@ -117,16 +118,16 @@ func (conn *Connection) constructPlaintextRecord(datagramLeft []byte, msg handsh
 
 // returns seq number to use
 func (conn *Connection) checkSendLimit(sendEpoch uint16, sendNextSeq *uint64) (uint64, error) {
-	sendLimit := min(conn.keys.SequenceNumberLimit(), constants.MaxProtectionLimitSend)
+	sendLimit := conn.sequenceNumberLimitLocked(conn.tr.opts)
 	if *sendNextSeq >= sendLimit {
 		return 0, dtlserrors.ErrSendRecordSeqOverflow
 	}
 	seq := *sendNextSeq
 	*sendNextSeq++ // does not overflow due to check obove
-	if *sendNextSeq < constants.ProtectionSoftLimit(sendLimit) {
+	if sendEpoch < 3 {
 		return seq, nil
 	}
-	if sendEpoch < 3 {
+	if *sendNextSeq < constants.ProtectionSoftLimit(sendLimit) && !conn.sendKeysBytesExceededLocked(conn.tr.opts) {
 		return seq, nil
 	}
 	return seq, conn.keyUpdateStart(false)
@@ -136,29 +137,33 @@ func (conn *Connection) checkSendLimit(sendEpoch uint16, sendNextSeq *uint64) (u
 // Reserves space for header and padding, returns ok and insideBody to write application data into,
 // or (if even 0-byte application data will not fit), returns !ok.
 // Caller should check if his data fits into insideBody, put it there.
-func prepareProtect(sendSymmetric ciphersuite.SymmetricKeys, datagramLeft []byte, use8BitSeq bool, userPadding int) (hdrSize int, insideBody []byte, ok bool) {
+// If peer sent record_size_limit, insideBody is also limited by it [rfc8449:4].
+// hdrSize from recordHeaderSize
+func (conn *Connection) prepareProtect(sendSymmetric ciphersuite.SymmetricKeys, datagramLeft []byte, hdrSize int, userPadding int) (insideBody []byte, ok bool) {
 	sealSize, minCiphertextSize := sendSymmetric.RecordOverhead()
-	hdrSize = record.OutgoingCiphertextRecordHeader16
-	if use8BitSeq {
-		hdrSize = record.OutgoingCiphertextRecordHeader8
-	}
 	if len(datagramLeft)-hdrSize < minCiphertextSize { // not enough ciphertext to encrypt seq
-		return 0, nil, false
+		return nil, false
 	}
 	cipherTextSize := 1 + userPadding + sealSize
 	overhead := hdrSize + cipherTextSize
 	userSpace := len(datagramLeft) - overhead
+	if conn.sendRecordSizeLimit != 0 {
+		// limit includes content type and padding
+		userSpace = min(userSpace, int(conn.sendRecordSizeLimit)-1-userPadding) // widening
+	}
 	if userSpace < 0 {
-		return 0, nil, false
+		return nil, false
 	}
-	return hdrSize, datagramLeft[hdrSize : hdrSize+userSpace], true
+	return datagramLeft[hdrSize : hdrSize+userSpace], true
 }
 
 func (conn *Connection) protectRecord(
 	sendSymmetric ciphersuite.SymmetricKeys, sendEpoch uint16, sendNextSeq *uint64,
 	recordType byte, datagramLeft []byte, userPadding int, hdrSize int, insideSize int) (recordSize int, _ record.Number, _ error) {
-	if hdrSize != record.OutgoingCiphertextRecordHeader8 && hdrSize != record.OutgoingCiphertextRecordHeader16 {
-		panic("outgoing record header size must be 4 or 5 bytes")
+	cidLength := int(conn.sendCIDLength) // widening
+	has16bitSeqNum, hasLength, ok := record.OutgoingCiphertextHeaderFormat(hdrSize - cidLength)
+	if !ok {
+		panic("outgoing record header size must be 2..5 bytes plus CID")
 	}
 	if insideSize > record.MaxPlaintextRecordLength {
 		panic("outgoing record size too big")
@@ -170,14 +175,13 @@ func (conn *Connection) protectRecord(
 	rn := record.NumberWith(sendEpoch, seq)
 	sealSize, minCiphertextSize := sendSymmetric.RecordOverhead()
 
-	// format of our encrypted record is fixed.
-	// Saving 1 byte for the sequence number seems very niche.
-	// Saving on not including length of the last datagram is also very hard.
-	// At the point we know it is the last one, we cannot not change header,
-	// because it is "additional data" for AEAD
-	firstByte := record.CiphertextHeaderFirstByte(false, hdrSize == record.OutgoingCiphertextRecordHeader16, true, rn.Epoch())
+	// format is decided by caller before writing record (see recordHeaderSize), because we cannot
+	// change header after encryption, it is "additional data" for AEAD
+	firstByte := record.CiphertextHeaderFirstByte(cidLength != 0, has16bitSeqNum, hasLength, rn.Epoch())
 	// panic below would mean, caller violated invariant of using datagram space
 	datagramLeft[0] = firstByte
+	copy(datagramLeft[1:], conn.sendCID[:cidLength]) // [rfc9147:9] peer's CID
+	seqOffset := 1 + cidLength
 	datagramLeft[hdrSize+insideSize] = recordType
 	insideSize++
 
@@ -192,23 +196,26 @@ func (conn *Connection) protectRecord(
 	cipherTextLength := safecast.Cast[uint16](insideSize + sealSize)
 
 	var seqNumData []byte
-	if hdrSize == record.OutgoingCiphertextRecordHeader8 {
-		seqNumData = datagramLeft[1:2]
+	if !has16bitSeqNum {
+		seqNumData = datagramLeft[seqOffset : seqOffset+1]
 		seqNumData[0] = byte(rn.SeqNum()) // truncation
-		binary.BigEndian.PutUint16(datagramLeft[2:], cipherTextLength)
 	} else {
-		seqNumData = datagramLeft[1:3]
+		seqNumData = datagramLeft[seqOffset : seqOffset+2]
 		binary.BigEndian.PutUint16(seqNumData, uint16(rn.SeqNum())) // truncation
-		binary.BigEndian.PutUint16(datagramLeft[3:], cipherTextLength)
+	}
+	if hasLength {
+		binary.BigEndian.PutUint16(datagramLeft[seqOffset+len(seqNumData):], cipherTextLength)
 	}
 	fmt.Printf("constructing ciphertext type %d with rn={%d,%d} hdrSize = %d body: %x\n", recordType, rn.Epoch(), rn.SeqNum(), hdrSize, datagramLeft[hdrSize:hdrSize+insideSize])
 	sendSymmetric.AEADEncrypt(rn.SeqNum(), datagramLeft, hdrSize, insideSize)
-	if !conn.keys.DoNotEncryptSequenceNumbers {
-		mask, err := sendSymmetric.EncryptSeqMask(datagramLeft[hdrSize:])
-		if err != nil {
-			panic("cipher text too short when sending")
-		}
-		encryptSequenceNumbers(seqNumData, mask)
+	// zero mask if sequence numbers are not encrypted
+	mask, err := sendSymmetric.EncryptSeqMask(datagramLeft[hdrSize:])
+	if err != nil {
+		panic("cipher text too short when sending")
+	}
+	encryptSequenceNumbers(seqNumData, mask)
+	if sendEpoch >= 3 {
+		conn.sendKeysBytes += uint64(insideSize) // widening
 	}
 	return hdrSize + insideSize + sealSize, rn, nil
 }
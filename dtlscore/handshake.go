@@ -9,17 +9,14 @@ import (
 	"math"
 
 	"github.com/hrissan/dtls/ciphersuite"
-	"github.com/hrissan/dtls/circular"
-	"github.com/hrissan/dtls/constants"
 	"github.com/hrissan/dtls/dtlserrors"
-	"github.com/hrissan/dtls/dtlsrand"
 	"github.com/hrissan/dtls/handshake"
 	"github.com/hrissan/dtls/record"
 )
 
 type handshakeContext struct {
 	localRandom  [32]byte
-	x25519Secret *ecdh.PrivateKey // Tons of allocations here. TODO - compute in calculator goroutine
+	x25519Secret *ecdh.PrivateKey // from KeySharePool, used once
 
 	earlySecret                   ciphersuite.Hash
 	masterSecret                  ciphersuite.Hash
@@ -47,12 +44,25 @@ type handshakeContext struct {
 	serverUsedHRR bool // we must store this to validate state transition
 	ALPNSelected  []byte
 
+	postHandshakeAuth bool // on server, client sent post_handshake_auth
+
+	// on server, remembered from ClientHello to generate ServerHello after key share is computed
+	pskSelectedIdentity uint16
+	sendConnectionID    bool
+	sendOCSPStaple      bool
+
+	computation computation // pending, see handshake_compute.go
+
+	deadlineUnixNano int64 // Options.HandshakeTimeout, 0 if no limit
+
+	budget         handshakeBudget // protected by transport mutex
+	budgetReported handshakeBudgetReported
+
 	// We need more than 1 message, otherwise we will lose them, while
 	// handshake is in a state of waiting finish of offloaded calculations.
 	// if full message is received, and it is the first in the queue (or queue is empty),
 	// then
-	receivedMessages        circular.BufferExt[partialHandshakeMsg]
-	receivedMessagesStorage [constants.MaxReceiveMessagesQueue]partialHandshakeMsg
+	receivedMessages receiveQueue
 
 	sendQueue sendQueue
 
@@ -70,23 +80,6 @@ func newHandshakeContext(hasher hash.Hash) *handshakeContext {
 	return hctx
 }
 
-func (hctx *handshakeContext) firstMessageSeqInReceiveQueue(conn *Connection) uint16 {
-	if hctx.receivedMessages.Len() > int(conn.nextMessageSeqReceive) { // widening
-		panic("received messages queue invariant violated")
-	}
-	return conn.nextMessageSeqReceive - uint16(hctx.receivedMessages.Len()) // safe due to check above
-}
-
-func (hctx *handshakeContext) ComputeKeyShare(rnd dtlsrand.Rand) {
-	var X25519Secret [32]byte
-	rnd.ReadMust(X25519Secret[:])
-	priv, err := ecdh.X25519().NewPrivateKey(X25519Secret[:])
-	if err != nil {
-		panic("curve25519.X25519 failed")
-	}
-	hctx.x25519Secret = priv
-}
-
 func (hctx *handshakeContext) receivedNextFlight(conn *Connection) {
 	// implicit ack of all previous flights
 	hctx.sendQueue.Clear()
@@ -96,68 +89,25 @@ func (hctx *handshakeContext) receivedNextFlight(conn *Connection) {
 }
 
 func (hctx *handshakeContext) ReceivedFragment(conn *Connection, fragment handshake.Fragment, rn record.Number) error {
-	if fragment.Header.MsgType == handshake.MsgTypeZero { // we use it as a flag of not yet received message below, so check here
-		return dtlserrors.ErrHandshakeMessageTypeUnknown
-	}
-	messageOffset := int(fragment.Header.MsgSeq) + hctx.receivedMessages.Len() - int(conn.nextMessageSeqReceive) // widening
-	if messageOffset < 0 {
-		panic("checked before calling handshakeContext.ReceivedFragment")
-	}
-	if messageOffset >= hctx.receivedMessages.Cap(hctx.receivedMessagesStorage[:]) {
-		return nil // would be beyond queue even if we fill it
-	}
-	for messageOffset >= hctx.receivedMessages.Len() {
-		hctx.receivedMessages.PushBack(hctx.receivedMessagesStorage[:], partialHandshakeMsg{})
-		if conn.nextMessageSeqReceive == math.MaxUint16 {
-			// can happen only when fragment.MsgSeq == math.MaxUint16
-			return dtlserrors.ErrReceivedMessageSeqOverflow
-		}
-		conn.nextMessageSeqReceive++
-	}
-	partialMessage := hctx.receivedMessages.IndexRef(hctx.receivedMessagesStorage[:], messageOffset)
-	if partialMessage.Msg.MsgType == handshake.MsgTypeZero { // the first fragment, we need to set header, allocate body
-		*partialMessage = partialHandshakeMsg{
-			Msg: handshake.Message{
-				MsgType: fragment.Header.MsgType,
-				MsgSeq:  fragment.Header.MsgSeq,
-			},
-		}
-		partialMessage.Ass.ResetToFull(fragment.Header.Length)
-		partialMessage.Msg.Body = make([]byte, fragment.Header.Length) // TODO - rope from pull
-	} else {
-		if fragment.Header.MsgSeq != partialMessage.Msg.MsgSeq {
-			panic("message sequence is queue offset and must always match")
-		}
-		if fragment.Header.Length != partialMessage.Msg.Len32() {
-			return dtlserrors.ErrHandshakeMessageFragmentLengthMismatch
-		}
-		if fragment.Header.MsgType != partialMessage.Msg.MsgType {
-			return dtlserrors.ErrHandshakeMessageFragmentTypeMismatch
-		}
-	}
-	shouldAck, changed := partialMessage.Ass.AddFragment(fragment.Header.FragmentOffset, fragment.Header.FragmentLength)
-	if !shouldAck {
-		return nil // got in the middle of the hole, wait for fragment which we can actully add
-	}
-	conn.keys.AddAck(rn) // should ack it independent of conditions below
-	if !changed {        // nothing new, save copy
-		return nil
+	changed, err := hctx.receivedMessages.ReceivedFragment(conn, fragment, rn)
+	if err != nil || !changed {
+		return err
 	}
-	copy(partialMessage.Msg.Body[fragment.Header.FragmentOffset:], fragment.Body) // copy all bytes for simplicity
 	// now we could ack the first message, so delivery all full messages
-	return hctx.DeliverReceivedMessages(conn)
+	err = hctx.DeliverReceivedMessages(conn)
+	if conn.hctx == hctx { // handshake can finish or be cancelled by message
+		conn.updateHandshakeBudgetLocked(true)
+	}
+	return err
 }
 
 // called when fully received message or when hctx.CanDeliveryMessages change
 func (hctx *handshakeContext) DeliverReceivedMessages(conn *Connection) error {
-	for hctx.receivedMessages.Len() != 0 && hctx.CanDeliveryMessages { // check here because changes in receivedFullMessage
-		first := hctx.receivedMessages.FrontRef(hctx.receivedMessagesStorage[:])
-		if first.Msg.MsgType == handshake.MsgTypeZero || first.Ass.FragmentsCount() != 0 {
-			// not a single fragment received, or not fully received
+	for hctx.CanDeliveryMessages { // check here because changes in receivedFullMessage
+		msg, ok := hctx.receivedMessages.PopFullMessage()
+		if !ok {
 			return nil
 		}
-		msg := first.Msg
-		hctx.receivedMessages.PopFront(hctx.receivedMessagesStorage[:])
 		err := hctx.receivedFullMessage(conn, msg)
 		// TODO - return message body to pool here
 		if err != nil {
@@ -184,5 +134,6 @@ func (hctx *handshakeContext) PushMessageNoHasher(conn *Connection, msg handshak
 	conn.nextMessageSeqSend++
 
 	hctx.sendQueue.PushMessage(msg)
+	conn.updateHandshakeBudgetLocked(false)
 	return nil
 }
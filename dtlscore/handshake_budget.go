@@ -0,0 +1,186 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"time"
+)
+
+// Handshakes are much larger than established connections, so they have separate limits,
+// Options.MaxHandshakes and Options.MaxHandshakeMemory. Memory is sizeof(handshakeContext)
+// plus bodies of messages currently in receive and send queues (popped and acked ones are not counted).
+//
+// To not take transport mutex for every message, memory is reserved in handshakeMemoryChunk
+// units, and progress time is updated at most every handshakeProgressGranularity.
+//
+// When limit is reached, we evict the most stalled handshake (one which did not
+// progress for the longest time). If even it progressed recently, new handshake is refused.
+// Stateless HRR is sent as usual, so refused clients will retransmit ClientHello2 later.
+//
+// Eviction happens under transport mutex, where we cannot lock victim connection,
+// so we remove victim from accounting immediately, then kick its timer, and
+// connection shuts itself down from the timer goroutine.
+//
+// Slot is reserved (counted against limits) in the same critical section where room is made,
+// so concurrent receivers cannot exceed limits. Reservation is then either converted into
+// handshake by addHandshake, or returned by cancelHandshakeSlot.
+
+// handshake which did not progress in initial retransmission timeout is considered stalled,
+// because peer did not respond to our flight.
+const handshakeStalledDuration = retransmitInitialTimeout
+
+const handshakeMemoryChunk = 1024
+const handshakeProgressGranularity = handshakeStalledDuration / 8
+
+// fields in handshakeContext, protected by transport mutex
+type handshakeBudget struct {
+	conn             *Connection // for eviction
+	heapIndex        int
+	progressUnixNano int64
+	memory           int
+	evicted          bool
+}
+
+// fields in handshakeContext, protected by connection mutex, last values passed to transport
+type handshakeBudgetReported struct {
+	bodyBytes        int // multiple of handshakeMemoryChunk
+	progressUnixNano int64
+}
+
+func handshakeHeapPred(a, b *handshakeContext) bool {
+	return a.budget.progressUnixNano < b.budget.progressUnixNano
+}
+
+// returns false if handshake must be refused. Otherwise, caller must call
+// either addHandshake or cancelHandshakeSlot.
+func (t *Transport) reserveHandshakeSlot() bool {
+	now := time.Now().UnixNano()
+	var victimsStorage [4]*Connection
+	victims, ok := t.reserveHandshakeSlotLocked(now, victimsStorage[:0])
+	// timers are kicked outside of transport mutex, fireFunc was set before handshake
+	// was added, under victim's lock. If victim is closed meanwhile, timer fires harmlessly.
+	for _, conn := range victims {
+		t.clock.SetTimer(&conn.timer, time.Unix(0, now))
+	}
+	return ok
+}
+
+func (t *Transport) reserveHandshakeSlotLocked(now int64, victims []*Connection) ([]*Connection, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for t.handshakes.Len()+t.reservedHandshakes >= t.opts.MaxHandshakes ||
+		t.handshakeMemory+sizeofHandshakeContext() > t.opts.MaxHandshakeMemory {
+		if t.handshakes.Len() == 0 {
+			return victims, false
+		}
+		victim := t.handshakes.Front()
+		if now-victim.budget.progressUnixNano < int64(handshakeStalledDuration) {
+			return victims, false
+		}
+		t.handshakes.PopFront()
+		t.handshakeMemory -= victim.budget.memory
+		t.handshakeEvictions++
+		victim.budget.evicted = true
+		victims = append(victims, victim.budget.conn)
+	}
+	t.reservedHandshakes++
+	t.handshakeMemory += sizeofHandshakeContext()
+	return victims, true
+}
+
+// if handshake did not start after reserveHandshakeSlot returned true
+func (t *Transport) cancelHandshakeSlot() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.reservedHandshakes--
+	t.handshakeMemory -= sizeofHandshakeContext()
+}
+
+// call under connection's mutex, after reserveHandshakeSlot returned true
+func (t *Transport) addHandshake(conn *Connection, hctx *handshakeContext) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.reservedHandshakes-- // memory was added by reserveHandshakeSlot
+	now := time.Now().UnixNano()
+	hctx.budget.conn = conn
+	hctx.budget.progressUnixNano = now
+	hctx.budget.memory = sizeofHandshakeContext()
+	hctx.budgetReported = handshakeBudgetReported{progressUnixNano: now}
+	t.handshakes.Insert(hctx, &hctx.budget.heapIndex)
+}
+
+// call under connection's mutex when handshake context is destroyed
+func (t *Transport) removeHandshake(hctx *handshakeContext) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.handshakes.Erase(hctx, &hctx.budget.heapIndex) {
+		t.handshakeMemory -= hctx.budget.memory
+	}
+	hctx.budget.conn = nil
+}
+
+// call when messages are received, pushed, popped or acked. If progress is set (peer sent
+// something useful), handshake moves to the end of eviction order. Transport mutex is taken
+// only if memory crosses chunk boundary or progress time is too old.
+func (conn *Connection) updateHandshakeBudgetLocked(progress bool) {
+	hctx := conn.hctx
+	reported := &hctx.budgetReported
+	bodyBytes := hctx.receivedMessages.bodyBytes + hctx.sendQueue.bodyBytes
+	memoryDelta := 0
+	if bodyBytes > reported.bodyBytes || bodyBytes+handshakeMemoryChunk <= reported.bodyBytes {
+		rounded := (bodyBytes + handshakeMemoryChunk - 1) / handshakeMemoryChunk * handshakeMemoryChunk
+		memoryDelta = rounded - reported.bodyBytes
+		reported.bodyBytes = rounded
+	}
+	var now int64
+	if progress {
+		now = time.Now().UnixNano()
+		if progress = now-reported.progressUnixNano >= int64(handshakeProgressGranularity); progress {
+			reported.progressUnixNano = now
+		}
+	}
+	if memoryDelta != 0 || progress {
+		conn.tr.updateHandshake(hctx, memoryDelta, progress, now)
+	}
+}
+
+func (t *Transport) updateHandshake(hctx *handshakeContext, memoryDelta int, progress bool, now int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if hctx.budget.heapIndex == 0 {
+		return // not added or already evicted
+	}
+	hctx.budget.memory += memoryDelta
+	t.handshakeMemory += memoryDelta
+	if progress {
+		// TODO - 1 heap rebalance instead of 2
+		t.handshakes.Erase(hctx, &hctx.budget.heapIndex)
+		hctx.budget.progressUnixNano = now
+		t.handshakes.Insert(hctx, &hctx.budget.heapIndex)
+	}
+}
+
+// call under connection's mutex
+func (t *Transport) isHandshakeEvicted(hctx *handshakeContext) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return hctx.budget.evicted
+}
+
+// Number of live handshakes, memory they use, and total evictions since transport start.
+func (t *Transport) HandshakeStats() (handshakes int, memory int, evictions int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.handshakes.Len(), t.handshakeMemory, t.handshakeEvictions
+}
+
+// all handshake contexts must be destroyed with this function for memory accounting
+func (conn *Connection) releaseHandshakeLocked() {
+	if conn.hctx == nil {
+		return
+	}
+	conn.tr.removeHandshake(conn.hctx)
+	conn.hctx = nil // TODO - reuse into pool
+	conn.inHandshake.Store(false)
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"errors"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hrissan/dtls/dtlserrors"
+	"github.com/hrissan/dtls/dtlsrand"
+	"github.com/hrissan/dtls/record"
+	"github.com/hrissan/dtls/transport/stats"
+)
+
+func TestHandshakeBudget_RefuseAndEvict(t *testing.T) {
+	opts := DefaultTransportOptions(false, dtlsrand.CryptoRand(), stats.NewStatsLogVerbose())
+	opts.MaxHandshakes = 2
+	tr := NewTransport(opts, &statelessSender{}, nil)
+	go tr.Clock().GoRun()
+	defer tr.Clock().Close()
+
+	var conns [3]Connection
+	var handlers [3]disconnectHandler
+	for i := range conns {
+		handlers[i].disconnected = make(chan error, 1)
+	}
+	addr := func(i int) netip.AddrPort { return netip.AddrPortFrom(netip.MustParseAddr("127.0.0.1"), uint16(i+1)) }
+	for i := 0; i < 2; i++ {
+		if err := tr.StartConnection(&conns[i], &handlers[i], addr(i)); err != nil {
+			t.Fatalf("failed to start connection: %v", err)
+		}
+		if !conns[i].SenderInHandshake() {
+			t.Fatalf("sender must schedule connection as handshake")
+		}
+	}
+	if err := tr.StartConnection(&conns[2], &handlers[2], addr(2)); err != dtlserrors.WarnHandshakeLimit {
+		t.Fatalf("handshake must be refused while others progress, got %v", err)
+	}
+	<-handlers[2].disconnected
+	if n, memory, _ := tr.HandshakeStats(); n != 2 || memory <= 2*sizeofHandshakeContext() {
+		t.Fatalf("wrong accounting handshakes=%d memory=%d", n, memory)
+	}
+	// the first one stalls
+	tr.mu.Lock()
+	tr.handshakes.Erase(conns[0].hctx, &conns[0].hctx.budget.heapIndex)
+	conns[0].hctx.budget.progressUnixNano -= int64(2 * handshakeStalledDuration)
+	tr.handshakes.Insert(conns[0].hctx, &conns[0].hctx.budget.heapIndex)
+	tr.mu.Unlock()
+
+	if err := tr.StartConnection(&conns[2], &handlers[2], addr(2)); err != nil {
+		t.Fatalf("stalled handshake must be evicted, got %v", err)
+	}
+	if n, _, evictions := tr.HandshakeStats(); n != 2 || evictions != 1 {
+		t.Fatalf("wrong accounting handshakes=%d evictions=%d", n, evictions)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conns[0].mu.Lock()
+		shutdown := conns[0].stateID == smIDShutdown
+		conns[0].mu.Unlock()
+		if shutdown {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("evicted handshake was not shut down")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	var datagram [1500]byte
+	_, _, _, _ = conns[0].constructDatagram(opts, datagram[:]) // sender calls OnDisconnectLocked
+	if err := <-handlers[0].disconnected; !errors.Is(err, dtlserrors.ErrHandshakeEvicted) {
+		t.Fatalf("wrong disconnect error: %v", err)
+	}
+	if conns[0].SenderInHandshake() {
+		t.Fatalf("sender must not schedule closed connection as handshake")
+	}
+}
+
+func TestHandshakeBudget_Concurrent(t *testing.T) {
+	opts := DefaultTransportOptions(false, dtlsrand.CryptoRand(), stats.NewStatsLogVerbose())
+	opts.MaxHandshakes = 4
+	tr := NewTransport(opts, &statelessSender{}, nil)
+	go tr.Clock().GoRun()
+	defer tr.Clock().Close()
+
+	const n = 64
+	var conns [n]Connection
+	var handlers [n]disconnectHandler
+	var started atomic.Int32
+	var wg sync.WaitGroup
+	for i := range conns {
+		handlers[i].disconnected = make(chan error, 1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			addr := netip.AddrPortFrom(netip.MustParseAddr("127.0.0.1"), uint16(i+1)) // truncation
+			if err := tr.StartConnection(&conns[i], &handlers[i], addr); err == nil {
+				started.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	handshakes, memory, _ := tr.HandshakeStats()
+	if started.Load() != int32(opts.MaxHandshakes) || handshakes != opts.MaxHandshakes { // truncation
+		t.Fatalf("concurrent handshakes must not exceed limit, started=%d handshakes=%d", started.Load(), handshakes)
+	}
+	tr.mu.Lock()
+	reserved := tr.reservedHandshakes
+	tr.mu.Unlock()
+	if reserved != 0 || memory < handshakes*sizeofHandshakeContext() {
+		t.Fatalf("wrong accounting reserved=%d memory=%d", reserved, memory)
+	}
+}
+
+func TestHandshakeBudget_MemoryReleased(t *testing.T) {
+	opts := DefaultTransportOptions(false, dtlsrand.CryptoRand(), stats.NewStatsLogVerbose())
+	tr := NewTransport(opts, &statelessSender{}, nil)
+	conn := &Connection{}
+	handler := &disconnectHandler{disconnected: make(chan error, 1)}
+	if err := tr.StartConnection(conn, handler, netip.MustParseAddrPort("127.0.0.1:1")); err != nil {
+		t.Fatalf("failed to start connection: %v", err)
+	}
+	if _, memory, _ := tr.HandshakeStats(); memory != sizeofHandshakeContext()+handshakeMemoryChunk {
+		t.Fatalf("ClientHello must reserve memory chunk, got memory=%d", memory)
+	}
+	var datagram [1500]byte
+	if _, _, size, _ := conn.constructDatagram(opts, datagram[:]); size == 0 {
+		t.Fatalf("ClientHello not sent")
+	}
+	conn.Lock()
+	conn.hctx.sendQueue.Ack(record.NumberWith(0, 0))
+	conn.updateHandshakeBudgetLocked(true)
+	conn.Unlock()
+	if _, memory, _ := tr.HandshakeStats(); memory != sizeofHandshakeContext() {
+		t.Fatalf("acked ClientHello must not be counted, got memory=%d", memory)
+	}
+}
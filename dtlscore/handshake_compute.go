@@ -0,0 +1,202 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"crypto/ecdh"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/hrissan/dtls/ciphersuite"
+	"github.com/hrissan/dtls/dtlserrors"
+	"github.com/hrissan/dtls/handshake"
+	"github.com/hrissan/dtls/signature"
+)
+
+// Connection waiting for computation is in one of smIDHandshake*Calc* states, and does not deliver
+// received messages, they wait in the receive queue. Inputs are copied under connection lock,
+// computation is done without lock, and result is applied under lock, if connection still waits
+// for it (it could be closed or replaced while we computed).
+//
+// Post-handshake authentication (see post_handshake_auth.go) uses the same computations,
+// pending one is in the exchange, and messages wait in the exchange receive queue.
+//
+// Client computes ECDHE immediately, because handshake keys are needed to decrypt the rest of
+// server's flight, which is usually in the same datagram as ServerHello.
+
+type computeKind byte
+
+const (
+	computeNone                computeKind = iota
+	computeServerKeyShare      computeKind = iota // take key share from pool, then ECDHE with client's one
+	computeServerCertVerify    computeKind = iota // sign transcript
+	computeClientCertVerify    computeKind = iota // verify server's signature of transcript
+	computePostHandshakeSign   computeKind = iota // client signs transcript of post-handshake authentication
+	computePostHandshakeVerify computeKind = iota // server verifies client's signature
+)
+
+type computation struct {
+	kind computeKind
+	hctx *handshakeContext     // connection still waits for computation, if it has the same hctx
+	ex   *postHandshakeContext // or the same post-handshake authentication exchange
+
+	// inputs, slices point to received messages, which are not changed until handshake ends
+	peerKeyShare   [32]byte
+	transcriptHash ciphersuite.Hash
+	certData       []byte // peer's leaf certificate
+	signature      []byte // peer's certificate_verify
+
+	// outputs
+	x25519Secret         *ecdh.PrivateKey
+	sharedSecret         []byte
+	msgCertificateVerify handshake.Message
+	leaf                 *x509.Certificate
+	err                  error
+}
+
+// nil if connection has neither handshake nor post-handshake authentication exchange in progress
+func (conn *Connection) pendingComputationLocked() *computation {
+	if conn.hctx != nil {
+		return &conn.hctx.computation
+	}
+	if ex := conn.postHandshakeExchange(); ex != nil {
+		return &ex.computation
+	}
+	return nil
+}
+
+// in the state waiting for computation, computation with the same kind is set in hctx
+// (or in post-handshake authentication exchange)
+func (conn *Connection) startComputationLocked(opts *Options, c computation) error {
+	if hctx := conn.hctx; hctx != nil {
+		c.hctx = hctx
+		hctx.CanDeliveryMessages = false
+	} else {
+		c.ex = conn.postHandshakeExchange() // exchange does not deliver messages while computation is pending
+	}
+	*conn.pendingComputationLocked() = c
+	if opts.ComputeGoroutines == 0 { // reading goroutine computes
+		c.compute(opts, conn.tr.keyShares)
+		return conn.applyComputationLocked(opts, &c)
+	}
+	conn.tr.compute.addConnection(conn)
+	return nil
+}
+
+// called by compute pool goroutine
+func (conn *Connection) onCompute() {
+	opts := conn.tr.opts
+	conn.mu.Lock()
+	pending := conn.pendingComputationLocked()
+	if pending == nil || pending.kind == computeNone {
+		conn.mu.Unlock()
+		return // closed or replaced while in the queue
+	}
+	c := *pending
+	conn.mu.Unlock()
+
+	c.compute(opts, conn.tr.keyShares)
+
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.hctx != c.hctx || conn.postHandshakeExchange() != c.ex || conn.pendingComputationLocked().kind != c.kind {
+		return // closed or replaced while we computed
+	}
+	err := conn.applyComputationLocked(opts, &c)
+	if dtlserrors.IsFatal(err) {
+		fmt.Printf("fatal error, sending alert and closing connection: %v\n", err)
+		_ = conn.failLocked(err) // also registers connection in sender
+		return
+	}
+	if err != nil {
+		opts.Stats.Warning(conn.addr, err)
+	}
+	if conn.hasDataToSendLocked() {
+		conn.SignalWriteable()
+	}
+}
+
+// called without any locks
+func (c *computation) compute(opts *Options, keyShares *KeySharePool) {
+	switch c.kind {
+	case computeServerKeyShare:
+		c.x25519Secret = keyShares.take()
+		c.sharedSecret = computeSharedSecret(c.x25519Secret, c.peerKeyShare)
+	case computeServerCertVerify:
+		privateRsa := opts.ServerCertificate.PrivateKey.(*rsa.PrivateKey)
+		c.msgCertificateVerify, c.err = generateCertificateVerify(opts, true, privateRsa, c.transcriptHash)
+	case computeClientCertVerify:
+		_, c.err = verifyCertificateVerify(true, c.certData, c.signature, c.transcriptHash)
+	case computePostHandshakeSign:
+		privateRsa := opts.ClientCertificate.PrivateKey.(*rsa.PrivateKey)
+		c.msgCertificateVerify, c.err = generateCertificateVerify(opts, false, privateRsa, c.transcriptHash)
+	case computePostHandshakeVerify:
+		c.leaf, c.err = verifyCertificateVerify(false, c.certData, c.signature, c.transcriptHash)
+	default:
+		panic("unknown computation kind")
+	}
+}
+
+func (conn *Connection) applyComputationLocked(opts *Options, c *computation) error {
+	*conn.pendingComputationLocked() = computation{}
+	if c.kind == computePostHandshakeVerify { // failure is reported to handler
+		return conn.onPostHandshakeCertVerifyCheckedLocked(opts, c.ex, c.leaf, c.err)
+	}
+	if c.err != nil {
+		return c.err
+	}
+	switch c.kind {
+	case computeServerKeyShare:
+		return conn.onServerKeyShareComputedLocked(opts, c.x25519Secret, c.sharedSecret)
+	case computeServerCertVerify:
+		if err := conn.hctx.PushMessage(conn, c.msgCertificateVerify); err != nil {
+			return err
+		}
+		return conn.finishServerFlightLocked()
+	case computeClientCertVerify:
+		return conn.onServerCertVerifyCheckedLocked(opts)
+	case computePostHandshakeSign:
+		return conn.onPostHandshakeCertVerifyGeneratedLocked(opts, c.ex, c.msgCertificateVerify)
+	}
+	panic("unknown computation kind")
+}
+
+func generateKeyShare(opts *Options) *ecdh.PrivateKey {
+	var X25519Secret [32]byte
+	opts.Rnd.ReadMust(X25519Secret[:])
+	priv, err := ecdh.X25519().NewPrivateKey(X25519Secret[:])
+	if err != nil {
+		panic("curve25519.X25519 failed")
+	}
+	return priv
+}
+
+func computeSharedSecret(x25519Secret *ecdh.PrivateKey, peerKeyShare [32]byte) []byte {
+	remotePublic, err := ecdh.X25519().NewPublicKey(peerKeyShare[:])
+	if err != nil {
+		panic("curve25519.X25519 failed")
+	}
+	sharedSecret, err := x25519Secret.ECDH(remotePublic)
+	if err != nil {
+		panic("curve25519.X25519 failed")
+	}
+	return sharedSecret
+}
+
+// [rfc8446:4.4.3] - certificate verification, transcriptHash must contain all messages up to Certificate.
+// roleServer is role of the signer, returns parsed leaf certificate.
+func verifyCertificateVerify(roleServer bool, certData []byte, sig []byte, transcriptHash ciphersuite.Hash) (*x509.Certificate, error) {
+	sigMessageHash := signature.CalculateCoveredContentHash(sha256.New(), roleServer, transcriptHash.GetValue())
+
+	cert, err := x509.ParseCertificate(certData) // TODO - reuse certificates
+	if err != nil {
+		return nil, dtlserrors.ErrCertificateLoadError
+	}
+	if err := signature.VerifySignature_RSA_PSS_RSAE_SHA256(cert, sigMessageHash.GetValue(), sig); err != nil {
+		return nil, dtlserrors.ErrCertificateSignatureInvalid
+	}
+	return cert, nil
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"github.com/hrissan/dtls/record"
+)
+
+// [rfc9147:4] Header of ciphertext records we send. Receiver supports all formats anyway.
+type HeaderProfile int
+
+const (
+	// 16-bit sequence number (8-bit if Options.Use8BitSeq), every record has length
+	HeaderProfileDefault HeaderProfile = iota
+	// For constrained links (LoRa, 802.15.4). Last record in datagram has no length,
+	// and 8-bit sequence number is used while peer cannot confuse it (see canSend8BitSeqLocked).
+	HeaderProfileCompact
+)
+
+// [rfc9147:4.2.2] Peer reconstructs sequence number closest to the next one it expects,
+// which is after the highest record it acked. So 8-bit sequence number is unambiguous
+// while we are less than 128 records ahead. Application data is not acked, so after
+// 128 records in epoch we fall back to 16-bit, until KeyUpdate starts new epoch.
+func (conn *Connection) canSend8BitSeqLocked(sendEpoch uint16, nextSeq uint64) bool {
+	var peerNextSeq uint64
+	if conn.peerAckedRN != (record.Number{}) && conn.peerAckedRN.Epoch() == sendEpoch {
+		peerNextSeq = conn.peerAckedRN.SeqNum() + 1
+	}
+	return nextSeq < peerNextSeq+0x80
+}
+
+func (conn *Connection) updatePeerAckedLocked(rn record.Number) {
+	if conn.peerAckedRN.Less(rn) {
+		conn.peerAckedRN = rn
+	}
+}
+
+// including CID, last means record will be the last in datagram, so can have no length
+func (conn *Connection) recordHeaderSize(opts *Options, sendEpoch uint16, nextSeq uint64, last bool) int {
+	hdrSize := record.OutgoingCiphertextRecordHeader16
+	switch opts.HeaderProfile {
+	case HeaderProfileCompact:
+		if conn.canSend8BitSeqLocked(sendEpoch, nextSeq) {
+			hdrSize = record.OutgoingCiphertextRecordHeader8
+		}
+		if last {
+			hdrSize -= record.OutgoingCiphertextRecordLengthSize
+		}
+	default:
+		if opts.Use8BitSeq {
+			hdrSize = record.OutgoingCiphertextRecordHeader8
+		}
+	}
+	return hdrSize + int(conn.sendCIDLength) // widening
+}
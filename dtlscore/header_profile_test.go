@@ -0,0 +1,57 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"testing"
+
+	"github.com/hrissan/dtls/ciphersuite"
+	"github.com/hrissan/dtls/dtlsrand"
+	"github.com/hrissan/dtls/record"
+)
+
+func TestHeaderProfile_Compact(t *testing.T) {
+	opts := DefaultTransportOptions(false, dtlsrand.CryptoRand(), nil)
+	opts.HeaderProfile = HeaderProfileCompact
+	conn := &Connection{tr: NewTransport(opts, &statelessSender{}, nil)}
+	conn.keys.SuiteID = ciphersuite.TLS_AES_128_GCM_SHA256
+	var secret ciphersuite.Hash
+	secret.SetZero(32)
+	conn.keys.SendSymmetric = conn.keys.Suite().ResetSymmetricKeys(nil, secret, false)
+	conn.keys.SendEpoch = 3
+	conn.keys.SendNextSeq = 300
+
+	if hdrSize := conn.recordHeaderSize(opts, 3, conn.keys.SendNextSeq, false); hdrSize != record.OutgoingCiphertextRecordHeader16 {
+		t.Fatalf("peer acked nothing, 16-bit sequence number required, got header size %d", hdrSize)
+	}
+	conn.updatePeerAckedLocked(record.NumberWith(3, 200))
+	conn.updatePeerAckedLocked(record.NumberWith(3, 100)) // reordered ack
+	hdrSize := conn.recordHeaderSize(opts, 3, conn.keys.SendNextSeq, true)
+	if hdrSize != record.OutgoingCiphertextRecordHeader8-record.OutgoingCiphertextRecordLengthSize {
+		t.Fatalf("peer is close, 8-bit sequence number and no length expected, got header size %d", hdrSize)
+	}
+	if hdrSize := conn.recordHeaderSize(opts, 4, 0, false); hdrSize != record.OutgoingCiphertextRecordHeader8 {
+		t.Fatalf("new epoch starts from 0, 8-bit sequence number expected, got header size %d", hdrSize)
+	}
+
+	var datagram [64]byte
+	insideBody, ok := conn.prepareProtect(conn.keys.SendSymmetric, datagram[:], hdrSize, 0)
+	if !ok {
+		t.Fatalf("failed to prepare record")
+	}
+	recordSize, _, err := conn.protectRecord(conn.keys.SendSymmetric, conn.keys.SendEpoch, &conn.keys.SendNextSeq,
+		record.RecordTypeApplicationData, datagram[:], 0, hdrSize, copy(insideBody, "hello"))
+	if err != nil {
+		t.Fatalf("failed to protect: %v", err)
+	}
+	var hdr record.Encrypted
+	if n, err := hdr.Parse(datagram[:recordSize], 0); err != nil || n != recordSize || hdr.HasLength() || hdr.Has16BitSeqNum() {
+		t.Fatalf("failed to parse compact record: %v", err)
+	}
+	// peer expects 201, closest to 300 with 8-bit sequence number
+	body, seq, contentType, err := conn.deprotectWithKeysLocked(conn.keys.SendSymmetric, hdr, 201)
+	if err != nil || seq != 300 || contentType != record.RecordTypeApplicationData || string(body) != "hello" {
+		t.Fatalf("failed to deprotect compact record: %v", err)
+	}
+}
@@ -0,0 +1,32 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"net/netip"
+
+	"github.com/hrissan/dtls/ciphersuite"
+	"github.com/hrissan/dtls/dtlsrand"
+	"github.com/hrissan/dtls/transport/stats"
+)
+
+// Client connection after handshake, with epoch 3 keys, peer sent records up to seq 5.
+// There is no peer, sender and clock of transport are not running, tests call methods directly.
+func newEstablishedTestConnection(addr netip.AddrPort) (*Connection, *loopbackHandler) {
+	opts := DefaultTransportOptions(false, dtlsrand.CryptoRand(), stats.NewStatsLogVerbose())
+	handler := &loopbackHandler{handshakeDone: true}
+	conn := &Connection{tr: NewTransport(opts, &statelessSender{}, nil), handler: handler}
+	conn.keys.SuiteID = ciphersuite.TLS_AES_128_GCM_SHA256
+	var secret ciphersuite.Hash
+	secret.SetZero(32)
+	conn.keys.SendSymmetric = conn.keys.Suite().ResetSymmetricKeys(nil, secret, false)
+	conn.keys.SendEpoch = 3
+	conn.keys.ReceiveEpoch = 3
+	conn.keys.ReceiveNextSeq.SetNextReceived(6)
+	conn.nextMessageSeqSend = 2 // after handshake, 0 means KeyUpdate is not in progress
+	conn.stateID = smIDPostHandshake
+	conn.addr = addr
+	conn.tr.addToMap(conn, addr)
+	return conn, handler
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"fmt"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/hrissan/dtls/dtlserrors"
+	"github.com/hrissan/dtls/record"
+)
+
+// Without ICMP, handshake with peer which is not listening fails only after Options.HandshakeTimeout,
+// and established connection only after IdleTimeout or keepalive probes. Socket can report ICMP
+// port/host unreachable for datagram we sent to addr (Linux IP_RECVERR), so we can fail much faster.
+// ICMP is not authenticated, anyone who knows addresses can send it, and it can be caused by
+// transient routing problems, so it is only a hint (RFC 8899, RFC 9147). Both handshakes and
+// established connections fail only after repeated errors, with nothing authenticated received
+// from peer in between.
+
+// rate limit of one socket, receivers of different sockets do not contend
+type icmpLimiter struct {
+	mu     sync.Mutex
+	bucket tokenBucket
+	_      [64]byte // limiters of neighbour sockets in different cache lines
+}
+
+// err is socket error (for example, ECONNREFUSED), only for logging
+func (t *Transport) ReceivedICMPError(addr netip.AddrPort, err error) {
+	t.ReceivedICMPErrorShard(0, addr, err)
+}
+
+// for transports created with NewShardedTransport, shard is index of socket error was read from.
+func (t *Transport) ReceivedICMPErrorShard(shard int, addr netip.AddrPort, err error) {
+	now := time.Now().UnixNano()
+	limiter := &t.icmpLimiters[shard]
+	limiter.mu.Lock()
+	allow := limiter.bucket.allow(now, t.opts.MaxICMPErrorsPerSecond)
+	limiter.mu.Unlock()
+	if !allow {
+		return
+	}
+	conn := t.findConnection(addr)
+	if conn == nil {
+		return
+	}
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	conn.receivedICMPErrorLocked(t.opts, addr, now, err)
+}
+
+func (conn *Connection) receivedICMPErrorLocked(opts *Options, addr netip.AddrPort, now int64, err error) {
+	if conn.stateID == smIDClosed || conn.stateID == smIDShutdown || conn.addr != addr {
+		return // connection was reused or migrated while we did not hold lock
+	}
+	if opts.ICMPErrorsToClose == 0 {
+		return
+	}
+	// errors for datagrams sent in a burst (for example, handshake flight) count once
+	if conn.icmpErrors != 0 && now < conn.icmpErrorUnixNano+int64(conn.rtt.timeout()) {
+		return
+	}
+	conn.icmpErrorUnixNano = now
+	if conn.icmpErrors < 255 {
+		conn.icmpErrors++
+	}
+	if int(conn.icmpErrors) < opts.ICMPErrorsToClose { // widening
+		fmt.Printf("dtls: ICMP error %d of %d for %v: %v\n", conn.icmpErrors, opts.ICMPErrorsToClose, addr, err)
+		return
+	}
+	fmt.Printf("dtls: ICMP error for %v: %v, closing connection\n", addr, err)
+	// if ICMP was spoofed, alert tells peer we closed connection
+	alert := record.AlertCloseNormal()
+	_ = conn.shutdownLocked(alert, &dtlserrors.AlertError{Alert: alert, Err: dtlserrors.ErrPeerUnreachable})
+}
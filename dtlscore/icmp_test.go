@@ -0,0 +1,77 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"errors"
+	"net/netip"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hrissan/dtls/dtlserrors"
+)
+
+func TestICMP_EstablishedNeedsRepeatedErrors(t *testing.T) {
+	addr := netip.MustParseAddrPort("127.0.0.1:1")
+	conn, _ := newEstablishedTestConnection(addr)
+	opts := conn.tr.opts
+	opts.ICMPErrorsToClose = 2
+
+	now := time.Now().UnixNano()
+	conn.receivedICMPErrorLocked(opts, addr, now, syscall.ECONNREFUSED)
+	conn.receivedICMPErrorLocked(opts, addr, now+1, syscall.ECONNREFUSED)
+	if conn.stateID != smIDPostHandshake || conn.icmpErrors != 1 {
+		t.Fatalf("errors within retransmission timeout must count once")
+	}
+	conn.icmpErrors = 0 // authenticated record received
+	now += int64(conn.rtt.timeout())
+	conn.receivedICMPErrorLocked(opts, addr, now, syscall.ECONNREFUSED)
+	if conn.stateID != smIDPostHandshake {
+		t.Fatalf("authenticated record must reset error count")
+	}
+	conn.receivedICMPErrorLocked(opts, addr, now+int64(conn.rtt.timeout()), syscall.ECONNREFUSED)
+	if conn.stateID != smIDShutdown || !errors.Is(conn.closeErr, dtlserrors.ErrPeerUnreachable) {
+		t.Fatalf("connection must be closed after ICMPErrorsToClose errors")
+	}
+}
+
+func TestICMP_HandshakeNeedsRepeatedErrors(t *testing.T) {
+	addr := netip.MustParseAddrPort("127.0.0.1:1")
+	conn, _ := newEstablishedTestConnection(addr)
+	opts := conn.tr.opts
+	opts.ICMPErrorsToClose = 2
+	conn.hctx = &handshakeContext{}
+
+	now := time.Now().UnixNano()
+	conn.receivedICMPErrorLocked(opts, addr, now, syscall.ECONNREFUSED)
+	if conn.stateID != smIDPostHandshake || conn.icmpErrors != 1 {
+		t.Fatalf("single ICMP error must not fail handshake")
+	}
+	conn.receivedICMPErrorLocked(opts, addr, now+int64(conn.rtt.timeout()), syscall.ECONNREFUSED)
+	if conn.stateID != smIDShutdown || !errors.Is(conn.closeErr, dtlserrors.ErrPeerUnreachable) {
+		t.Fatalf("handshake must fail after ICMPErrorsToClose errors")
+	}
+}
+
+func TestICMP_RateLimitPerShard(t *testing.T) {
+	addr := netip.MustParseAddrPort("127.0.0.1:1")
+	conn, _ := newEstablishedTestConnection(addr)
+	opts := conn.tr.opts
+	opts.MaxICMPErrorsPerSecond = 1
+	opts.ICMPErrorsToClose = 1
+	tr := NewShardedTransport(opts, []Sender{&statelessSender{}, &statelessSender{}}, nil)
+	conn.tr = tr
+	tr.addToMap(conn, addr)
+
+	tr.ReceivedICMPErrorShard(0, netip.MustParseAddrPort("127.0.0.1:2"), syscall.ECONNREFUSED)
+	tr.ReceivedICMPErrorShard(0, addr, syscall.ECONNREFUSED)
+	if conn.stateID != smIDPostHandshake {
+		t.Fatalf("ICMP errors must be rate limited")
+	}
+	tr.ReceivedICMPErrorShard(1, addr, syscall.ECONNREFUSED)
+	if conn.stateID != smIDShutdown || !errors.Is(conn.closeErr, dtlserrors.ErrPeerUnreachable) {
+		t.Fatalf("each socket must have its own rate limit")
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hrissan/dtls/dtlserrors"
+)
+
+// Keepalive needs no state except flag, deadlines are calculated from lastReceiveUnixNano.
+// We send encrypted empty application data record at lastReceive + k*KeepaliveInterval for k in 1..KeepaliveMaxProbes,
+// and close connection at lastReceive + (KeepaliveMaxProbes+1)*KeepaliveInterval. Empty record does not
+// elicit response, so liveness is detected by any traffic from peer, including peer's own keepalives.
+// Empty records are not delivered to peer's application [rfc8446:5.4].
+
+func (conn *Connection) keepaliveEnabledLocked(opts *Options) bool {
+	return opts.KeepaliveInterval > 0 && conn.stateID == smIDPostHandshake && conn.lastReceiveUnixNano != 0
+}
+
+// 0 if keepalive is not enabled
+func (conn *Connection) keepaliveDeadlineLocked(opts *Options) int64 {
+	if !conn.keepaliveEnabledLocked(opts) {
+		return 0
+	}
+	interval := int64(opts.KeepaliveInterval)
+	elapsed := time.Now().UnixNano() - conn.lastReceiveUnixNano
+	periods := min(max(elapsed/interval+1, 1), int64(opts.KeepaliveMaxProbes)+1)
+	return conn.lastReceiveUnixNano + periods*interval
+}
+
+// returns true if connection was closed
+func (conn *Connection) onKeepaliveTimerLocked(opts *Options, now int64) bool {
+	if !conn.keepaliveEnabledLocked(opts) {
+		return false
+	}
+	interval := int64(opts.KeepaliveInterval)
+	elapsed := now - conn.lastReceiveUnixNano
+	if elapsed >= int64(opts.KeepaliveMaxProbes+1)*interval {
+		fmt.Printf("dtls: nothing received from peer %v after %d keepalives, closing connection\n", conn.addr, opts.KeepaliveMaxProbes)
+		conn.shutdownOnTimeoutLocked(dtlserrors.ErrKeepaliveTimeout)
+		return true
+	}
+	if elapsed < interval {
+		return false
+	}
+	conn.sendKeepalive = true // empty record is sent by constructDatagramLocked, unless datagram has other records
+	conn.SignalWriteable()
+	return false
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hrissan/dtls/dtlserrors"
+)
+
+// timer handler is called directly with lastReceiveUnixNano moved back, so no sleeps
+func TestKeepalive(t *testing.T) {
+	lb := newLoopback(t, func(clientOpts *Options, serverOpts *Options) {
+		serverOpts.KeepaliveInterval = time.Second
+		serverOpts.KeepaliveMaxProbes = 2
+		clientOpts.KeepaliveInterval = time.Minute // so client tracks lastReceiveUnixNano
+	})
+	lb.handshake()
+	server := lb.serverConn()
+	quietFor := func(d time.Duration) {
+		server.Lock()
+		server.lastReceiveUnixNano = time.Now().UnixNano() - int64(d)
+		if deadline := server.nextDeadlineLocked(server.tr.opts); deadline == 0 || deadline > server.lastReceiveUnixNano+int64(3*time.Second) {
+			t.Fatalf("keepalive deadline must be armed")
+		}
+		server.Unlock()
+		server.onTimer(nil)
+		lb.pump()
+	}
+	sendEpoch := server.keys.SendEpoch
+	before := time.Now().UnixNano()
+	quietFor(1500 * time.Millisecond)
+	if server.sendKeepalive || lb.clientConn.lastReceiveUnixNano < before {
+		t.Fatalf("keepalive must be sent after KeepaliveInterval")
+	}
+	if len(lb.clientHandler.received) != 0 || server.keys.SendEpoch != sendEpoch || server.keyUpdateInProgress() {
+		t.Fatalf("keepalive must be empty record, not delivered to application and not starting KeyUpdate")
+	}
+	quietFor(3500 * time.Millisecond)
+	if !lb.serverHandler.handler.disconnected || !errors.Is(lb.serverHandler.handler.disconnectErr, dtlserrors.ErrKeepaliveTimeout) {
+		t.Fatalf("connection must be closed after KeepaliveMaxProbes keepalives without traffic from peer, got %v",
+			lb.serverHandler.handler.disconnectErr)
+	}
+}
+
+func TestKeepalive_NotSentWithData(t *testing.T) {
+	lb := newLoopback(t, func(clientOpts *Options, serverOpts *Options) {
+		serverOpts.KeepaliveInterval = time.Second
+	})
+	lb.handshake()
+	server := lb.serverConn()
+	server.Lock()
+	server.sendKeepalive = true
+	server.Unlock()
+	lb.send(server, lb.serverHandler.handler, []byte("hello"))
+	lb.pump()
+	if server.sendKeepalive || len(lb.clientHandler.received) != 1 {
+		t.Fatalf("record with data must replace keepalive")
+	}
+}
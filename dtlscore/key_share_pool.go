@@ -0,0 +1,80 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"crypto/ecdh"
+	"runtime"
+	"sync"
+)
+
+// Generating ephemeral key pair allocates a lot, so we precompute up to Options.KeySharePoolSize
+// of them in background goroutine, and handshakes take them from pool. Each key pair is used exactly once.
+// If pool is empty (handshake flood, or refill goroutine not running), key pair is generated inline.
+type KeySharePool struct {
+	opts *Options
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	shutdown bool
+
+	keys []*ecdh.PrivateKey // stack, order does not matter
+}
+
+func NewKeySharePool(opts *Options) *KeySharePool {
+	ks := &KeySharePool{opts: opts}
+	ks.cond = sync.NewCond(&ks.mu)
+	if opts.Preallocate {
+		ks.keys = make([]*ecdh.PrivateKey, 0, opts.KeySharePoolSize)
+	}
+	return ks
+}
+
+func (ks *KeySharePool) Close() {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.shutdown = true
+	ks.keys = nil
+	ks.cond.Broadcast()
+}
+
+// blocks until Close() called, transport owner must run it, if Options.KeySharePoolSize != 0
+func (ks *KeySharePool) GoRun() {
+	ks.mu.Lock()
+	for {
+		for !ks.shutdown && len(ks.keys) >= ks.opts.KeySharePoolSize {
+			ks.cond.Wait()
+		}
+		if ks.shutdown {
+			ks.mu.Unlock()
+			return
+		}
+		ks.mu.Unlock()
+		priv := generateKeyShare(ks.opts)
+		// Go has no goroutine priorities, so we simply let others run before each next key
+		runtime.Gosched()
+		ks.mu.Lock()
+		if !ks.shutdown {
+			ks.keys = append(ks.keys, priv)
+		}
+	}
+}
+
+// never blocks on generation while holding lock
+func (ks *KeySharePool) take() *ecdh.PrivateKey {
+	ks.mu.Lock()
+	var priv *ecdh.PrivateKey
+	if n := len(ks.keys); n != 0 {
+		priv = ks.keys[n-1]
+		ks.keys[n-1] = nil
+		ks.keys = ks.keys[:n-1]
+		ks.cond.Signal()
+	}
+	ks.mu.Unlock()
+	ks.opts.Stats.KeySharePoolTake(priv != nil)
+	if priv == nil {
+		priv = generateKeyShare(ks.opts)
+	}
+	return priv
+}
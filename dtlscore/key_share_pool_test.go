@@ -0,0 +1,44 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hrissan/dtls/dtlsrand"
+	"github.com/hrissan/dtls/transport/stats"
+)
+
+func TestKeySharePool(t *testing.T) {
+	st := stats.NewStatsLogVerbose()
+	opts := DefaultTransportOptions(false, dtlsrand.CryptoRand(), st)
+	opts.KeySharePoolSize = 2
+	ks := NewKeySharePool(opts)
+	go ks.GoRun()
+	for i := 0; ; i++ {
+		ks.mu.Lock()
+		n := len(ks.keys)
+		ks.mu.Unlock()
+		if n == opts.KeySharePoolSize {
+			break
+		}
+		if i == 1000 {
+			t.Fatalf("pool was not filled")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	priv1 := ks.take()
+	priv2 := ks.take()
+	if priv1.Equal(priv2) {
+		t.Fatalf("each key share must be used once")
+	}
+	ks.Close()
+	if ks.take() == nil {
+		t.Fatalf("key share must be generated inline, when pool is empty")
+	}
+	if hits, misses := st.KeySharePoolCounters(); hits != 2 || misses != 1 {
+		t.Fatalf("wrong hit rate, got %d hits %d misses", hits, misses)
+	}
+}
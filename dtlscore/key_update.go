@@ -0,0 +1,55 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"time"
+
+	"github.com/hrissan/dtls/dtlserrors"
+)
+
+// [rfc9147:8] Starts KeyUpdate of our send keys. If updateRequested, peer will also update its send keys.
+// Does nothing if KeyUpdate is already in progress. KeyUpdate is also started automatically
+// when limits in Options are reached, so applications rarely need to call this.
+func (conn *Connection) RequestKeyUpdateLocked(updateRequested bool) error {
+	if conn.stateID != smIDPostHandshake {
+		return dtlserrors.ErrKeyUpdateNotPossible
+	}
+	if err := conn.keyUpdateStart(updateRequested); err != nil {
+		return err
+	}
+	conn.SignalWriteable()
+	return nil
+}
+
+// soft limit must leave room for KeyUpdate before hard limit is reached
+const minProtectionLimitForTests = 16
+
+// [rfc9147:4.5.3] limit for both send and receive keys, Options.ProtectionLimitForTests can lower it
+func (conn *Connection) sequenceNumberLimitLocked(opts *Options) uint64 {
+	limit := conn.keys.SequenceNumberLimit()
+	if opts.ProtectionLimitForTests != 0 {
+		return min(limit, opts.ProtectionLimitForTests)
+	}
+	return limit
+}
+
+// called when we start using new send keys in epoch 3+
+func (conn *Connection) startSendKeysUsageLocked() {
+	conn.sendKeysStartUnixNano = time.Now().UnixNano()
+	conn.sendKeysBytes = 0
+	conn.armTimerLocked() // for Options.KeyUpdateInterval
+}
+
+func (conn *Connection) sendKeysBytesExceededLocked(opts *Options) bool {
+	return opts.KeyUpdateBytes != 0 && conn.sendKeysBytes >= opts.KeyUpdateBytes
+}
+
+// 0 if KeyUpdate by time is not needed now
+func (conn *Connection) keyUpdateDeadlineLocked(opts *Options) int64 {
+	if opts.KeyUpdateInterval <= 0 || conn.stateID != smIDPostHandshake || conn.keyUpdateInProgress() {
+		return 0
+	}
+	return conn.sendKeysStartUnixNano + int64(opts.KeyUpdateInterval)
+}
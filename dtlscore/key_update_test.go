@@ -0,0 +1,101 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/hrissan/dtls/constants"
+	"github.com/hrissan/dtls/dtlserrors"
+)
+
+func TestKeyUpdate_Limits(t *testing.T) {
+	conn, _ := newEstablishedTestConnection(netip.MustParseAddrPort("127.0.0.1:1"))
+	sendLimit := conn.keys.SequenceNumberLimit()
+	if sendLimit != 1<<24 {
+		t.Fatalf("AES-GCM limit must be used, got %d", sendLimit)
+	}
+	conn.keys.SendNextSeq = constants.ProtectionSoftLimit(sendLimit) - 2
+	if _, err := conn.checkSendLimit(3, &conn.keys.SendNextSeq); err != nil || conn.keyUpdateInProgress() {
+		t.Fatalf("KeyUpdate must not start before soft limit")
+	}
+	if _, err := conn.checkSendLimit(3, &conn.keys.SendNextSeq); err != nil || !conn.keyUpdateInProgress() {
+		t.Fatalf("KeyUpdate must start at soft limit")
+	}
+	conn.keys.SendNextSeq = sendLimit
+	if _, err := conn.checkSendLimit(3, &conn.keys.SendNextSeq); !errors.Is(err, dtlserrors.ErrSendRecordSeqOverflow) {
+		t.Fatalf("hard limit must close connection, got %v", err)
+	}
+	conn.keys.FailedDeprotection = conn.keys.FailedDeprotectionLimit()
+	if err := conn.checkReceiveLimits(); !errors.Is(err, dtlserrors.ErrReceiveIntegrityLimit) {
+		t.Fatalf("integrity limit must close connection, got %v", err)
+	}
+}
+
+func TestKeyUpdate_Policy(t *testing.T) {
+	conn, _ := newEstablishedTestConnection(netip.MustParseAddrPort("127.0.0.1:1"))
+	opts := conn.tr.opts
+	opts.KeyUpdateBytes = 100
+	opts.KeyUpdateInterval = time.Hour
+
+	conn.startSendKeysUsageLocked()
+	if deadline := conn.keyUpdateDeadlineLocked(opts); deadline != conn.sendKeysStartUnixNano+int64(time.Hour) {
+		t.Fatalf("KeyUpdate deadline must be set by KeyUpdateInterval")
+	}
+	conn.sendKeysBytes = 99
+	if _, err := conn.checkSendLimit(3, &conn.keys.SendNextSeq); err != nil || conn.keyUpdateInProgress() {
+		t.Fatalf("KeyUpdate must not start before KeyUpdateBytes")
+	}
+	conn.sendKeysBytes = 100
+	if _, err := conn.checkSendLimit(3, &conn.keys.SendNextSeq); err != nil || !conn.keyUpdateInProgress() {
+		t.Fatalf("KeyUpdate must start after KeyUpdateBytes")
+	}
+	if conn.keyUpdateDeadlineLocked(opts) != 0 {
+		t.Fatalf("KeyUpdate deadline must not be set while KeyUpdate is in progress")
+	}
+	conn.stateID = smIDHandshakeClientExpectFinishedAck
+	if err := conn.RequestKeyUpdateLocked(true); !errors.Is(err, dtlserrors.ErrKeyUpdateNotPossible) {
+		t.Fatalf("KeyUpdate must not be possible before handshake finished, got %v", err)
+	}
+}
+
+func TestKeyUpdate_AutomaticByLimit(t *testing.T) {
+	lb := newLoopback(t, func(clientOpts *Options, serverOpts *Options) {
+		clientOpts.ProtectionLimitForTests = 40
+		serverOpts.ProtectionLimitForTests = 40
+	})
+	lb.handshake()
+	server := lb.serverConn()
+	var clientSent, serverSent [][]byte
+	for round := 0; round < 20; round++ {
+		for i := 0; i < 8; i++ { // peer must ack KeyUpdate before hard limit, so we send in portions
+			clientData := []byte(fmt.Sprintf("client %d %d", round, i))
+			serverData := []byte(fmt.Sprintf("server %d %d", round, i))
+			clientSent = append(clientSent, clientData)
+			serverSent = append(serverSent, serverData)
+			lb.send(&lb.clientConn, &lb.clientHandler, clientData)
+			lb.send(server, lb.serverHandler.handler, serverData)
+		}
+		lb.pump()
+	}
+	if lb.clientHandler.disconnected || lb.serverHandler.handler.disconnected {
+		t.Fatalf("connection must stay open, client error: %v server error: %v",
+			lb.clientHandler.disconnectErr, lb.serverHandler.handler.disconnectErr)
+	}
+	// 160 records and some acks with soft limit 30 require at least 5 KeyUpdates
+	if lb.clientConn.keys.SendEpoch < 3+5 || server.keys.SendEpoch < 3+5 {
+		t.Fatalf("KeyUpdate must happen automatically, client epoch %d server epoch %d",
+			lb.clientConn.keys.SendEpoch, server.keys.SendEpoch)
+	}
+	if !slices.EqualFunc(lb.serverHandler.handler.received, clientSent, bytes.Equal) ||
+		!slices.EqualFunc(lb.clientHandler.received, serverSent, bytes.Equal) {
+		t.Fatalf("all records must be delivered in order across KeyUpdates")
+	}
+}
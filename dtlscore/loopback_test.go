@@ -0,0 +1,256 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hrissan/dtls/constants"
+	"github.com/hrissan/dtls/dtlsrand"
+	"github.com/hrissan/dtls/transport/stats"
+)
+
+// In-memory client and server transports, datagrams are passed between them by pump,
+// so tests are deterministic. Clocks are not running, tests call timer handlers if needed.
+
+type loopbackHandler struct {
+	handshakeDone bool
+	toSend        [][]byte // records are split if they do not fit
+	received      [][]byte
+	authCalls     int
+	authInfo      ClientAuthenticationInfo
+	authErr       error
+	disconnected  bool
+	disconnectErr error
+}
+
+func (h *loopbackHandler) OnConnectLocked()                     {}
+func (h *loopbackHandler) OnHandshakeLocked(info HandshakeInfo) { h.handshakeDone = true }
+func (h *loopbackHandler) OnDisconnectLocked(err error) {
+	h.disconnected = true
+	h.disconnectErr = err
+}
+func (h *loopbackHandler) OnWriteRecordLocked(earlyData bool, recordBody []byte) (int, bool, bool, error) {
+	if earlyData || len(h.toSend) == 0 {
+		return 0, false, false, nil
+	}
+	n := copy(recordBody, h.toSend[0])
+	if h.toSend[0] = h.toSend[0][n:]; len(h.toSend[0]) == 0 {
+		h.toSend = h.toSend[1:]
+	}
+	return n, true, len(h.toSend) != 0, nil
+}
+func (h *loopbackHandler) OnReadRecordLocked(earlyData bool, recordBody []byte) error {
+	h.received = append(h.received, append([]byte(nil), recordBody...))
+	return nil
+}
+func (h *loopbackHandler) OnClientAuthenticationLocked(info ClientAuthenticationInfo, err error) {
+	h.authCalls++
+	h.authInfo = info
+	h.authErr = err
+}
+func (h *loopbackHandler) OnAddressChangedLocked(oldAddr netip.AddrPort, newAddr netip.AddrPort) {}
+func (h *loopbackHandler) OnPathMTUChangedLocked(pathMTU int)                                    {}
+
+type loopbackDatagram struct {
+	data []byte
+	addr netip.AddrPort
+}
+
+type loopbackSender struct {
+	conns []*Connection
+	hrr   []loopbackDatagram
+}
+
+func (s *loopbackSender) PopHelloRetryDatagramStorage() *[constants.MaxOutgoingHRRDatagramLength]byte {
+	return &[constants.MaxOutgoingHRRDatagramLength]byte{}
+}
+
+func (s *loopbackSender) SendHelloRetryDatagram(data *[constants.MaxOutgoingHRRDatagramLength]byte, size int, addr netip.AddrPort, localAddr netip.Addr) {
+	s.hrr = append(s.hrr, loopbackDatagram{data: data[:size], addr: addr})
+}
+
+func (s *loopbackSender) RegisterConnectionForSend(conn *Connection) {
+	if conn.SenderAddToQueue() {
+		s.conns = append(s.conns, conn)
+	}
+}
+
+func (s *loopbackSender) Shutdown() {}
+
+type loopbackServerHandler struct {
+	conn    *Connection
+	handler *loopbackHandler
+}
+
+func (h *loopbackServerHandler) OnNewConnection() (*Connection, ConnectionHandler) {
+	h.conn, h.handler = &Connection{}, &loopbackHandler{}
+	return h.conn, h.handler
+}
+
+type loopback struct {
+	t             testing.TB
+	client        *Transport
+	server        *Transport
+	clientSnd     *loopbackSender
+	serverSnd     *loopbackSender
+	clientAddr    netip.AddrPort
+	serverAddr    netip.AddrPort
+	clientConn    Connection
+	clientHandler loopbackHandler
+	serverHandler loopbackServerHandler
+	// if set, called for each datagram, returning true drops it
+	drop func(fromClient bool, datagram []byte) bool
+	// computations done by compute pools, if Options.ComputeGoroutines != 0
+	computed int
+}
+
+var loopbackCertOnce sync.Once
+var loopbackCert tls.Certificate
+
+func loopbackCertificate(t testing.TB) tls.Certificate {
+	loopbackCertOnce.Do(func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		now := time.Now()
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "loopback"},
+			NotBefore:    now.Add(-time.Hour),
+			NotAfter:     now.Add(24 * time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaf, _ := x509.ParseCertificate(der)
+		loopbackCert = tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+	})
+	return loopbackCert
+}
+
+// configure (if not nil) can change options before transports are created
+func newLoopback(t testing.TB, configure func(clientOpts *Options, serverOpts *Options)) *loopback {
+	newOpts := func(roleServer bool) *Options {
+		opts := DefaultTransportOptions(roleServer, dtlsrand.CryptoRand(), stats.NewStatsLogVerbose())
+		opts.Preallocate = false
+		opts.MaxConnections = 16
+		opts.ALPNContinueOnMismatch = true
+		return opts
+	}
+	clientOpts, serverOpts := newOpts(false), newOpts(true)
+	serverOpts.ServerCertificate = loopbackCertificate(t)
+	if configure != nil {
+		configure(clientOpts, serverOpts)
+	}
+	lb := &loopback{
+		t:          t,
+		clientSnd:  &loopbackSender{},
+		serverSnd:  &loopbackSender{},
+		clientAddr: netip.MustParseAddrPort("127.0.0.1:1"),
+		serverAddr: netip.MustParseAddrPort("127.0.0.1:2"),
+	}
+	lb.client = NewTransport(clientOpts, lb.clientSnd, nil)
+	lb.server = NewTransport(serverOpts, lb.serverSnd, &lb.serverHandler)
+	if err := lb.client.StartConnection(&lb.clientConn, &lb.clientHandler, lb.serverAddr); err != nil {
+		t.Fatalf("failed to start connection: %v", err)
+	}
+	return lb
+}
+
+// runs until there is nothing to send
+func (lb *loopback) pump() {
+	var datagram [65536]byte
+	for i := 0; ; i++ {
+		if i == 1000 {
+			lb.t.Fatalf("loopback pump does not settle")
+		}
+		sent := false
+		for _, side := range []struct {
+			fromClient bool
+			snd        *loopbackSender
+			from       netip.AddrPort
+			to         *Transport
+		}{{true, lb.clientSnd, lb.clientAddr, lb.server}, {false, lb.serverSnd, lb.serverAddr, lb.client}} {
+			for _, hrr := range side.snd.hrr {
+				lb.deliver(side.fromClient, hrr.data, side.from, side.to)
+				sent = true
+			}
+			side.snd.hrr = nil
+			conns := side.snd.conns
+			side.snd.conns = nil
+			for _, conn := range conns {
+				conn.SenderRemoveFromQueue()
+				_, _, size, add := conn.SenderConstructDatagram(datagram[:])
+				if size != 0 {
+					lb.deliver(side.fromClient, datagram[:size], side.from, side.to)
+					sent = true
+				}
+				if add {
+					side.snd.RegisterConnectionForSend(conn)
+				}
+			}
+		}
+		for _, tr := range []*Transport{lb.client, lb.server} {
+			for lb.compute(tr) {
+				sent = true
+			}
+		}
+		if !sent && len(lb.clientSnd.conns) == 0 && len(lb.serverSnd.conns) == 0 {
+			return
+		}
+	}
+}
+
+// does the work of compute pool goroutine, returns false if nothing to compute
+func (lb *loopback) compute(tr *Transport) bool {
+	cp := tr.ComputePool()
+	cp.mu.Lock()
+	if cp.queue.Len() == 0 {
+		cp.mu.Unlock()
+		return false
+	}
+	conn := cp.queue.PopFront()
+	conn.inComputeQueue = false
+	cp.mu.Unlock()
+	conn.onCompute()
+	lb.computed++
+	return true
+}
+
+func (lb *loopback) deliver(fromClient bool, datagram []byte, from netip.AddrPort, to *Transport) {
+	if lb.drop != nil && lb.drop(fromClient, datagram) {
+		return
+	}
+	to.ReceivedDatagram(append([]byte(nil), datagram...), from, nil)
+}
+
+// pumps until handshake finishes on both sides
+func (lb *loopback) handshake() {
+	lb.pump()
+	if !lb.clientHandler.handshakeDone || lb.serverHandler.handler == nil || !lb.serverHandler.handler.handshakeDone {
+		lb.t.Fatalf("handshake did not finish, client error: %v", lb.clientHandler.disconnectErr)
+	}
+}
+
+func (lb *loopback) serverConn() *Connection { return lb.serverHandler.conn }
+
+// queues record for sending by application of conn
+func (lb *loopback) send(conn *Connection, h *loopbackHandler, data []byte) {
+	conn.Lock()
+	defer conn.Unlock()
+	h.toSend = append(h.toSend, data)
+	conn.SignalWriteable()
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"github.com/hrissan/dtls/dtlserrors"
+	"github.com/hrissan/dtls/handshake"
+	"golang.org/x/crypto/ocsp"
+)
+
+type OCSPPolicy int
+
+const (
+	OCSPPolicyIgnore  OCSPPolicy = iota // do not request staple
+	OCSPPolicyPrefer                    // request staple, verify if sent, continue if not
+	OCSPPolicyRequire                   // request staple, fail handshake if not sent
+)
+
+// if server did not get fresh staple in time, we retry after this delay
+const ocspStapleRetryDelay = time.Minute
+
+// if responder did not set nextUpdate, newer information is always available [rfc6960:4.2.2.1]
+const ocspStapleDefaultRefresh = time.Hour
+
+func (t *Transport) ocspStaple() []byte {
+	if staple := t.staple.Load(); staple != nil {
+		return *staple
+	}
+	return nil
+}
+
+// Replaces staple sent in new handshakes, nil to stop sending.
+// Staple must not be modified after call.
+func (t *Transport) SetOCSPStaple(staple []byte) {
+	if len(staple) == 0 {
+		t.staple.Store(nil)
+		return
+	}
+	t.staple.Store(&staple)
+}
+
+// Calls Options.OCSPStapleRefresh, checks and stores the result. Returns when the next call
+// should be made, so application can run this in its own goroutine/timer. Previous staple
+// continues to be sent if refresh fails, until it expires on the clients.
+func (t *Transport) RefreshOCSPStaple() (nextRefresh time.Duration, err error) {
+	if t.opts.OCSPStapleRefresh == nil {
+		return 0, fmt.Errorf("OCSPStapleRefresh hook is not set")
+	}
+	staple, err := t.opts.OCSPStapleRefresh(&t.opts.ServerCertificate)
+	if err != nil {
+		return ocspStapleRetryDelay, err
+	}
+	resp, err := parseOCSPStaple(staple, t.opts.ServerCertificate.Certificate)
+	if err != nil {
+		return ocspStapleRetryDelay, err
+	}
+	if resp.Status != ocsp.Good {
+		// we continue sending it, so clients fail fast instead of trusting old staple
+		t.SetOCSPStaple(staple)
+		return ocspStapleDefaultRefresh, fmt.Errorf("OCSP response status is %d, not good", resp.Status)
+	}
+	t.SetOCSPStaple(staple)
+	now := time.Now()
+	if resp.NextUpdate.IsZero() {
+		return ocspStapleDefaultRefresh, nil
+	}
+	// refresh at the middle of validity interval, so we have time for retries
+	return max(resp.NextUpdate.Sub(now)/2, ocspStapleRetryDelay), nil
+}
+
+// chain is leaf first, signature is checked with issuer, which must be the next certificate
+func parseOCSPStaple(staple []byte, chain [][]byte) (*ocsp.Response, error) {
+	if len(chain) < 2 {
+		return nil, fmt.Errorf("OCSP response requires issuer certificate in the chain")
+	}
+	leaf, err := x509.ParseCertificate(chain[0])
+	if err != nil {
+		return nil, err
+	}
+	issuer, err := x509.ParseCertificate(chain[1])
+	if err != nil {
+		return nil, err
+	}
+	return ocsp.ParseResponseForCert(staple, leaf, issuer)
+}
+
+// [rfc8446:4.4.2.1] called on client after certificate signature is verified
+func verifyOCSPStaple(opts *Options, msg *handshake.MsgCertificate, now time.Time) error {
+	var ext handshake.ExtensionsSet
+	if msg.CertificatesLength != 0 {
+		if err := msg.Certificates[0].ParseExtensions(&ext); err != nil {
+			return dtlserrors.ErrOCSPStapleInvalid
+		}
+	}
+	if !ext.StatusRequestSet || len(ext.StatusRequest.OCSPResponse) == 0 {
+		if opts.OCSPPolicy == OCSPPolicyRequire {
+			return dtlserrors.ErrOCSPStapleRequired
+		}
+		return nil
+	}
+	if opts.OCSPPolicy == OCSPPolicyIgnore {
+		return dtlserrors.ErrOCSPStapleUnsolicited
+	}
+	var chain [2][]byte
+	n := min(msg.CertificatesLength, len(chain))
+	for i := range n {
+		chain[i] = msg.Certificates[i].CertData
+	}
+	resp, err := parseOCSPStaple(ext.StatusRequest.OCSPResponse, chain[:n])
+	if err != nil {
+		return dtlserrors.ErrOCSPStapleInvalid
+	}
+	if resp.Status != ocsp.Good {
+		return dtlserrors.ErrOCSPStapleRevoked
+	}
+	if now.Before(resp.ThisUpdate) || (!resp.NextUpdate.IsZero() && now.After(resp.NextUpdate)) {
+		return dtlserrors.ErrOCSPStapleExpired
+	}
+	return nil
+}
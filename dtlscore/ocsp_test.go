@@ -0,0 +1,126 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/hrissan/dtls/dtlserrors"
+	"github.com/hrissan/dtls/handshake"
+	"golang.org/x/crypto/ocsp"
+)
+
+type ocspFixture struct {
+	chain     [][]byte
+	issuer    *x509.Certificate
+	leaf      *x509.Certificate
+	issuerKey crypto.Signer
+}
+
+func newOCSPFixture(t *testing.T) *ocspFixture {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "test leaf"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, ca, &leafKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(leafDER)
+	return &ocspFixture{chain: [][]byte{leafDER, caDER}, issuer: ca, leaf: leaf, issuerKey: caKey}
+}
+
+// fake responder, issuer signs responses directly
+func (f *ocspFixture) respond(t *testing.T, status int, thisUpdate time.Time, nextUpdate time.Time) []byte {
+	staple, err := ocsp.CreateResponse(f.issuer, f.issuer, ocsp.Response{
+		Status:       status,
+		SerialNumber: f.leaf.SerialNumber,
+		ThisUpdate:   thisUpdate,
+		NextUpdate:   nextUpdate,
+		RevokedAt:    thisUpdate,
+	}, f.issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return staple
+}
+
+// simulates sending Certificate message from server and parsing on client
+func (f *ocspFixture) certificateMessage(t *testing.T, staple []byte) handshake.MsgCertificate {
+	msg := generateCertificate(nil, f.chain, staple)
+	var msgParsed handshake.MsgCertificate
+	if err := msgParsed.Parse(msg.Body); err != nil {
+		t.Fatal(err)
+	}
+	return msgParsed
+}
+
+func TestOCSPStaple_Verify(t *testing.T) {
+	f := newOCSPFixture(t)
+	now := time.Now()
+	good := f.respond(t, ocsp.Good, now.Add(-time.Minute), now.Add(time.Hour))
+	revoked := f.respond(t, ocsp.Revoked, now.Add(-time.Minute), now.Add(time.Hour))
+	expired := f.respond(t, ocsp.Good, now.Add(-2*time.Hour), now.Add(-time.Hour))
+
+	other := newOCSPFixture(t) // signed by unrelated issuer
+	foreign := other.respond(t, ocsp.Good, now.Add(-time.Minute), now.Add(time.Hour))
+
+	tests := []struct {
+		name   string
+		policy OCSPPolicy
+		staple []byte
+		want   error
+	}{
+		{"good_prefer", OCSPPolicyPrefer, good, nil},
+		{"good_require", OCSPPolicyRequire, good, nil},
+		{"missing_prefer", OCSPPolicyPrefer, nil, nil},
+		{"missing_ignore", OCSPPolicyIgnore, nil, nil},
+		{"missing_require", OCSPPolicyRequire, nil, dtlserrors.ErrOCSPStapleRequired},
+		{"unsolicited", OCSPPolicyIgnore, good, dtlserrors.ErrOCSPStapleUnsolicited},
+		{"revoked", OCSPPolicyPrefer, revoked, dtlserrors.ErrOCSPStapleRevoked},
+		{"expired", OCSPPolicyRequire, expired, dtlserrors.ErrOCSPStapleExpired},
+		{"foreign", OCSPPolicyPrefer, foreign, dtlserrors.ErrOCSPStapleInvalid},
+		{"garbage", OCSPPolicyPrefer, []byte{1, 2, 3}, dtlserrors.ErrOCSPStapleInvalid},
+	}
+	for _, tt := range tests {
+		msg := f.certificateMessage(t, tt.staple)
+		opts := &Options{OCSPPolicy: tt.policy}
+		if err := verifyOCSPStaple(opts, &msg, now); err != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -21,7 +21,7 @@ func (hctx *handshakeContext) receivedFullMessage(conn *Connection, msg handshak
 	case handshake.MsgTypeEncryptedExtensions:
 		var msgParsed handshake.ExtensionsSet
 		if err := msgParsed.Parse(msg.Body, false, false, true, false, nil); err != nil {
-			return dtlserrors.ErrExtensionsMessageParsing
+			return dtlserrors.ParsingError(err, dtlserrors.ErrExtensionsMessageParsing)
 		}
 		fmt.Printf("encrypted extensions parsed: %+v\n", msgParsed)
 		msg.AddToHash(hctx.transcriptHasher)
@@ -4,13 +4,18 @@
 package dtlscore
 
 import (
+	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
+	"math"
 	"time"
 
 	"github.com/hrissan/dtls/constants"
 	"github.com/hrissan/dtls/dtlsrand"
+	"github.com/hrissan/dtls/handshake"
+	"github.com/hrissan/dtls/record"
+	"github.com/hrissan/dtls/safecast"
 	"github.com/hrissan/dtls/transport/stats"
 )
 
@@ -27,18 +32,115 @@ type Options struct {
 	// socket delays are not used by DTLS core, they are here for convenience
 	SocketReadErrorDelay  time.Duration
 	SocketWriteErrorDelay time.Duration
+	// Datagrams read by one recvmmsg and written by one sendmmsg (Linux only), 0 or 1 disables batching.
+	// Batched receiver uses 64KB buffer per datagram, so SocketBatchSize*64KB per socket.
+	SocketBatchSize int
+	// UDP segmentation offload (Linux only, with batching), sender passes several same-size datagrams
+	// to the same peer in one message. Disabled if kernel does not support it, or first send fails.
+	SocketGSO bool
+	// UDP receive offload (Linux only, with batching), kernel coalesces datagrams from the same peer,
+	// and receiver splits them.
+	SocketGRO bool
+	// Sender serves stateless datagrams (HelloRetryRequest, stateless reset), connections in handshake
+	// and established connections in rounds, each class gets its weight of turns per round
+	// (unused turns go to other classes). Within class, connections are served by deficit round-robin,
+	// connection gets SenderQuantum bytes per turn, so one connection cannot starve others.
+	SenderWeightHelloRetry  int
+	SenderWeightHandshake   int
+	SenderWeightEstablished int
+	SenderQuantum           int
 
 	CookieValidDuration    time.Duration
 	MaxHelloRetryQueueSize int
-	MaxHandshakes          int // TODO - implement actual limit
-	MaxConnections         int
+	// Replies to ciphertext from unknown connections share HelloRetryRequest queue.
+	// 0 disables them, peers will have to wait for their timeouts.
+	MaxStatelessResetsPerSecond int
+	// ICMP errors (port or host unreachable) reported by socket (Linux only) for peer address.
+	// ICMP can be spoofed, so handshake or established connection is closed only after ICMPErrorsToClose
+	// errors at least one retransmission timeout apart, with nothing authenticated received from peer
+	// in between, 0 means ICMP is ignored. MaxICMPErrorsPerSecond is per socket, 0 disables ICMP handling.
+	MaxICMPErrorsPerSecond int
+	ICMPErrorsToClose      int
+	// Handshakes are limited both by number and by memory (sizeof(handshakeContext) plus messages
+	// we reassemble and not yet acked ones we send, in 1 KiB chunks). When either limit is reached, stalled handshakes are evicted to
+	// make room for new ones, and if there are no stalled handshakes, new ones are refused.
+	MaxHandshakes      int
+	MaxHandshakeMemory int
+	// Handshake which did not finish in this time is cancelled to free memory for new handshakes.
+	// 0 means no limit (not recommended, peer which disappears during handshake keeps its context forever).
+	HandshakeTimeout time.Duration
+	// Connection is closed if nothing authenticated received from peer for this duration after handshake.
+	// 0 means no limit.
+	IdleTimeout    time.Duration
+	MaxConnections int
+	// Connection is closed with dtlserrors.ErrRetransmitLimit if peer acknowledges nothing
+	// after that many retransmissions in a row (max 255). 0 means no limit.
+	MaxRetransmissions int
 
-	// Not fully implemented for now, used only during record parsing.
+	// Goroutines for handshake and post-handshake authentication computations (ECDHE, signing and verifying certificate_verify),
+	// transport owner must run ComputePool.GoRun() that many times (dtlsudp.GoRunUDPShards does),
+	// otherwise handshakes never finish. 0 (default) means computations are done by reading goroutine,
+	// which is simpler, but reading stops for the duration of each computation. Busy servers should
+	// set it, for example, to runtime.NumCPU().
+	ComputeGoroutines int
+	// Ephemeral key pairs precomputed by KeySharePool.GoRun(), which transport owner must run.
+	// 0 means key pairs are always generated when needed.
+	KeySharePoolSize int
+
+	// [rfc9146] negotiate connection_id extension, so records are routed by CID
+	// and connections survive peer address changes (NAT rebinding).
+	UseConnectionID bool
+	// Length of CIDs we generate for receiving, 0 means we do not need peer to send us CID
+	// (server should set it, client usually does not need it).
 	// We use fixed size connection ID, so we can parse ciphertext records easily [rfc9147:9.1]
 	CIDLength int
+	// Must fill cid (len(cid) == CIDLength) with new connection ID, for example encode server ID
+	// for load balancer. If nil, CID is random. Collisions with existing CIDs are retried.
+	CIDGenerator func(cid []byte)
+	// First byte of CIDs we generate is set to index of socket connection sticks to (see NewShardedTransport),
+	// so that datagrams can be steered to that socket by CID, even after peer address changes
+	// (see dtlsudp.AttachCIDSteeringBPF). Overwrites first byte set by CIDGenerator.
+	CIDSteering bool
 
 	// We have to support receiving them, so we also implemented sending them
 	Use8BitSeq bool
+	// Compact profile saves up to 3 bytes per datagram, see HeaderProfile
+	HeaderProfile HeaderProfile
+
+	// [draft-pismenny-tls-dtls-plaintext-sequence-number] negotiate sending record sequence numbers
+	// unencrypted, so AES keys need no separate sequence number context (half of AES memory per connection),
+	// and ChaCha20 keys do not store sequence number key.
+	// Only use if sequence numbers do not allow linking connections in your threat model.
+	PlaintextSequenceNumbers bool
+
+	// Encrypted empty record is sent when nothing is received from peer for KeepaliveInterval, and then
+	// every KeepaliveInterval, to keep NAT bindings. If nothing is received for KeepaliveInterval*(KeepaliveMaxProbes+1),
+	// peer is considered dead, and connection is closed with dtlserrors.ErrKeepaliveTimeout.
+	// Empty records are not acknowledged, so peer must send keepalives (or data) too.
+	// Peer's application sees nothing. 0 disables keepalive.
+	KeepaliveInterval  time.Duration
+	KeepaliveMaxProbes int
+
+	// [rfc9147:4.5.3] KeyUpdate is started when 3/4 of AEAD limit of send keys is used, and connection
+	// is closed if peer does not complete it before limit is reached. KeyUpdate can be started earlier,
+	// after send keys are used for KeyUpdateInterval or protected KeyUpdateBytes of plaintext, 0 means no limit.
+	KeyUpdateInterval time.Duration
+	KeyUpdateBytes    uint64
+	// For tests only, lowers AEAD limit of all suites, so automatic KeyUpdate and its soft and hard limits
+	// can be reached with few records. 0 means suite limit, otherwise must be at least 16.
+	ProtectionLimitForTests uint64
+
+	// [rfc8899] Datagrams are at most PMTUMin bytes, until path MTU discovery confirms larger size,
+	// up to PMTUMax. Probes are padded path_challenge records if rrc extension is negotiated (see UseConnectionID),
+	// otherwise padded KeyUpdate records. Search is repeated every PMTUProbeInterval, 0 means never.
+	PMTUMin           int
+	PMTUMax           int
+	PMTUProbeInterval time.Duration
+
+	// [rfc8449] Max size of protected record plaintext (including content type and padding)
+	// we are willing to receive. On client, 0 means extension is not sent.
+	// Server always responds to client's extension, using max allowed value if 0.
+	RecordSizeLimit int
 
 	// TODO - set priority
 	TLS_AES_128_GCM_SHA256       bool
@@ -47,6 +149,18 @@ type Options struct {
 
 	ServerCertificate tls.Certificate // some shortcut
 
+	// [rfc8446:4.4.2.1] On client, whether to request OCSP staple and how to treat its absence.
+	// On server, staple is sent if ServerCertificate.OCSPStaple is set initially or by refresh.
+	OCSPPolicy OCSPPolicy
+	// On server, called by Transport.RefreshOCSPStaple, must return fresh DER-encoded OCSP response
+	// for leaf certificate. Usually contacts OCSP responder, so is called without any locks held.
+	OCSPStapleRefresh func(cert *tls.Certificate) ([]byte, error)
+
+	// On client, send post_handshake_auth extension, so server can request ClientCertificate
+	// at any time after handshake. If ClientCertificate is not set, we respond with empty certificate.
+	PostHandshakeAuth bool
+	ClientCertificate tls.Certificate
+
 	// application-layer protocol negotiation
 	ALPN                   [][]byte
 	ALPNContinueOnMismatch bool
@@ -69,37 +183,82 @@ func DefaultTransportOptions(roleServer bool, rnd dtlsrand.Rand, stats stats.Sta
 		Preallocate:                  true,
 		SocketReadErrorDelay:         50 * time.Millisecond,
 		SocketWriteErrorDelay:        5 * time.Millisecond,
+		SocketBatchSize:              32,
+		SocketGSO:                    false,
+		SocketGRO:                    false,
+		SenderWeightHelloRetry:       1,
+		SenderWeightHandshake:        2,
+		SenderWeightEstablished:      4,
+		SenderQuantum:                4096,
 		CookieValidDuration:          120 * time.Second, // larger value for debug
 		MaxHelloRetryQueueSize:       1_000,
+		MaxStatelessResetsPerSecond:  100,
+		MaxICMPErrorsPerSecond:       100,
+		ICMPErrorsToClose:            3,
 		MaxHandshakes:                1000,
+		MaxHandshakeMemory:           16 << 20,
+		HandshakeTimeout:             60 * time.Second, // covers retransmissions 1+2+4+8+16+32 seconds
+		IdleTimeout:                  0,
 		MaxConnections:               100_000,
+		MaxRetransmissions:           10,
+		ComputeGoroutines:            0,
+		KeySharePoolSize:             256,
 		CIDLength:                    0,
 		Use8BitSeq:                   false,
+		HeaderProfile:                HeaderProfileDefault,
+		KeepaliveInterval:            0,
+		KeepaliveMaxProbes:           3,
+		KeyUpdateInterval:            0,
+		KeyUpdateBytes:               0,
+		ProtectionLimitForTests:      0,
+		PMTUMin:                      constants.MinimumPMTUv4,
+		PMTUMax:                      1500 - 8 - 20,    // ethernet, minus UDP header, minus IPv4 header
+		PMTUProbeInterval:            10 * time.Minute, // [rfc8899:5.1.1] PMTU_RAISE_TIMER
 		TLS_AES_128_GCM_SHA256:       true,
 		TLS_AES_256_GCM_SHA384:       false,
 		TLS_CHACHA20_POLY1305_SHA256: false,
 	}
 }
 
-func (opts *Options) LoadServerCertificate(certificatePath string, privateKeyPEMPath string) error {
+func loadCertificate(certificatePath string, privateKeyPEMPath string) (tls.Certificate, error) {
 	// TODO - this is the only dependency on "crypto/tls", if this stays, we might want to write this code manually
 	cert, err := tls.LoadX509KeyPair(certificatePath, privateKeyPEMPath)
 	if err != nil {
-		return fmt.Errorf("error loading x509 key pair: %w", err)
+		return tls.Certificate{}, fmt.Errorf("error loading x509 key pair: %w", err)
 	}
 	if len(cert.Certificate) == 0 {
-		return fmt.Errorf("loaded x509 pem file contains no certificates")
+		return tls.Certificate{}, fmt.Errorf("loaded x509 pem file contains no certificates")
 	}
 	if len(cert.Certificate) > constants.MaxCertificateChainLength {
-		return fmt.Errorf("loaded x509 pem file contains too many (%d) certificates, only %d are supported", len(cert.Certificate), constants.MaxCertificateChainLength)
+		return tls.Certificate{}, fmt.Errorf("loaded x509 pem file contains too many (%d) certificates, only %d are supported", len(cert.Certificate), constants.MaxCertificateChainLength)
+	}
+	if _, ok := cert.PrivateKey.(*rsa.PrivateKey); !ok {
+		return tls.Certificate{}, fmt.Errorf("only RSA private keys are supported for now")
 	}
 	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
-		return fmt.Errorf("error parsing leaf x509 certificate: %w", err)
+		return tls.Certificate{}, fmt.Errorf("error parsing leaf x509 certificate: %w", err)
+	}
+	return cert, nil
+}
+
+func (opts *Options) LoadServerCertificate(certificatePath string, privateKeyPEMPath string) error {
+	cert, err := loadCertificate(certificatePath, privateKeyPEMPath)
+	if err != nil {
+		return err
 	}
 	opts.ServerCertificate = cert
 	return nil
 }
 
+func (opts *Options) LoadClientCertificate(certificatePath string, privateKeyPEMPath string) error {
+	cert, err := loadCertificate(certificatePath, privateKeyPEMPath)
+	if err != nil {
+		return err
+	}
+	opts.ClientCertificate = cert
+	return nil
+}
+
 // TODO - actually call Validate(), and prevent change of options on the fly
 func (opts *Options) Validate() error {
 	if opts.RoleServer {
@@ -111,12 +270,72 @@ func (opts *Options) Validate() error {
 	if opts.MaxHelloRetryQueueSize < 1 {
 		return fmt.Errorf("MaxHelloRetryQueueSize (%d) should be at least 1", opts.MaxHelloRetryQueueSize)
 	}
+	if opts.RecordSizeLimit != 0 && (opts.RecordSizeLimit < handshake.MinRecordSizeLimit || opts.RecordSizeLimit > record.MaxPlaintextRecordLength+1) {
+		return fmt.Errorf("RecordSizeLimit (%d) should be 0 or between %d and %d", opts.RecordSizeLimit, handshake.MinRecordSizeLimit, record.MaxPlaintextRecordLength+1)
+	}
+	if opts.MaxHandshakes < 1 || opts.MaxHandshakeMemory < 1 {
+		return fmt.Errorf("MaxHandshakes (%d) and MaxHandshakeMemory (%d) should be at least 1", opts.MaxHandshakes, opts.MaxHandshakeMemory)
+	}
+	if opts.SocketBatchSize < 0 {
+		return fmt.Errorf("SocketBatchSize (%d) must not be negative", opts.SocketBatchSize)
+	}
+	if opts.ComputeGoroutines < 0 || opts.KeySharePoolSize < 0 {
+		return fmt.Errorf("ComputeGoroutines (%d) and KeySharePoolSize (%d) must not be negative", opts.ComputeGoroutines, opts.KeySharePoolSize)
+	}
+	if opts.CIDLength < 0 || opts.CIDLength > constants.MaxConnectionIDLength {
+		return fmt.Errorf("CIDLength (%d) should be between 0 and %d", opts.CIDLength, constants.MaxConnectionIDLength)
+	}
+	if opts.CIDSteering && opts.CIDLength == 0 {
+		return fmt.Errorf("CIDSteering requires CIDLength of at least 1")
+	}
+	if opts.HeaderProfile != HeaderProfileDefault && opts.HeaderProfile != HeaderProfileCompact {
+		return fmt.Errorf("HeaderProfile (%d) is unknown", opts.HeaderProfile)
+	}
+	if opts.PMTUMin < minPMTU || opts.PMTUMax < opts.PMTUMin || opts.PMTUMax > constants.MaxPMTU {
+		return fmt.Errorf("PMTUMin (%d) and PMTUMax (%d) should be between %d and %d, and PMTUMin <= PMTUMax", opts.PMTUMin, opts.PMTUMax, minPMTU, constants.MaxPMTU)
+	}
+	if opts.KeepaliveInterval < 0 || opts.KeepaliveMaxProbes < 0 {
+		return fmt.Errorf("KeepaliveInterval (%v) and KeepaliveMaxProbes (%d) must not be negative", opts.KeepaliveInterval, opts.KeepaliveMaxProbes)
+	}
+	if opts.SenderWeightHelloRetry < 1 || opts.SenderWeightHandshake < 1 || opts.SenderWeightEstablished < 1 {
+		return fmt.Errorf("SenderWeightHelloRetry (%d), SenderWeightHandshake (%d) and SenderWeightEstablished (%d) must be at least 1",
+			opts.SenderWeightHelloRetry, opts.SenderWeightHandshake, opts.SenderWeightEstablished)
+	}
+	if opts.SenderQuantum < 1 {
+		return fmt.Errorf("SenderQuantum (%d) must be at least 1", opts.SenderQuantum)
+	}
+	if opts.MaxICMPErrorsPerSecond < 0 || opts.ICMPErrorsToClose < 0 {
+		return fmt.Errorf("MaxICMPErrorsPerSecond (%d) and ICMPErrorsToClose (%d) must not be negative", opts.MaxICMPErrorsPerSecond, opts.ICMPErrorsToClose)
+	}
+	if opts.KeyUpdateInterval < 0 {
+		return fmt.Errorf("KeyUpdateInterval (%v) must not be negative", opts.KeyUpdateInterval)
+	}
+	if opts.ProtectionLimitForTests != 0 && opts.ProtectionLimitForTests < minProtectionLimitForTests {
+		return fmt.Errorf("ProtectionLimitForTests (%d) should be 0 or at least %d", opts.ProtectionLimitForTests, minProtectionLimitForTests)
+	}
+	if opts.PMTUProbeInterval < 0 {
+		return fmt.Errorf("PMTUProbeInterval (%v) must not be negative", opts.PMTUProbeInterval)
+	}
+	if opts.HandshakeTimeout < 0 || opts.IdleTimeout < 0 {
+		return fmt.Errorf("HandshakeTimeout (%v) and IdleTimeout (%v) must not be negative", opts.HandshakeTimeout, opts.IdleTimeout)
+	}
+	if opts.MaxRetransmissions < 0 || opts.MaxRetransmissions > math.MaxUint8 {
+		return fmt.Errorf("MaxRetransmissions (%d) should be between 0 and %d", opts.MaxRetransmissions, math.MaxUint8)
+	}
 	if opts.CookieValidDuration < time.Second {
 		return fmt.Errorf("CookieValidDuration (%v) should be at least %v", opts.CookieValidDuration, time.Second)
 	}
 	return nil
 }
 
+// value we send in record_size_limit extension
+func (opts *Options) recordSizeLimit() uint16 {
+	if opts.RecordSizeLimit == 0 {
+		return record.MaxPlaintextRecordLength + 1
+	}
+	return safecast.Cast[uint16](opts.RecordSizeLimit)
+}
+
 func (opts *Options) FindALPN(protocols [][]byte) (int, []byte) {
 	for _, p := range protocols {
 		for i, n := range opts.ALPN {
@@ -0,0 +1,220 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/hrissan/dtls/dtlserrors"
+	"github.com/hrissan/dtls/record"
+)
+
+// [draft-ietf-tls-dtls-rrc] Authenticated record with our CID from new address does not prove
+// peer is there, attacker can forward (or race) records to redirect our traffic to victim.
+// So we send path_challenge to new address, and move connection there only when path_response
+// with the same cookie arrives from it. Until then, we send everything else to the old address.
+//
+// Not more than pathAmplificationFactor times bytes received from unvalidated address is sent to it.
+// Validation state is allocated only while migration or our response to peer's challenge is in progress.
+// Out of scope: enhanced path validation (path_challenge to the old address too, and path_drop
+// to the new one if old address responds) is not implemented, so we never send path_drop.
+
+const pathAmplificationFactor = 3
+const maxPathChallenges = 3
+
+type pathValidation struct {
+	// our challenge, addr is not valid if no validation in progress
+	addr             netip.AddrPort
+	localAddr        netip.Addr // peer sent to it from addr, becomes conn.localAddr after migration
+	cookie           [8]byte
+	sendChallenge    bool
+	challengesSent   int
+	deadlineUnixNano int64 // 0 if not waiting for path_response
+	bytesReceived    int   // from addr, for anti-amplification
+	bytesSent        int   // to addr
+
+	// our response to peer's challenge goes to address challenge came from
+	sendResponse      bool
+	responseAddr      netip.AddrPort
+	responseLocalAddr netip.Addr
+	responseCookie    [8]byte
+}
+
+func (conn *Connection) hasPathDataToSendLocked() bool {
+	pv := conn.pathValidation
+	return conn.pmtu.sendProbe || (pv != nil && (pv.sendChallenge || pv.sendResponse))
+}
+
+func (conn *Connection) pathDeadlineLocked() int64 {
+	if conn.pathValidation == nil {
+		return 0
+	}
+	return conn.pathValidation.deadlineUnixNano
+}
+
+func (conn *Connection) releasePathValidationIfIdleLocked() {
+	pv := conn.pathValidation
+	if pv != nil && !pv.sendResponse && !pv.addr.IsValid() {
+		conn.pathValidation = nil // TODO - reuse into pool
+	}
+}
+
+func (conn *Connection) clearPathChallengeLocked() {
+	pv := conn.pathValidation
+	pv.addr = netip.AddrPort{}
+	pv.localAddr = netip.Addr{}
+	pv.cookie = [8]byte{}
+	pv.sendChallenge = false
+	pv.challengesSent = 0
+	pv.deadlineUnixNano = 0
+	pv.bytesReceived = 0
+	pv.bytesSent = 0
+	conn.releasePathValidationIfIdleLocked()
+}
+
+// [rfc9146:6] peer address can change only by authenticated record,
+// newer than any record received before, and arrived with our CID.
+func (conn *Connection) migrateLocked(opts *Options, addr netip.AddrPort, localAddr netip.Addr, rn record.Number, recordSize int) {
+	if addr == conn.addr || conn.stateID != smIDPostHandshake {
+		return
+	}
+	if pv := conn.pathValidation; pv != nil && pv.addr == addr {
+		pv.bytesReceived += recordSize
+		return
+	}
+	if !conn.isNewestReceivedLocked(rn) {
+		return
+	}
+	if !conn.rrcNegotiated {
+		opts.Stats.Warning(addr, dtlserrors.WarnMigrationNotValidated)
+		return
+	}
+	if conn.pathValidation == nil {
+		conn.pathValidation = &pathValidation{} // TODO - take from pool
+	}
+	pv := conn.pathValidation // previous candidate (if any) is forgotten
+	pv.addr = addr
+	pv.localAddr = localAddr
+	opts.Rnd.ReadMust(pv.cookie[:])
+	pv.sendChallenge = true
+	pv.challengesSent = 0
+	pv.deadlineUnixNano = 0
+	pv.bytesReceived = recordSize
+	pv.bytesSent = 0
+	fmt.Printf("dtls: peer %v appeared at %v, validating new address\n", conn.addr, addr)
+	conn.SignalWriteable()
+}
+
+func (conn *Connection) receivedRRCLocked(opts *Options, recordBody []byte, addr netip.AddrPort, localAddr netip.Addr) error {
+	if !conn.rrcNegotiated {
+		return dtlserrors.ErrRRCNotNegotiated
+	}
+	var msg record.RRC
+	if err := msg.Parse(recordBody); err != nil {
+		return dtlserrors.ErrRRCMessageParsing
+	}
+	fmt.Printf("dtls: got return_routability_check %d from %v\n", msg.MsgType, addr)
+	switch msg.MsgType {
+	case record.RRCPathChallenge:
+		if conn.pathValidation == nil {
+			conn.pathValidation = &pathValidation{} // TODO - take from pool
+		}
+		pv := conn.pathValidation // we respond only to the latest challenge
+		pv.sendResponse = true
+		pv.responseAddr = addr
+		pv.responseLocalAddr = localAddr
+		pv.responseCookie = msg.Cookie
+		conn.SignalWriteable()
+	case record.RRCPathResponse:
+		if conn.receivedPMTUProbeResponseLocked(opts, msg.Cookie, addr == conn.addr) {
+			return nil
+		}
+		pv := conn.pathValidation
+		if pv == nil || pv.addr != addr || pv.challengesSent == 0 || pv.cookie != msg.Cookie {
+			opts.Stats.Warning(addr, dtlserrors.WarnPathResponseMismatch)
+			return nil
+		}
+		newLocalAddr := pv.localAddr
+		conn.clearPathChallengeLocked()
+		if !conn.tr.moveInMap(conn, conn.addr, addr) {
+			opts.Stats.Warning(addr, dtlserrors.WarnMigrationAddressInUse)
+			return nil
+		}
+		oldAddr := conn.addr
+		conn.addr = addr
+		conn.localAddr = newLocalAddr
+		fmt.Printf("dtls: connection migrated from %v to %v\n", oldAddr, addr)
+		conn.handler.OnAddressChangedLocked(oldAddr, addr)
+		conn.resetPMTULocked(opts)
+	case record.RRCPathDrop:
+		// out of scope (see above), we do not use peer's paths other than conn.addr and the one
+		// being validated, so there is nothing to drop, message is accepted and ignored
+	}
+	return nil
+}
+
+// path messages are sent in separate datagrams, because destination is not conn.addr,
+// or because datagram is path MTU probe (see pmtu.go).
+// returns 0 if nothing to send, then normal datagram should be constructed.
+func (conn *Connection) constructPathDatagramLocked(opts *Options, datagram []byte) (netip.AddrPort, netip.Addr, int, error) {
+	if conn.keys.SendSymmetric == nil || conn.stateID == smIDShutdown {
+		return netip.AddrPort{}, netip.Addr{}, 0, nil
+	}
+	if probeSize, err := conn.constructPMTUProbeLocked(opts, datagram); probeSize != 0 || err != nil {
+		return conn.addr, conn.localAddr, probeSize, err
+	}
+	pv := conn.pathValidation
+	if pv == nil {
+		return netip.AddrPort{}, netip.Addr{}, 0, nil
+	}
+	datagram = datagram[:min(len(datagram), conn.pathMTULocked(opts))]
+	if pv.sendResponse {
+		pv.sendResponse = false
+		addr, localAddr := pv.responseAddr, pv.responseLocalAddr
+		recordSize, err := conn.constructRRCRecord(opts, datagram, record.RRC{MsgType: record.RRCPathResponse, Cookie: pv.responseCookie}, 0)
+		conn.releasePathValidationIfIdleLocked()
+		return addr, localAddr, recordSize, err
+	}
+	if pv.sendChallenge {
+		pv.sendChallenge = false
+		pv.challengesSent++
+		pv.deadlineUnixNano = time.Now().UnixNano() + int64(conn.rtt.timeout()<<(pv.challengesSent-1))
+		conn.armTimerLocked()
+		// if budget is exhausted, record does not fit and we simply wait for the next attempt
+		budget := max(0, pathAmplificationFactor*pv.bytesReceived-pv.bytesSent)
+		recordSize, err := conn.constructRRCRecord(opts, datagram[:min(len(datagram), budget)],
+			record.RRC{MsgType: record.RRCPathChallenge, Cookie: pv.cookie}, 0)
+		pv.bytesSent += recordSize
+		return pv.addr, pv.localAddr, recordSize, err
+	}
+	return netip.AddrPort{}, netip.Addr{}, 0, nil
+}
+
+func (conn *Connection) constructRRCRecord(opts *Options, datagramLeft []byte, msg record.RRC, padding int) (int, error) {
+	hdrSize := conn.recordHeaderSize(opts, conn.keys.SendEpoch, conn.keys.SendNextSeq, true) // alone in datagram
+	insideBody, ok := conn.prepareProtect(conn.keys.SendSymmetric, datagramLeft, hdrSize, padding)
+	if !ok || len(insideBody) < record.RRCSize {
+		return 0, nil
+	}
+	_ = msg.Write(insideBody[:0])
+	recordSize, _, err := conn.protectRecord(conn.keys.SendSymmetric, conn.keys.SendEpoch, &conn.keys.SendNextSeq,
+		record.RecordTypeReturnRoutabilityCheck, datagramLeft, padding, hdrSize, record.RRCSize)
+	return recordSize, err
+}
+
+// called from onTimer when path_response did not arrive in time
+func (conn *Connection) onPathTimerLocked(opts *Options) {
+	pv := conn.pathValidation
+	pv.deadlineUnixNano = 0
+	if pv.challengesSent < maxPathChallenges {
+		pv.sendChallenge = true
+		conn.SignalWriteable()
+		return
+	}
+	fmt.Printf("dtls: peer %v did not respond from %v, not migrating\n", conn.addr, pv.addr)
+	opts.Stats.Warning(pv.addr, dtlserrors.WarnMigrationNotValidated)
+	conn.clearPathChallengeLocked()
+}
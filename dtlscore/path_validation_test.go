@@ -0,0 +1,103 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/hrissan/dtls/record"
+)
+
+type migrationHandler struct {
+	disconnectHandler
+	moved []netip.AddrPort
+}
+
+func (h *migrationHandler) OnAddressChangedLocked(oldAddr netip.AddrPort, newAddr netip.AddrPort) {
+	h.moved = append(h.moved, oldAddr, newAddr)
+}
+
+// peer supports RRC, so migration is validated with path_challenge
+func newMigrationTestConnection(addr netip.AddrPort) (*Connection, *migrationHandler) {
+	conn, _ := newEstablishedTestConnection(addr)
+	handler := &migrationHandler{}
+	conn.handler = handler
+	conn.rrcNegotiated = true
+	return conn, handler
+}
+
+func TestPathValidation_Migrate(t *testing.T) {
+	oldAddr := netip.MustParseAddrPort("127.0.0.1:1")
+	newAddr := netip.MustParseAddrPort("127.0.0.1:2")
+	conn, handler := newMigrationTestConnection(oldAddr)
+	opts := conn.tr.opts
+
+	conn.migrateLocked(opts, newAddr, netip.Addr{}, record.NumberWith(3, 4), 20)
+	if conn.pathValidation != nil {
+		t.Fatalf("old record must not start migration")
+	}
+	newLocalAddr := netip.MustParseAddr("10.0.0.1")
+	conn.migrateLocked(opts, newAddr, newLocalAddr, record.NumberWith(3, 5), 20)
+	if conn.pathValidation == nil || conn.addr != oldAddr {
+		t.Fatalf("newest record must start validation, but not migration")
+	}
+	var datagram [1500]byte
+	addr, localAddr, datagramSize, _ := conn.constructDatagram(opts, datagram[:])
+	if addr != newAddr || localAddr != newLocalAddr || datagramSize == 0 || datagramSize > pathAmplificationFactor*20 {
+		t.Fatalf("path_challenge must be sent to the new address from local address it arrived to, got %v %v size %d", addr, localAddr, datagramSize)
+	}
+	wrong := record.RRC{MsgType: record.RRCPathResponse, Cookie: conn.pathValidation.cookie}
+	wrong.Cookie[0]++
+	_ = conn.receivedRRCLocked(opts, wrong.Write(nil), newAddr, netip.Addr{})
+	response := record.RRC{MsgType: record.RRCPathResponse, Cookie: conn.pathValidation.cookie}
+	_ = conn.receivedRRCLocked(opts, response.Write(nil), oldAddr, netip.Addr{})
+	if conn.addr != oldAddr || len(handler.moved) != 0 {
+		t.Fatalf("mismatched path_response must be ignored")
+	}
+	if err := conn.receivedRRCLocked(opts, response.Write(nil), newAddr, netip.Addr{}); err != nil {
+		t.Fatalf("failed to process path_response: %v", err)
+	}
+	if conn.addr != newAddr || conn.localAddr != newLocalAddr || len(handler.moved) != 2 || handler.moved[1] != newAddr || conn.pathValidation != nil {
+		t.Fatalf("connection must migrate after path_response")
+	}
+	if conn.tr.findConnection(newAddr) != conn || conn.tr.findConnection(oldAddr) != nil {
+		t.Fatalf("connection must be moved in the map")
+	}
+}
+
+func TestPathValidation_AmplificationLimit(t *testing.T) {
+	oldAddr := netip.MustParseAddrPort("127.0.0.1:1")
+	newAddr := netip.MustParseAddrPort("127.0.0.1:2")
+	conn, _ := newMigrationTestConnection(oldAddr)
+	opts := conn.tr.opts
+
+	conn.migrateLocked(opts, newAddr, netip.Addr{}, record.NumberWith(3, 5), 5)
+	var datagram [1500]byte
+	addr, _, _, _ := conn.constructDatagram(opts, datagram[:])
+	if addr != oldAddr || conn.pathValidation.bytesSent != 0 || conn.pathValidation.challengesSent != 1 {
+		t.Fatalf("path_challenge must not exceed amplification limit")
+	}
+}
+
+func TestPathValidation_RespondToChallenge(t *testing.T) {
+	oldAddr := netip.MustParseAddrPort("127.0.0.1:1")
+	challengeAddr := netip.MustParseAddrPort("127.0.0.1:3")
+	conn, _ := newMigrationTestConnection(oldAddr)
+	opts := conn.tr.opts
+
+	challenge := record.RRC{MsgType: record.RRCPathChallenge, Cookie: [8]byte{1, 2, 3}}
+	if err := conn.receivedRRCLocked(opts, challenge.Write(nil), challengeAddr, netip.Addr{}); err != nil {
+		t.Fatalf("failed to process path_challenge: %v", err)
+	}
+	var datagram [1500]byte
+	addr, _, datagramSize, _ := conn.constructDatagram(opts, datagram[:])
+	if addr != challengeAddr || datagramSize == 0 || conn.pathValidation != nil {
+		t.Fatalf("path_response must be sent to address of challenge")
+	}
+	conn.rrcNegotiated = false
+	if err := conn.receivedRRCLocked(opts, challenge.Write(nil), challengeAddr, netip.Addr{}); err == nil {
+		t.Fatalf("return_routability_check must be rejected if not negotiated")
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hrissan/dtls/handshake"
+	"github.com/hrissan/dtls/record"
+)
+
+// [rfc8899] Packetization layer path MTU discovery. Until larger size is confirmed, we send datagrams
+// of at most Options.PMTUMin bytes. After handshake, we send probe datagram consisting of single
+// path_challenge record [draft-ietf-tls-dtls-rrc] padded to probe size, and peer's path_response
+// confirms probe arrived. If rrc extension is not negotiated, probe is KeyUpdate(update_not_requested)
+// [rfc9147:8] record padded to probe size, and peer's ack for that record confirms probe arrived.
+// If such probe is lost, KeyUpdate is retransmitted (unpadded) as usual.
+//
+// First probe is Options.PMTUMax, then binary search between confirmed and failed sizes.
+// When search is done, we repeat it after Options.PMTUProbeInterval, because path can change.
+// TODO - [rfc8899:4.3] black hole detection, when datagrams of confirmed size start being lost
+
+const minPMTU = 256              // for constrained links, handshake is fragmented heavily anyway
+const maxPMTUProbes = 3          // [rfc8899:5.1.2] MAX_PROBES
+const pmtuSearchGranularity = 16 // search is done when confirmed and failed sizes are that close
+
+type pmtuDiscovery struct {
+	size             uint16 // confirmed, 0 means Options.PMTUMin
+	probeSize        uint16 // 0 if search is not in progress
+	failedSize       uint16 // smallest size probe of which was lost, 0 if none
+	probesSent       uint8  // of probeSize
+	sendProbe        bool
+	cookie           [8]byte       // of probeSize, path_response must contain the same
+	probeRN          record.Number // of the last KeyUpdate probe, if rrc is not negotiated
+	deadlineUnixNano int64         // probe timeout while searching, raise timer after search, 0 if not set
+}
+
+// Max datagram size we send to peer, application data records are sized to fit.
+func (conn *Connection) PathMTULocked() int {
+	return conn.pathMTULocked(conn.tr.opts)
+}
+
+func (conn *Connection) pathMTULocked(opts *Options) int {
+	if conn.pmtu.size == 0 {
+		return opts.PMTUMin
+	}
+	return int(conn.pmtu.size) // widening
+}
+
+// called when handshake finishes and when raise timer fires
+func (conn *Connection) startPMTUSearchLocked(opts *Options) {
+	conn.pmtu.failedSize = 0
+	conn.nextPMTUProbeLocked(opts)
+}
+
+// after migration old path MTU means nothing
+func (conn *Connection) resetPMTULocked(opts *Options) {
+	if conn.pmtu.size != 0 {
+		conn.pmtu.size = 0
+		conn.handler.OnPathMTUChangedLocked(opts.PMTUMin)
+	}
+	conn.startPMTUSearchLocked(opts)
+}
+
+func (conn *Connection) nextPMTUProbeLocked(opts *Options) {
+	p := &conn.pmtu
+	p.probeSize = 0
+	p.probesSent = 0
+	p.sendProbe = false
+	p.deadlineUnixNano = 0
+	p.probeRN = record.Number{}
+	if !conn.rrcNegotiated && !conn.peerFinishedHandshakeLocked() {
+		p.deadlineUnixNano = time.Now().UnixNano() + int64(conn.rtt.timeout()) // try again later
+		return
+	}
+	low := conn.pathMTULocked(opts)
+	switch {
+	case p.failedSize == 0 && low < opts.PMTUMax:
+		p.probeSize = uint16(opts.PMTUMax) // truncation, checked in Options.Validate
+	case p.failedSize != 0 && int(p.failedSize)-low > pmtuSearchGranularity: // widening
+		p.probeSize = uint16(low + (int(p.failedSize)-low)/2) // truncation, widening
+	default:
+		fmt.Printf("dtls: path MTU to %v is %d\n", conn.addr, low)
+		if opts.PMTUProbeInterval > 0 {
+			p.deadlineUnixNano = time.Now().UnixNano() + int64(opts.PMTUProbeInterval)
+		}
+		return
+	}
+	opts.Rnd.ReadMust(p.cookie[:])
+	p.sendProbe = true
+	conn.SignalWriteable()
+}
+
+// KeyUpdate probe must not arrive while peer still waits for ack of its Finished, so
+// we wait until peer sends something with epoch 3 keys.
+func (conn *Connection) peerFinishedHandshakeLocked() bool {
+	if conn.keys.ReceiveEpoch < 3 {
+		return false
+	}
+	return !conn.keys.NewReceiveKeysSet || conn.keys.ReceiveEpoch > 3 || conn.keys.NewReceiveNextSeq.GetNextReceivedSeq() != 0
+}
+
+// returns true if path_response was for our probe
+func (conn *Connection) receivedPMTUProbeResponseLocked(opts *Options, cookie [8]byte, fromOurAddr bool) bool {
+	p := &conn.pmtu
+	if p.probeSize == 0 || p.probesSent == 0 || p.cookie != cookie {
+		return false
+	}
+	if !fromOurAddr { // peer moved, after migration search will restart anyway
+		return true
+	}
+	conn.confirmPMTUProbeLocked(opts)
+	return true
+}
+
+// called for each record acked by peer
+func (conn *Connection) receivedPMTUProbeAckLocked(opts *Options, rn record.Number) {
+	p := &conn.pmtu
+	if p.probeSize == 0 || p.probeRN == (record.Number{}) || p.probeRN != rn {
+		return
+	}
+	conn.confirmPMTUProbeLocked(opts)
+}
+
+func (conn *Connection) confirmPMTUProbeLocked(opts *Options) {
+	p := &conn.pmtu
+	p.size = p.probeSize
+	fmt.Printf("dtls: path MTU to %v is at least %d\n", conn.addr, p.size)
+	conn.handler.OnPathMTUChangedLocked(int(p.size)) // widening
+	conn.nextPMTUProbeLocked(opts)
+}
+
+// probe is sent in separate datagram, exactly probeSize bytes.
+// returns 0 if there is no probe to send.
+func (conn *Connection) constructPMTUProbeLocked(opts *Options, datagram []byte) (int, error) {
+	p := &conn.pmtu
+	// probe which cannot be sent (for example, due to peer's record_size_limit) is treated as lost
+	for p.sendProbe {
+		recordSize, err := conn.constructPMTUProbeRecord(opts, datagram, int(p.probeSize)) // widening
+		if recordSize != 0 || err != nil {
+			p.sendProbe = false
+			p.probesSent++
+			p.deadlineUnixNano = time.Now().UnixNano() + int64(conn.rtt.timeout())
+			conn.armTimerLocked()
+			return recordSize, err
+		}
+		p.failedSize = p.probeSize
+		conn.nextPMTUProbeLocked(opts)
+	}
+	return 0, nil
+}
+
+func (conn *Connection) constructPMTUProbeRecord(opts *Options, datagram []byte, probeSize int) (int, error) {
+	if probeSize > len(datagram) {
+		return 0, nil
+	}
+	insideSize := record.RRCSize
+	if !conn.rrcNegotiated {
+		insideSize = handshake.FragmentHeaderSize + 1 // KeyUpdate body is single byte
+	}
+	hdrSize := conn.recordHeaderSize(opts, conn.keys.SendEpoch, conn.keys.SendNextSeq, true)
+	sealSize, _ := conn.keys.SendSymmetric.RecordOverhead()
+	padding := probeSize - hdrSize - insideSize - 1 - sealSize
+	if padding < 0 || insideSize+1+padding > record.MaxPlaintextRecordLength+1 {
+		return 0, nil
+	}
+	if conn.rrcNegotiated {
+		return conn.constructRRCRecord(opts, datagram[:probeSize],
+			record.RRC{MsgType: record.RRCPathChallenge, Cookie: conn.pmtu.cookie}, padding)
+	}
+	// KeyUpdate in progress is simply retransmitted in probe
+	if err := conn.keyUpdateStart(false); err != nil {
+		return 0, err
+	}
+	recordSize, rn, err := conn.constructKeyUpdateRecord(opts, datagram[:probeSize], padding)
+	if recordSize != 0 {
+		conn.pmtu.probeRN = rn
+	}
+	return recordSize, err
+}
+
+// KeyUpdate in progress is sent alone in datagram, padded, never fragmented
+func (conn *Connection) constructKeyUpdateRecord(opts *Options, datagramLeft []byte, padding int) (int, record.Number, error) {
+	msgKeyUpdate := handshake.MsgKeyUpdate{UpdateRequested: conn.sendKeyUpdateUpdateRequested}
+	hdr := handshake.FragmentHeader{
+		MsgType: handshake.MsgTypeKeyUpdate,
+		Length:  1,
+		FragmentInfo: handshake.FragmentInfo{
+			MsgSeq:         conn.sendKeyUpdateMessageSeq,
+			FragmentOffset: 0,
+			FragmentLength: 1,
+		},
+	}
+	hdrSize := conn.recordHeaderSize(opts, conn.keys.SendEpoch, conn.keys.SendNextSeq, true) // alone in datagram
+	insideBody, ok := conn.prepareProtect(conn.keys.SendSymmetric, datagramLeft, hdrSize, padding)
+	if !ok || len(insideBody) < handshake.FragmentHeaderSize+1 {
+		return 0, record.Number{}, nil
+	}
+	insideBody = hdr.Write(insideBody[:0])
+	insideBody = msgKeyUpdate.Write(insideBody)
+	recordSize, rn, err := conn.protectRecord(conn.keys.SendSymmetric, conn.keys.SendEpoch, &conn.keys.SendNextSeq,
+		record.RecordTypeHandshake, datagramLeft, padding, hdrSize, len(insideBody))
+	if err != nil {
+		return 0, record.Number{}, err
+	}
+	conn.sentKeyUpdateRN = rn // on resend overwrite rn
+	conn.rtt.recordSent(rn)
+	return recordSize, rn, nil
+}
+
+// called from onTimer when probe is lost, or when it is time to search again
+func (conn *Connection) onPMTUTimerLocked(opts *Options) {
+	p := &conn.pmtu
+	p.deadlineUnixNano = 0
+	if p.probeSize == 0 {
+		conn.startPMTUSearchLocked(opts)
+		return
+	}
+	if p.probesSent < maxPMTUProbes {
+		p.sendProbe = true
+		conn.SignalWriteable()
+		return
+	}
+	p.failedSize = p.probeSize
+	conn.nextPMTUProbeLocked(opts)
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"testing"
+
+	"github.com/hrissan/dtls/record"
+)
+
+type pmtuHandler struct {
+	disconnectHandler
+	pathMTU int
+}
+
+func (h *pmtuHandler) OnPathMTUChangedLocked(pathMTU int) {
+	h.pathMTU = pathMTU
+}
+
+func TestPMTU_Search(t *testing.T) {
+	addr := netip.MustParseAddrPort("127.0.0.1:1")
+	conn, _ := newEstablishedTestConnection(addr)
+	conn.rrcNegotiated = true // probes are path_challenge
+	handler := &pmtuHandler{}
+	conn.handler = handler
+	opts := *conn.tr.opts
+	opts.PMTUMax = 9000
+
+	conn.startPMTUSearchLocked(&opts)
+	var datagram [65536]byte
+	for i := 0; i != maxPMTUProbes; i++ {
+		probeAddr, _, datagramSize, _ := conn.constructDatagram(&opts, datagram[:])
+		if probeAddr != addr || datagramSize != opts.PMTUMax {
+			t.Fatalf("probe of PMTUMax size must be sent, got size %d", datagramSize)
+		}
+		if conn.pmtu.deadlineUnixNano == 0 {
+			t.Fatalf("probe timeout must be set")
+		}
+		conn.onPMTUTimerLocked(&opts)
+	}
+	if conn.PathMTULocked() != opts.PMTUMin || conn.pmtu.failedSize != 9000 {
+		t.Fatalf("lost probes must not change path MTU")
+	}
+	_, _, datagramSize, _ := conn.constructDatagram(&opts, datagram[:])
+	wantSize := opts.PMTUMin + (9000-opts.PMTUMin)/2
+	if datagramSize != wantSize {
+		t.Fatalf("binary search probe size must be %d, got %d", wantSize, datagramSize)
+	}
+	response := record.RRC{MsgType: record.RRCPathResponse, Cookie: conn.pmtu.cookie}
+	if err := conn.receivedRRCLocked(&opts, response.Write(nil), addr, netip.Addr{}); err != nil {
+		t.Fatalf("failed to process path_response: %v", err)
+	}
+	if conn.pathMTULocked(&opts) != wantSize || handler.pathMTU != wantSize {
+		t.Fatalf("confirmed probe must set path MTU")
+	}
+	if conn.pmtu.probeSize <= uint16(wantSize) || conn.pmtu.probeSize >= 9000 {
+		t.Fatalf("search must continue between confirmed and failed sizes, got probe %d", conn.pmtu.probeSize)
+	}
+}
+
+func ackRecordBody(rn record.Number) []byte {
+	body := binary.BigEndian.AppendUint16(nil, record.AckElementSize)
+	body = binary.BigEndian.AppendUint64(body, uint64(rn.Epoch())) // widening
+	return binary.BigEndian.AppendUint64(body, rn.SeqNum())
+}
+
+func TestPMTU_SearchWithoutRRC(t *testing.T) {
+	addr := netip.MustParseAddrPort("127.0.0.1:1")
+	conn, _ := newEstablishedTestConnection(addr)
+	handler := &pmtuHandler{}
+	conn.handler = handler
+	opts := *conn.tr.opts
+	opts.PMTUMax = 9000
+
+	conn.keys.NewReceiveKeysSet = true // [2] [3], peer sent nothing with epoch 3 yet
+	conn.startPMTUSearchLocked(&opts)
+	if conn.hasPathDataToSendLocked() || conn.pmtu.deadlineUnixNano == 0 {
+		t.Fatalf("KeyUpdate probe must wait until peer finishes handshake")
+	}
+	conn.keys.NewReceiveKeysSet = false
+	conn.onPMTUTimerLocked(&opts)
+	var datagram [65536]byte
+	probeAddr, _, datagramSize, _ := conn.constructDatagram(&opts, datagram[:])
+	if probeAddr != addr || datagramSize != opts.PMTUMax {
+		t.Fatalf("probe of PMTUMax size must be sent, got size %d", datagramSize)
+	}
+	probeRN := conn.pmtu.probeRN
+	if !conn.keyUpdateInProgress() || probeRN == (record.Number{}) || conn.sentKeyUpdateRN != probeRN {
+		t.Fatalf("probe must be padded KeyUpdate")
+	}
+	conn.onPMTUTimerLocked(&opts) // lost
+	_, _, datagramSize, _ = conn.constructDatagram(&opts, datagram[:])
+	if datagramSize != opts.PMTUMax || conn.pmtu.probeRN == probeRN || conn.sendKeyUpdateMessageSeq != 2 {
+		t.Fatalf("KeyUpdate in progress must be retransmitted in the next probe")
+	}
+	if err := conn.receivedEncryptedAckLocked(&opts, ackRecordBody(probeRN), record.NumberWith(3, 7)); err != nil {
+		t.Fatalf("failed to process ack: %v", err)
+	}
+	if conn.PathMTULocked() != opts.PMTUMin || !conn.keyUpdateInProgress() {
+		t.Fatalf("ack for previous probe must be ignored")
+	}
+	if err := conn.receivedEncryptedAckLocked(&opts, ackRecordBody(conn.pmtu.probeRN), record.NumberWith(3, 8)); err != nil {
+		t.Fatalf("failed to process ack: %v", err)
+	}
+	if conn.pathMTULocked(&opts) != 9000 || handler.pathMTU != 9000 {
+		t.Fatalf("ack for probe must set path MTU")
+	}
+	if conn.keyUpdateInProgress() || conn.keys.SendEpoch != 4 {
+		t.Fatalf("ack for probe must complete KeyUpdate")
+	}
+}
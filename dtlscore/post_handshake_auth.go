@@ -0,0 +1,312 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding"
+	"fmt"
+	"hash"
+	"math"
+
+	"github.com/hrissan/dtls/ciphersuite"
+	"github.com/hrissan/dtls/dtlserrors"
+	"github.com/hrissan/dtls/handshake"
+	"github.com/hrissan/dtls/keys"
+)
+
+// [rfc8446:4.6.2] post-handshake authentication.
+// Allocated at the end of handshake, only if client sent post_handshake_auth.
+// Signing and verification of CertificateVerify are done by compute pool (see handshake_compute.go).
+// Like during handshake, only RSA-PSS (rsa_pss_rsae_sha256) certificates are supported.
+type postHandshakeAuth struct {
+	// state of transcript hasher after client Finished,
+	// each authentication exchange starts from this state [rfc8446:4.4]
+	transcriptState []byte
+
+	// [rfc8446:4.4] Finished uses current application traffic secret as a base key.
+	// conn.keys only remember next generation receive secret, so we track
+	// secret of the newest receive epoch here (server needs it to check client's Finished)
+	receiveTrafficSecret ciphersuite.Hash
+
+	exchange *postHandshakeContext // allocated while exchange is in progress
+}
+
+// We must support fragmented messages here, because Certificate is large
+type postHandshakeContext struct {
+	receivedMessages receiveQueue
+	sendQueue        sendQueue
+
+	transcriptHasher hash.Hash
+	requestContext   []byte
+
+	// on server, message we expect next, MsgTypeZero if we did not send request
+	expectMsgType    handshake.MsgType
+	certificateChain handshake.MsgCertificate
+	leaf             *x509.Certificate
+
+	computation computation // pending, received messages are not delivered meanwhile
+}
+
+func newPostHandshakeAuth(transcriptHasher hash.Hash) *postHandshakeAuth {
+	marshaler, ok := transcriptHasher.(encoding.BinaryMarshaler)
+	if !ok {
+		panic("transcript hasher must implement encoding.BinaryMarshaler")
+	}
+	state, err := marshaler.MarshalBinary()
+	if err != nil {
+		panic("transcript hasher failed to marshal state: " + err.Error())
+	}
+	return &postHandshakeAuth{transcriptState: state}
+}
+
+func (pha *postHandshakeAuth) startExchange() *postHandshakeContext {
+	if pha.exchange == nil {
+		pha.exchange = &postHandshakeContext{} // TODO - take from pool
+		pha.exchange.sendQueue.Reserve()
+	}
+	return pha.exchange
+}
+
+// exchange is freed only when there is nothing to receive or send
+func (pha *postHandshakeAuth) maybeFinishExchange() {
+	ex := pha.exchange
+	if ex == nil || ex.expectMsgType != handshake.MsgTypeZero || ex.computation.kind != computeNone {
+		return
+	}
+	if ex.receivedMessages.Len() != 0 || ex.sendQueue.Len() != 0 {
+		return
+	}
+	pha.exchange = nil // TODO - return to pool
+}
+
+func (pha *postHandshakeAuth) newTranscriptHasher(suite ciphersuite.Suite) hash.Hash {
+	hasher := suite.NewHasher()
+	unmarshaler, ok := hasher.(encoding.BinaryUnmarshaler)
+	if !ok {
+		panic("transcript hasher must implement encoding.BinaryUnmarshaler")
+	}
+	if err := unmarshaler.UnmarshalBinary(pha.transcriptState); err != nil {
+		panic("transcript hasher failed to unmarshal state: " + err.Error())
+	}
+	return hasher
+}
+
+func (conn *Connection) postHandshakeExchange() *postHandshakeContext {
+	if conn.pha == nil {
+		return nil
+	}
+	return conn.pha.exchange
+}
+
+func (ex *postHandshakeContext) PushMessage(conn *Connection, msg handshake.Message) error {
+	if conn.nextMessageSeqSend == math.MaxUint16 {
+		return dtlserrors.ErrSendMessageSeqOverflow
+	}
+	msg.MsgSeq = conn.nextMessageSeqSend
+	conn.nextMessageSeqSend++
+
+	ex.sendQueue.PushMessage(msg)
+	msg.AddToHash(ex.transcriptHasher)
+	return nil
+}
+
+// [rfc8446:4.6.2] Server can request client certificate any time after handshake, if client
+// sent post_handshake_auth. Result is reported with ConnectionHandler.OnClientAuthenticationLocked.
+func (conn *Connection) RequestClientAuthenticationLocked() error {
+	opts := conn.tr.opts
+	if !opts.RoleServer || conn.stateID != smIDPostHandshake || conn.pha == nil {
+		return dtlserrors.ErrPostHandshakeAuthNotPossible
+	}
+	if ex := conn.pha.exchange; ex != nil && (ex.expectMsgType != handshake.MsgTypeZero || ex.sendQueue.Len() != 0) {
+		return dtlserrors.ErrPostHandshakeAuthInProgress
+	}
+	ex := conn.pha.startExchange()
+	ex.transcriptHasher = conn.pha.newTranscriptHasher(conn.keys.Suite())
+	ex.requestContext = make([]byte, 8) // [rfc8446:4.3.2] must be unique within connection
+	opts.Rnd.ReadMust(ex.requestContext)
+	ex.certificateChain = handshake.MsgCertificate{}
+	ex.leaf = nil
+
+	msgRequest := handshake.MsgCertificateRequest{RequestContext: ex.requestContext}
+	msgRequest.Extensions.SignatureAlgorithmsSet = true
+	msgRequest.Extensions.SignatureAlgorithms.RSA_PSS_RSAE_SHA256 = true // the only one we support
+	msg := handshake.Message{
+		MsgType: handshake.MsgTypeCertificateRequest,
+		Body:    msgRequest.Write(nil), // TODO - reuse message bodies in a rope
+	}
+	if err := ex.PushMessage(conn, msg); err != nil {
+		return err
+	}
+	ex.expectMsgType = handshake.MsgTypeCertificate
+	conn.SignalWriteable()
+	return nil
+}
+
+func (conn *Connection) receivedCertificateRequest(opts *Options, msg handshake.Message) error {
+	if opts.RoleServer || conn.pha == nil {
+		return dtlserrors.ErrCertificateRequestUnexpected
+	}
+	var msgParsed handshake.MsgCertificateRequest
+	if err := msgParsed.Parse(msg.Body); err != nil {
+		return dtlserrors.ErrCertificateRequestMessageParsing
+	}
+	ex := conn.pha.startExchange()
+	if ex.sendQueue.Len()+3 > len(ex.sendQueue.messagesStorage) {
+		return dtlserrors.ErrPostHandshakeAuthInProgress // peer sends requests too fast
+	}
+	suite := conn.keys.Suite()
+	ex.transcriptHasher = conn.pha.newTranscriptHasher(suite)
+	msg.AddToHash(ex.transcriptHasher)
+
+	requestContext := append([]byte{}, msgParsed.RequestContext...) // will be retained in send queue
+	chain := opts.ClientCertificate.Certificate
+	if _, ok := opts.ClientCertificate.PrivateKey.(*rsa.PrivateKey); !ok || !msgParsed.Extensions.SignatureAlgorithms.RSA_PSS_RSAE_SHA256 {
+		chain = nil // [rfc8446:4.4.2.3] we send empty Certificate if we have no suitable one
+	}
+	if err := ex.PushMessage(conn, generateCertificate(requestContext, chain, nil)); err != nil {
+		return err
+	}
+	if len(chain) == 0 {
+		return conn.pushPostHandshakeFinished(ex)
+	}
+	c := computation{kind: computePostHandshakeSign}
+	c.transcriptHash.SetSum(ex.transcriptHasher)
+	return conn.startComputationLocked(opts, c)
+}
+
+func (conn *Connection) onPostHandshakeCertVerifyGeneratedLocked(opts *Options, ex *postHandshakeContext, msgCertificateVerify handshake.Message) error {
+	if err := ex.PushMessage(conn, msgCertificateVerify); err != nil {
+		return err
+	}
+	if err := conn.pushPostHandshakeFinished(ex); err != nil {
+		return err
+	}
+	return conn.deliverPostHandshakeMessages(opts, ex)
+}
+
+// on client, completes response to CertificateRequest
+func (conn *Connection) pushPostHandshakeFinished(ex *postHandshakeContext) error {
+	// [rfc8446:4.4.4] - finished
+	var finishedTranscriptHash ciphersuite.Hash
+	finishedTranscriptHash.SetSum(ex.transcriptHasher)
+	finished := keys.ComputeFinished(conn.keys.Suite(), conn.keys.SendApplicationTrafficSecret, finishedTranscriptHash)
+	msgFinished := handshake.MsgFinished{VerifyData: finished.GetValue()}
+	if err := ex.PushMessage(conn, handshake.Message{
+		MsgType: handshake.MsgTypeFinished,
+		Body:    msgFinished.Write(nil), // TODO - reuse message bodies in a rope
+	}); err != nil {
+		return err
+	}
+	ex.transcriptHasher = nil
+	fmt.Printf("post-handshake authentication response generated\n")
+	conn.SignalWriteable()
+	return nil
+}
+
+// on server, checks current exchange state
+func (conn *Connection) expectPostHandshakeAuthMessage(msgType handshake.MsgType) *postHandshakeContext {
+	ex := conn.postHandshakeExchange()
+	if !conn.tr.opts.RoleServer || ex == nil || ex.expectMsgType != msgType {
+		return nil
+	}
+	return ex
+}
+
+func (conn *Connection) postHandshakeAuthFailed(ex *postHandshakeContext, err error) error {
+	ex.expectMsgType = handshake.MsgTypeZero
+	ex.transcriptHasher = nil
+	conn.handler.OnClientAuthenticationLocked(ClientAuthenticationInfo{}, err)
+	return err
+}
+
+func (conn *Connection) receivedPostHandshakeCertificate(msg handshake.Message) error {
+	ex := conn.expectPostHandshakeAuthMessage(handshake.MsgTypeCertificate)
+	if ex == nil {
+		return dtlserrors.ErrUnexpectedMessage
+	}
+	var msgParsed handshake.MsgCertificate
+	if err := msgParsed.Parse(msg.Body); err != nil {
+		return conn.postHandshakeAuthFailed(ex, dtlserrors.ErrCertificateMessageParsing)
+	}
+	if string(msgParsed.RequestContext) != string(ex.requestContext) {
+		return conn.postHandshakeAuthFailed(ex, dtlserrors.ErrCertificateRequestContextMismatch)
+	}
+	ex.sendQueue.Clear() // implicit ack of CertificateRequest
+	msg.AddToHash(ex.transcriptHasher)
+	ex.certificateChain = msgParsed
+	ex.certificateChain.RequestContext = nil // points to message body
+	if msgParsed.CertificatesLength == 0 {
+		ex.expectMsgType = handshake.MsgTypeFinished // client declined
+	} else {
+		ex.expectMsgType = handshake.MsgTypeCertificateVerify
+	}
+	return nil
+}
+
+func (conn *Connection) receivedPostHandshakeCertificateVerify(opts *Options, msg handshake.Message) error {
+	ex := conn.expectPostHandshakeAuthMessage(handshake.MsgTypeCertificateVerify)
+	if ex == nil {
+		return dtlserrors.ErrUnexpectedMessage
+	}
+	var msgParsed handshake.MsgCertificateVerify
+	if err := msgParsed.Parse(msg.Body); err != nil {
+		return conn.postHandshakeAuthFailed(ex, dtlserrors.ErrCertificateVerifyMessageParsing)
+	}
+	if msgParsed.SignatureScheme != handshake.SignatureAlgorithm_RSA_PSS_RSAE_SHA256 { // the only one we requested
+		return conn.postHandshakeAuthFailed(ex, dtlserrors.ErrCertificateAlgorithmUnsupported)
+	}
+	// slices point to messages from exchange receive queue, which are not changed until exchange ends
+	c := computation{
+		kind:      computePostHandshakeVerify,
+		certData:  ex.certificateChain.Certificates[0].CertData,
+		signature: msgParsed.Signature,
+	}
+	// [rfc8446:4.4.3] - certificate verification
+	c.transcriptHash.SetSum(ex.transcriptHasher)
+	// if signature is invalid, exchange fails, so we can add message before check
+	msg.AddToHash(ex.transcriptHasher)
+	return conn.startComputationLocked(opts, c)
+}
+
+func (conn *Connection) onPostHandshakeCertVerifyCheckedLocked(opts *Options, ex *postHandshakeContext, leaf *x509.Certificate, err error) error {
+	if err != nil {
+		return conn.postHandshakeAuthFailed(ex, err)
+	}
+	fmt.Printf("post-handshake certificate verify ok\n")
+	ex.leaf = leaf
+	ex.expectMsgType = handshake.MsgTypeFinished
+	return conn.deliverPostHandshakeMessages(opts, ex)
+}
+
+func (conn *Connection) receivedPostHandshakeFinished(msg handshake.Message) error {
+	ex := conn.expectPostHandshakeAuthMessage(handshake.MsgTypeFinished)
+	if ex == nil {
+		return dtlserrors.ErrUnexpectedMessage
+	}
+	var msgParsed handshake.MsgFinished
+	if err := msgParsed.Parse(msg.Body); err != nil {
+		return conn.postHandshakeAuthFailed(ex, dtlserrors.ErrFinishedMessageParsing)
+	}
+	// [rfc8446:4.4.4] - finished
+	var finishedTranscriptHash ciphersuite.Hash
+	finishedTranscriptHash.SetSum(ex.transcriptHasher)
+
+	mustBeFinished := keys.ComputeFinished(conn.keys.Suite(), conn.pha.receiveTrafficSecret, finishedTranscriptHash)
+	if string(msgParsed.VerifyData) != string(mustBeFinished.GetValue()) {
+		return conn.postHandshakeAuthFailed(ex, dtlserrors.ErrFinishedMessageVerificationFailed)
+	}
+	fmt.Printf("post-handshake finished message verify ok: %+v\n", msgParsed)
+	info := ClientAuthenticationInfo{Leaf: ex.leaf}
+	for _, c := range ex.certificateChain.Certificates[:ex.certificateChain.CertificatesLength] {
+		info.Certificates = append(info.Certificates, c.CertData)
+	}
+	ex.expectMsgType = handshake.MsgTypeZero
+	ex.transcriptHasher = nil
+	ex.certificateChain = handshake.MsgCertificate{}
+	ex.leaf = nil
+	conn.handler.OnClientAuthenticationLocked(info, nil)
+	return nil
+}
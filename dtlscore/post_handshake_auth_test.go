@@ -0,0 +1,155 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+
+	"github.com/hrissan/dtls/ciphersuite"
+	"github.com/hrissan/dtls/dtlserrors"
+	"github.com/hrissan/dtls/handshake"
+)
+
+func TestPostHandshakeAuth_TranscriptFork(t *testing.T) {
+	for _, suiteID := range []ciphersuite.ID{ciphersuite.TLS_AES_128_GCM_SHA256, ciphersuite.TLS_AES_256_GCM_SHA384} {
+		suite := ciphersuite.GetSuite(suiteID)
+		hasher := suite.NewHasher()
+		_, _ = hasher.Write([]byte("handshake messages up to client Finished"))
+		pha := newPostHandshakeAuth(hasher)
+
+		msg := handshake.Message{MsgType: handshake.MsgTypeCertificateRequest, Body: []byte{1, 2, 3}}
+		msg.AddToHash(hasher)
+		var mustBe ciphersuite.Hash
+		mustBe.SetSum(hasher)
+
+		for i := 0; i < 2; i++ { // each exchange starts from the same state
+			forked := pha.newTranscriptHasher(suite)
+			msg.AddToHash(forked)
+			var got ciphersuite.Hash
+			got.SetSum(forked)
+			if got != mustBe {
+				t.Fatalf("forked transcript hash mismatch for suite %d", suiteID)
+			}
+		}
+	}
+}
+
+func requestClientAuthentication(lb *loopback) error {
+	server := lb.serverConn()
+	server.Lock()
+	defer server.Unlock()
+	return server.RequestClientAuthenticationLocked()
+}
+
+func TestPostHandshakeAuth_Certificate(t *testing.T) {
+	cert := loopbackCertificate(t)
+	lb := newLoopback(t, func(clientOpts *Options, serverOpts *Options) {
+		clientOpts.PostHandshakeAuth = true
+		clientOpts.ClientCertificate = cert
+	})
+	lb.handshake()
+	for i := 0; i < 2; i++ { // each exchange starts from transcript after client Finished
+		if err := requestClientAuthentication(lb); err != nil {
+			t.Fatalf("failed to request client authentication: %v", err)
+		}
+		lb.pump()
+		h := lb.serverHandler.handler
+		if h.authCalls != i+1 || h.authErr != nil {
+			t.Fatalf("client authentication must succeed, got %v", h.authErr)
+		}
+		if len(h.authInfo.Certificates) != 1 || !bytes.Equal(h.authInfo.Certificates[0], cert.Certificate[0]) ||
+			h.authInfo.Leaf == nil || !h.authInfo.Leaf.Equal(cert.Leaf) {
+			t.Fatalf("server must get client certificate chain")
+		}
+		if lb.serverConn().postHandshakeExchange() != nil || lb.clientConn.postHandshakeExchange() != nil {
+			t.Fatalf("exchange must be released on both sides")
+		}
+	}
+	lb.send(&lb.clientConn, &lb.clientHandler, []byte("after"))
+	lb.pump()
+	if len(lb.serverHandler.handler.received) != 1 || lb.serverHandler.handler.disconnected {
+		t.Fatalf("connection must continue after authentication")
+	}
+}
+
+func TestPostHandshakeAuth_ComputePool(t *testing.T) {
+	cert := loopbackCertificate(t)
+	lb := newLoopback(t, func(clientOpts *Options, serverOpts *Options) {
+		clientOpts.PostHandshakeAuth = true
+		clientOpts.ClientCertificate = cert
+		clientOpts.ComputeGoroutines = 1
+		serverOpts.ComputeGoroutines = 1
+	})
+	lb.handshake()
+	computed := lb.computed
+	if err := requestClientAuthentication(lb); err != nil {
+		t.Fatalf("failed to request client authentication: %v", err)
+	}
+	lb.pump()
+	if lb.computed != computed+2 {
+		t.Fatalf("client signing and server verification must be done by compute pool, got %d computations", lb.computed-computed)
+	}
+	h := lb.serverHandler.handler
+	if h.authCalls != 1 || h.authErr != nil || h.authInfo.Leaf == nil || !h.authInfo.Leaf.Equal(cert.Leaf) {
+		t.Fatalf("client authentication must succeed, got %v", h.authErr)
+	}
+	if lb.serverConn().postHandshakeExchange() != nil || lb.clientConn.postHandshakeExchange() != nil {
+		t.Fatalf("exchange must be released on both sides")
+	}
+}
+
+func TestPostHandshakeAuth_NotOffered(t *testing.T) {
+	lb := newLoopback(t, nil)
+	lb.handshake()
+	if err := requestClientAuthentication(lb); err != dtlserrors.ErrPostHandshakeAuthNotPossible {
+		t.Fatalf("request must be refused if client did not send post_handshake_auth, got %v", err)
+	}
+}
+
+func TestPostHandshakeAuth_EmptyCertificate(t *testing.T) {
+	lb := newLoopback(t, func(clientOpts *Options, serverOpts *Options) {
+		clientOpts.PostHandshakeAuth = true // without ClientCertificate
+	})
+	lb.handshake()
+	if err := requestClientAuthentication(lb); err != nil {
+		t.Fatalf("failed to request client authentication: %v", err)
+	}
+	lb.pump()
+	h := lb.serverHandler.handler
+	if h.authCalls != 1 || h.authErr != nil || len(h.authInfo.Certificates) != 0 || h.authInfo.Leaf != nil {
+		t.Fatalf("client declining with empty Certificate must be reported without certificates, got %v", h.authErr)
+	}
+	if h.disconnected {
+		t.Fatalf("connection must stay open, application decides what to do with unauthenticated client")
+	}
+}
+
+func TestPostHandshakeAuth_BadCertificateVerify(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := loopbackCertificate(t)
+	cert.PrivateKey = otherKey // signature will not match public key in certificate
+	lb := newLoopback(t, func(clientOpts *Options, serverOpts *Options) {
+		clientOpts.PostHandshakeAuth = true
+		clientOpts.ClientCertificate = cert
+	})
+	lb.handshake()
+	if err := requestClientAuthentication(lb); err != nil {
+		t.Fatalf("failed to request client authentication: %v", err)
+	}
+	lb.pump()
+	h := lb.serverHandler.handler
+	if h.authCalls != 1 || !errors.Is(h.authErr, dtlserrors.ErrCertificateSignatureInvalid) || h.authInfo.Leaf != nil {
+		t.Fatalf("client authentication must fail, got %v", h.authErr)
+	}
+	if !h.disconnected || !lb.clientHandler.disconnected {
+		t.Fatalf("connection must be closed with fatal alert")
+	}
+}
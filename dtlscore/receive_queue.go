@@ -0,0 +1,113 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"math"
+
+	"github.com/hrissan/dtls/circular"
+	"github.com/hrissan/dtls/constants"
+	"github.com/hrissan/dtls/dtlserrors"
+	"github.com/hrissan/dtls/handshake"
+	"github.com/hrissan/dtls/record"
+)
+
+// reassembly of fragmented messages, used during handshake and
+// for post-handshake messages, when we allow them to be fragmented.
+// Messages end() is aligned with conn.nextMessageSeqReceive
+type receiveQueue struct {
+	messages        circular.BufferExt[partialHandshakeMsg]
+	messagesStorage [constants.MaxReceiveMessagesQueue]partialHandshakeMsg
+
+	bodyBytes int // of messages in the queue, for memory accounting
+}
+
+func (rq *receiveQueue) Len() int {
+	return rq.messages.Len()
+}
+
+func (rq *receiveQueue) FirstMessageSeq(conn *Connection) uint16 {
+	if rq.messages.Len() > int(conn.nextMessageSeqReceive) { // widening
+		panic("received messages queue invariant violated")
+	}
+	return conn.nextMessageSeqReceive - uint16(rq.messages.Len()) // safe due to check above
+}
+
+// fragment.Header.MsgSeq must be checked against FirstMessageSeq by caller.
+// If returns changed, caller should pop all full messages from the queue.
+func (rq *receiveQueue) ReceivedFragment(conn *Connection, fragment handshake.Fragment, rn record.Number) (changed bool, _ error) {
+	if fragment.Header.MsgType == handshake.MsgTypeZero { // we use it as a flag of not yet received message below, so check here
+		return false, dtlserrors.ErrHandshakeMessageTypeUnknown
+	}
+	messageOffset := int(fragment.Header.MsgSeq) + rq.messages.Len() - int(conn.nextMessageSeqReceive) // widening
+	if messageOffset < 0 {
+		panic("checked before calling receiveQueue.ReceivedFragment")
+	}
+	if messageOffset >= rq.messages.Cap(rq.messagesStorage[:]) {
+		return false, nil // would be beyond queue even if we fill it
+	}
+	for messageOffset >= rq.messages.Len() {
+		rq.messages.PushBack(rq.messagesStorage[:], partialHandshakeMsg{})
+		if conn.nextMessageSeqReceive == math.MaxUint16 {
+			// can happen only when fragment.MsgSeq == math.MaxUint16
+			return false, dtlserrors.ErrReceivedMessageSeqOverflow
+		}
+		conn.nextMessageSeqReceive++
+	}
+	partialMessage := rq.messages.IndexRef(rq.messagesStorage[:], messageOffset)
+	if partialMessage.Msg.MsgType == handshake.MsgTypeZero { // the first fragment, we need to set header, allocate body
+		*partialMessage = partialHandshakeMsg{
+			Msg: handshake.Message{
+				MsgType: fragment.Header.MsgType,
+				MsgSeq:  fragment.Header.MsgSeq,
+			},
+		}
+		partialMessage.Ass.ResetToFull(fragment.Header.Length)
+		partialMessage.Msg.Body = make([]byte, fragment.Header.Length) // TODO - rope from pull
+		rq.bodyBytes += len(partialMessage.Msg.Body)
+	} else {
+		if fragment.Header.MsgSeq != partialMessage.Msg.MsgSeq {
+			panic("message sequence is queue offset and must always match")
+		}
+		if fragment.Header.Length != partialMessage.Msg.Len32() {
+			return false, dtlserrors.ErrHandshakeMessageFragmentLengthMismatch
+		}
+		if fragment.Header.MsgType != partialMessage.Msg.MsgType {
+			return false, dtlserrors.ErrHandshakeMessageFragmentTypeMismatch
+		}
+	}
+	shouldAck, changed := partialMessage.Ass.AddFragment(fragment.Header.FragmentOffset, fragment.Header.FragmentLength)
+	if !shouldAck {
+		return false, nil // got in the middle of the hole, wait for fragment which we can actully add
+	}
+	// should ack it independent of conditions below, immediately if peer's flight is complete
+	conn.addAckLocked(rn, endsFlight(partialMessage.Msg.MsgType) && partialMessage.Ass.FragmentsCount() == 0)
+	if !changed { // nothing new, save copy
+		return false, nil
+	}
+	copy(partialMessage.Msg.Body[fragment.Header.FragmentOffset:], fragment.Body) // copy all bytes for simplicity
+	return true, nil
+}
+
+// [rfc9147:7.1] messages going through the queue are parts of handshake or post-handshake
+// authentication flights, which always end with Finished.
+func endsFlight(msgType handshake.MsgType) bool {
+	return msgType == handshake.MsgTypeFinished
+}
+
+// returns false if the first message is not fully received yet
+func (rq *receiveQueue) PopFullMessage() (handshake.Message, bool) {
+	if rq.messages.Len() == 0 {
+		return handshake.Message{}, false
+	}
+	first := rq.messages.FrontRef(rq.messagesStorage[:])
+	if first.Msg.MsgType == handshake.MsgTypeZero || first.Ass.FragmentsCount() != 0 {
+		// not a single fragment received, or not fully received
+		return handshake.Message{}, false
+	}
+	msg := first.Msg
+	rq.messages.PopFront(rq.messagesStorage[:])
+	rq.bodyBytes -= len(msg.Body)
+	return msg, true
+}
@@ -16,6 +16,12 @@ var ErrServerCannotStartConnection = errors.New("server can not start connection
 var ErrTransportClosing = errors.New("transport is shutting down")
 
 func (t *Transport) ReceivedDatagram(datagram []byte, addr netip.AddrPort, err error) (shutdown bool) {
+	return t.ReceivedDatagramShard(0, datagram, addr, netip.Addr{}, err)
+}
+
+// for transports created with NewShardedTransport, shard is index of socket datagram arrived on.
+// localAddr is destination address of datagram (IP_PKTINFO), replies are sent from it, if valid.
+func (t *Transport) ReceivedDatagramShard(shard int, datagram []byte, addr netip.AddrPort, localAddr netip.Addr, err error) (shutdown bool) {
 	t.opts.Stats.SocketReadDatagram(datagram, addr)
 	if err != nil {
 		t.opts.Stats.SocketReadError(len(datagram), addr, err)
@@ -24,7 +30,7 @@ func (t *Transport) ReceivedDatagram(datagram []byte, addr netip.AddrPort, err e
 		return false
 	}
 
-	conn, err := t.processDatagramImpl(datagram, addr)
+	conn, err := t.processDatagramImpl(shard, datagram, addr, localAddr)
 	if err == ErrTransportClosing {
 		return true
 	}
@@ -33,7 +39,8 @@ func (t *Transport) ReceivedDatagram(datagram []byte, addr netip.AddrPort, err e
 			// TODO - return *dtlserrors.Error instead of error, so we cannot
 			// return generic error by accident
 			if dtlserrors.IsFatal(err) {
-				fmt.Printf("fatal error: TODO - send alert and close connection: %v\n", err)
+				fmt.Printf("fatal error, sending alert and closing connection: %v\n", err)
+				conn.fail(err) // also registers connection in sender
 			} else {
 				t.opts.Stats.Warning(addr, err)
 			}
@@ -41,26 +48,22 @@ func (t *Transport) ReceivedDatagram(datagram []byte, addr netip.AddrPort, err e
 			// TODO - return bool from processDatagramImpl instead, do not take lock 2nd time
 			if conn.hasDataToSend() {
 				// We postpone sending responses until full datagram processed
-				t.snd.RegisterConnectionForSend(conn)
+				conn.SignalWriteable()
 			}
 		}
-	} else {
+	} else if err != nil {
 		t.opts.Stats.Warning(addr, err)
-		// TODO - alert is must here, otherwise client will not know we forgot their connection
 	}
 	return false
 }
 
-func (t *Transport) processDatagramImpl(datagram []byte, addr netip.AddrPort) (*Connection, error) {
+func (t *Transport) processDatagramImpl(shard int, datagram []byte, addr netip.AddrPort, localAddr netip.Addr) (*Connection, error) {
 	// We look up on each datagram unconditionally to simplify logic in this function and functions it calls.
 	// If conn is nil, on server the only place where it can be added is receivedClientHello.
 	// on client the only place where it can be added is StartConnection.
 	// We could have transport which plays both roles at once, but we need to track connections separately.
-	t.mu.Lock()
-	conn := t.connMap[addr]
-	shutdown := t.shutdown
-	t.mu.Unlock()
-	if shutdown {
+	conn := t.findConnection(addr)
+	if t.shutdown.Load() {
 		return nil, ErrTransportClosing
 	}
 
@@ -79,11 +82,15 @@ func (t *Transport) processDatagramImpl(datagram []byte, addr netip.AddrPort) (*
 			}
 			recordOffset += n
 			// fmt.Printf("dtls: got ciphertext %v cid(hex): %x from %v, body(hex): %x", hdr., cid, addr, body)
+			if hdr.HasCID() { // [rfc9146] route by CID, so peer can change address
+				conn = t.findConnectionByCID(hdr.CID)
+			}
 			if conn == nil {
 				// We can continue. but we do not, most likely there is more encrypted records
+				t.sendStatelessReset(shard, datagram, addr, localAddr)
 				return conn, dtlserrors.WarnCiphertextNoConnection
 			}
-			err = conn.receivedCiphertextRecord(t.opts, hdr)
+			err = conn.receivedCiphertextRecord(t.opts, hdr, addr, localAddr)
 			if dtlserrors.IsFatal(err) { // manual check in the loop, otherwise simply return
 				return conn, err
 			} else if err != nil {
@@ -107,7 +114,7 @@ func (t *Transport) processDatagramImpl(datagram []byte, addr netip.AddrPort) (*
 			recordOffset += n
 			// TODO - should we check/remove replayed received record sequence number?
 			// how to do this without state?
-			conn, err = t.receivedPlaintextRecord(conn, hdr, addr)
+			conn, err = t.receivedPlaintextRecord(shard, conn, hdr, addr, localAddr)
 			if err != nil { // we do not believe plaintext, so only warnings
 				t.opts.Stats.Warning(addr, err)
 			}
@@ -136,6 +143,6 @@ func (t *Transport) StartConnection(conn *Connection, handler ConnectionHandler,
 		handler.OnDisconnectLocked(err)
 		return err
 	}
-	t.snd.RegisterConnectionForSend(conn)
+	conn.SignalWriteable()
 	return nil
 }
@@ -4,7 +4,6 @@
 package dtlscore
 
 import (
-	"crypto/sha256"
 	"fmt"
 	"hash"
 	"net/netip"
@@ -19,7 +18,7 @@ import (
 	"github.com/hrissan/dtls/safecast"
 )
 
-func (t *Transport) receivedClientHello(conn *Connection, msg handshake.Message, addr netip.AddrPort) (*Connection, error) {
+func (t *Transport) receivedClientHello(shard int, conn *Connection, msg handshake.Message, addr netip.AddrPort, localAddr netip.Addr) (*Connection, error) {
 	var msgClientHello handshake.MsgClientHello
 	var bindersListLength int
 	if err := msgClientHello.Parse(msg.Body, &bindersListLength); err != nil {
@@ -87,7 +86,6 @@ func (t *Transport) receivedClientHello(conn *Connection, msg handshake.Message,
 			}
 		} else {
 			msg.AddToHash(transcriptHasher)
-			debugPrintSum(transcriptHasher)
 		}
 
 		params := cookie.Params{
@@ -101,11 +99,11 @@ func (t *Transport) receivedClientHello(conn *Connection, msg handshake.Message,
 			// we should check all parameters above, so that we do not create connection for unsupported params
 			clientEarlyTrafficSecret := keys.DeriveSecret(hmacEarlySecret, "c e traffic", params.TranscriptHash)
 
-			conn, err = t.finishReceivedClientHello(conn, addr, false,
+			conn, err = t.finishReceivedClientHello(shard, conn, addr, localAddr, false,
 				earlySecret, pskSelected, pskSelectedIdentity, alpnSelected,
 				msgClientHello, params, transcriptHasher, clientEarlyTrafficSecret)
 			if conn != nil {
-				t.snd.RegisterConnectionForSend(conn)
+				conn.SignalWriteable()
 			}
 			return conn, err
 		}
@@ -114,7 +112,7 @@ func (t *Transport) receivedClientHello(conn *Connection, msg handshake.Message,
 		ck = t.cookieState.AppendCookie(ck, params, addr)
 		t.opts.Stats.CookieCreated(addr)
 
-		hrrStorage := t.snd.PopHelloRetryDatagramStorage()
+		hrrStorage := t.snds[shard].PopHelloRetryDatagramStorage()
 		if hrrStorage == nil {
 			return conn, dtlserrors.ErrServerHelloRetryRequestQueueFull
 		}
@@ -122,9 +120,7 @@ func (t *Transport) receivedClientHello(conn *Connection, msg handshake.Message,
 		if len(hrrDatagram) > len(*hrrStorage) {
 			panic("Large HRR datagram must not be generated")
 		}
-		hrrHash := sha256.Sum256(hrrDatagram) // for debug only
-		fmt.Printf("serverHRRHash1: %x\n", hrrHash[:])
-		t.snd.SendHelloRetryDatagram(hrrStorage, len(hrrDatagram), addr)
+		t.snds[shard].SendHelloRetryDatagram(hrrStorage, len(hrrDatagram), addr, localAddr)
 		return conn, nil
 	}
 	if !msgClientHello.Extensions.KeyShare.X25519PublicKeySet {
@@ -148,8 +144,6 @@ func (t *Transport) receivedClientHello(conn *Connection, msg handshake.Message,
 		if len(hrrDatagram) > len(hrrDatagramStorage) {
 			panic("Large HRR datagram must not be generated")
 		}
-		hrrHash := sha256.Sum256(hrrDatagram) // for debug only
-		fmt.Printf("serverHRRHash2: %x\n", hrrHash[:])
 
 		// [rfc8446:4.4.1] replace initial client hello message with its hash if HRR was used
 		syntheticMessage := handshake.Message{
@@ -197,16 +191,16 @@ func (t *Transport) receivedClientHello(conn *Connection, msg handshake.Message,
 		fmt.Printf("certificate auth selected\n")
 	}
 	// we should check all parameters above, so that we do not create connection for unsupported params
-	conn, err = t.finishReceivedClientHello(conn, addr, true,
+	conn, err = t.finishReceivedClientHello(shard, conn, addr, localAddr, true,
 		earlySecret, pskSelected, pskSelectedIdentity, alpnSelected,
 		msgClientHello, params, transcriptHasher, ciphersuite.Hash{})
 	if conn != nil {
-		t.snd.RegisterConnectionForSend(conn)
+		conn.SignalWriteable()
 	}
 	return conn, err
 }
 
-func (t *Transport) finishReceivedClientHello(conn *Connection, addr netip.AddrPort, serverUsedHRR bool,
+func (t *Transport) finishReceivedClientHello(shard int, conn *Connection, addr netip.AddrPort, localAddr netip.Addr, serverUsedHRR bool,
 	earlySecret ciphersuite.Hash, pskSelected bool, pskSelectedIdentity uint16, alpnSelected []byte,
 	msgClientHello handshake.MsgClientHello, params cookie.Params,
 	transcriptHasher hash.Hash, clientEarlyTrafficSecret ciphersuite.Hash) (*Connection, error) {
@@ -216,7 +210,7 @@ func (t *Transport) finishReceivedClientHello(conn *Connection, addr netip.AddrP
 		conn.Lock()
 		if conn.stateID != smIDClosed {
 			defer conn.Unlock()
-			return conn, conn.onClientHello2Locked(t.opts, addr, serverUsedHRR,
+			return conn, conn.onClientHello2Locked(t.opts, shard, addr, localAddr, serverUsedHRR,
 				earlySecret, pskSelected, pskSelectedIdentity, alpnSelected,
 				msgClientHello, params, transcriptHasher, clientEarlyTrafficSecret)
 		}
@@ -225,13 +219,17 @@ func (t *Transport) finishReceivedClientHello(conn *Connection, addr netip.AddrP
 		// so we forget this one, and get a new one from the pool.
 		conn = nil
 	}
+	if !t.reserveHandshakeSlot() {
+		return nil, dtlserrors.WarnHandshakeLimit
+	}
 	conn = t.getFromPool()
 	if conn == nil { // TODO - print rare warning, too many connections
+		t.cancelHandshakeSlot()
 		return nil, nil
 	}
 	conn.Lock()
 	defer conn.Unlock()
-	return conn, conn.onClientHello2Locked(t.opts, addr, serverUsedHRR,
+	return conn, conn.onClientHello2Locked(t.opts, shard, addr, localAddr, serverUsedHRR,
 		earlySecret, pskSelected, pskSelectedIdentity, alpnSelected,
 		msgClientHello, params, transcriptHasher, clientEarlyTrafficSecret)
 }
@@ -12,24 +12,24 @@ import (
 	"github.com/hrissan/dtls/record"
 )
 
-func (t *Transport) receivedPlaintextRecord(conn *Connection, hdr record.Plaintext, addr netip.AddrPort) (*Connection, error) {
+func (t *Transport) receivedPlaintextRecord(shard int, conn *Connection, hdr record.Plaintext, addr netip.AddrPort, localAddr netip.Addr) (*Connection, error) {
 	switch hdr.ContentType {
 	case record.RecordTypeAlert:
 		if conn == nil { // Will not respond with alert, otherwise endless cycle
 			return conn, nil
 		}
-		return conn, conn.receivedAlertLocked(false, hdr.Body)
+		return conn, conn.receivedPlaintextAlert(hdr)
 	case record.RecordTypeAck:
 		fmt.Printf("dtls: got ack record (plaintext) %d bytes from %v, message(hex): %x\n", len(hdr.Body), addr, hdr.Body)
 		// unencrypted acks can only acknowledge unencrypted messaged, so very niche, we simply ignore them
 		return conn, nil
 	case record.RecordTypeHandshake:
-		return t.receivedPlaintextHandshake(conn, hdr, addr)
+		return t.receivedPlaintextHandshake(shard, conn, hdr, addr, localAddr)
 	}
 	panic("unreacheable due to check in caller")
 }
 
-func (t *Transport) receivedPlaintextHandshake(conn *Connection, hdr record.Plaintext, addr netip.AddrPort) (*Connection, error) {
+func (t *Transport) receivedPlaintextHandshake(shard int, conn *Connection, hdr record.Plaintext, addr netip.AddrPort, localAddr netip.Addr) (*Connection, error) {
 	// fmt.Printf("dtls: got handshake record (plaintext) %d bytes from %v, message(hex): %x", len(recordData), addr, recordData)
 	if len(hdr.Body) == 0 {
 		// [rfc8446:5.1] Implementations MUST NOT send zero-length fragments of Handshake types, even if those fragments contain padding
@@ -59,7 +59,7 @@ func (t *Transport) receivedPlaintextHandshake(conn *Connection, hdr record.Plai
 				MsgSeq:  fragment.Header.MsgSeq,
 				Body:    fragment.Body,
 			}
-			conn, err = t.receivedClientHello(conn, msg, addr)
+			conn, err = t.receivedClientHello(shard, conn, msg, addr, localAddr)
 			if err != nil {
 				return conn, err
 			}
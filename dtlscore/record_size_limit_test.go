@@ -0,0 +1,120 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/hrissan/dtls/dtlserrors"
+	"github.com/hrissan/dtls/handshake"
+	"github.com/hrissan/dtls/record"
+)
+
+func TestRecordSizeLimit_Negotiation(t *testing.T) {
+	for _, tc := range []struct {
+		client, server         int
+		clientSend, serverSend uint16 // limits each side must respect
+	}{
+		{client: 0, server: 0, clientSend: 0, serverSend: 0},
+		{client: 0, server: 512, clientSend: 0, serverSend: 0}, // server only responds
+		{client: 256, server: 0, clientSend: record.MaxPlaintextRecordLength + 1, serverSend: 256},
+		{client: 300, server: 1000, clientSend: 1000, serverSend: 300},
+	} {
+		lb := newLoopback(t, func(clientOpts *Options, serverOpts *Options) {
+			clientOpts.RecordSizeLimit = tc.client
+			serverOpts.RecordSizeLimit = tc.server
+		})
+		lb.handshake()
+		if lb.clientConn.sendRecordSizeLimit != tc.clientSend || lb.serverConn().sendRecordSizeLimit != tc.serverSend {
+			t.Fatalf("client %d server %d: wrong negotiated limits client %d server %d", tc.client, tc.server,
+				lb.clientConn.sendRecordSizeLimit, lb.serverConn().sendRecordSizeLimit)
+		}
+	}
+}
+
+func TestRecordSizeLimit_ContentTypeCounted(t *testing.T) {
+	conn, _ := newEstablishedTestConnection(netip.MustParseAddrPort("127.0.0.1:1"))
+	conn.sendRecordSizeLimit = 256
+	var datagram [1500]byte
+	// [rfc8449:4] in TLS 1.3 limit includes content type and padding
+	if insideBody, ok := conn.prepareProtect(conn.keys.SendSymmetric, datagram[:], 5, 0); !ok || len(insideBody) != 255 {
+		t.Fatalf("record body must be limit - 1, got %d", len(insideBody))
+	}
+	if insideBody, ok := conn.prepareProtect(conn.keys.SendSymmetric, datagram[:], 5, 3); !ok || len(insideBody) != 252 {
+		t.Fatalf("record body must be limit - 1 - padding, got %d", len(insideBody))
+	}
+	opts := *conn.tr.opts
+	opts.RecordSizeLimit = 256
+	conn.keys.ReceiveSymmetric = conn.keys.SendSymmetric // only overhead is used
+	sealSize, _ := conn.keys.ReceiveSymmetric.RecordOverhead()
+	hdr := record.Encrypted{Ciphertext: make([]byte, 256+sealSize)}
+	if err := conn.checkReceivedRecordSize(&opts, hdr, record.NumberWith(3, 7)); err != nil {
+		t.Fatalf("record of limit size must be accepted, got %v", err)
+	}
+	hdr.Ciphertext = make([]byte, 257+sealSize)
+	if err := conn.checkReceivedRecordSize(&opts, hdr, record.NumberWith(3, 7)); err != dtlserrors.ErrRecordOverflow {
+		t.Fatalf("record over limit must be rejected, got %v", err)
+	}
+}
+
+func TestRecordSizeLimit_TooSmall(t *testing.T) {
+	conn, _ := newEstablishedTestConnection(netip.MustParseAddrPort("127.0.0.1:1"))
+	conn.hctx = newHandshakeContext(sha256.New())
+	body := []byte{0, 6, 0, 0x1c, 0, 2, 0, 63} // EncryptedExtensions with record_size_limit of 63
+	err := conn.hctx.receivedFullMessage(conn, handshake.Message{MsgType: handshake.MsgTypeEncryptedExtensions, Body: body})
+	// [rfc8449:4] MUST treat receipt of a smaller value as a fatal error and generate an "illegal_parameter" alert
+	if err != dtlserrors.ErrRecordSizeLimitTooSmall || dtlserrors.AlertFromError(err) != record.AlertFatal(record.AlertIllegalParameter) {
+		t.Fatalf("record_size_limit below 64 must be illegal_parameter, got %v", err)
+	}
+}
+
+func TestRecordSizeLimit_OutgoingRecords(t *testing.T) {
+	lb := newLoopback(t, func(clientOpts *Options, serverOpts *Options) {
+		clientOpts.RecordSizeLimit = 256
+	})
+	lb.handshake()
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	lb.send(lb.serverConn(), lb.serverHandler.handler, data)
+	lb.pump()
+	received := lb.clientHandler.received
+	if len(received) < 4 || !bytes.Equal(bytes.Join(received, nil), data) {
+		t.Fatalf("data must be split into several records, got %d records", len(received))
+	}
+	for _, r := range received {
+		if len(r) > 255 {
+			t.Fatalf("record of %d bytes exceeds peer's record_size_limit", len(r))
+		}
+	}
+	if lb.clientHandler.disconnected {
+		t.Fatalf("connection must stay open, got %v", lb.clientHandler.disconnectErr)
+	}
+}
+
+func TestRecordSizeLimit_Overflow(t *testing.T) {
+	lb := newLoopback(t, func(clientOpts *Options, serverOpts *Options) {
+		clientOpts.RecordSizeLimit = 256
+	})
+	lb.handshake()
+	server := lb.serverConn()
+	server.Lock()
+	server.sendRecordSizeLimit = 0 // server ignores client's limit
+	server.Unlock()
+	lb.send(server, lb.serverHandler.handler, bytes.Repeat([]byte{'x'}, 1000))
+	lb.pump()
+	if !lb.clientHandler.disconnected || !errors.Is(lb.clientHandler.disconnectErr, dtlserrors.ErrRecordOverflow) {
+		t.Fatalf("client must close connection with record_overflow, got %v", lb.clientHandler.disconnectErr)
+	}
+	var alertErr *dtlserrors.AlertError
+	serverErr := lb.serverHandler.handler.disconnectErr
+	if !errors.As(serverErr, &alertErr) || !alertErr.Remote || alertErr.Alert != record.AlertFatal(record.AlertRecordOverflow) {
+		t.Fatalf("server must receive fatal record_overflow alert, got %v", serverErr)
+	}
+	if len(lb.clientHandler.received) != 0 {
+		t.Fatalf("oversized record must not be delivered")
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hrissan/dtls/dtlserrors"
+	"github.com/hrissan/dtls/record"
+)
+
+// [rfc9147:5.8.2] Unless implementations have deployment-specific knowledge of more appropriate timer values,
+// they SHOULD use an initial timer value of 1000 ms and double the value at each retransmission,
+// up to no less than 60 seconds (the [rfc6298] maximum).
+const retransmitInitialTimeout = time.Second
+const retransmitMaxTimeout = 60 * time.Second
+
+// we have RTT estimate from acks, so we can go below [rfc6298] 1 second minimum
+const retransmitMinTimeout = 200 * time.Millisecond
+
+// [rfc6298:2] with 1 outstanding sample. Every record has unique number in DTLS 1.3,
+// so there is no retransmission ambiguity, and we need no Karn's algorithm.
+type rttEstimator struct {
+	srtt   time.Duration // 0 if no samples yet
+	rttvar time.Duration
+	rto    time.Duration // with exponential backoff applied, 0 means initial
+
+	sampleRN           record.Number
+	sampleSentUnixNano int64 // 0 if no sample in flight
+}
+
+func (e *rttEstimator) timeout() time.Duration {
+	if e.rto == 0 {
+		return retransmitInitialTimeout
+	}
+	return e.rto
+}
+
+func (e *rttEstimator) backoff() {
+	e.rto = min(e.timeout()*2, retransmitMaxTimeout)
+}
+
+func (e *rttEstimator) recordSent(rn record.Number) {
+	if e.sampleSentUnixNano != 0 {
+		return
+	}
+	e.sampleRN = rn
+	e.sampleSentUnixNano = time.Now().UnixNano()
+}
+
+func (e *rttEstimator) recordAcked(rn record.Number) {
+	if e.sampleSentUnixNano == 0 || e.sampleRN != rn {
+		return
+	}
+	e.addSample(time.Duration(time.Now().UnixNano() - e.sampleSentUnixNano))
+	e.sampleSentUnixNano = 0
+}
+
+func (e *rttEstimator) addSample(r time.Duration) {
+	if e.srtt == 0 {
+		e.srtt = r
+		e.rttvar = r / 2
+	} else {
+		delta := e.srtt - r
+		if delta < 0 {
+			delta = -delta
+		}
+		e.rttvar = (3*e.rttvar + delta) / 4
+		e.srtt = (7*e.srtt + r) / 8
+	}
+	// new sample also resets backoff
+	e.rto = min(max(e.srtt+4*e.rttvar, retransmitMinTimeout), retransmitMaxTimeout)
+}
+
+// Smoothed round-trip time estimated from acks, 0 if no samples yet.
+func (conn *Connection) RTTLocked() time.Duration {
+	return conn.rtt.srtt
+}
+
+// Current retransmission timeout, including exponential backoff.
+func (conn *Connection) RetransmitTimeoutLocked() time.Duration {
+	return conn.rtt.timeout()
+}
+
+// messages we sent (or will send), and peer did not acknowledge yet
+func (conn *Connection) hasUnackedLocked() bool {
+	if conn.hctx != nil && conn.hctx.sendQueue.Len() != 0 {
+		return true
+	}
+	if ex := conn.postHandshakeExchange(); ex != nil && ex.sendQueue.Len() != 0 {
+		return true
+	}
+	if conn.keyUpdateInProgress() {
+		return true
+	}
+	return conn.sendNewSessionTicketMessageSeq != 0
+}
+
+// returns false if nothing to resend
+func (conn *Connection) rewindUnackedLocked() bool {
+	rewound := false
+	if conn.hctx != nil && conn.hctx.sendQueue.Rewind() {
+		rewound = true
+	}
+	if ex := conn.postHandshakeExchange(); ex != nil && ex.sendQueue.Rewind() {
+		rewound = true
+	}
+	if conn.keyUpdateInProgress() && conn.sentKeyUpdateRN != (record.Number{}) {
+		conn.sentKeyUpdateRN = record.Number{}
+		rewound = true
+	}
+	if conn.sendNewSessionTicketMessageSeq != 0 && conn.sentNewSessionTicketRN != (record.Number{}) {
+		conn.sentNewSessionTicketRN = record.Number{}
+		rewound = true
+	}
+	return rewound
+}
+
+// called after each datagram constructed. Deadline is set when we have something
+// not acknowledged, and cleared lazily (timer fires, then finds nothing to do).
+func (conn *Connection) updateRetransmitDeadlineLocked() {
+	if conn.stateID == smIDClosed || conn.stateID == smIDShutdown || !conn.hasUnackedLocked() {
+		conn.retransmitDeadlineUnixNano = 0
+		conn.retransmits = 0
+		return
+	}
+	if conn.retransmitDeadlineUnixNano != 0 {
+		return
+	}
+	conn.retransmitDeadlineUnixNano = time.Now().Add(conn.rtt.timeout()).UnixNano()
+	conn.armTimerLocked()
+}
+
+func (conn *Connection) retransmitLocked() {
+	conn.retransmitDeadlineUnixNano = 0
+	if !conn.rewindUnackedLocked() {
+		return
+	}
+	if limit := conn.tr.opts.MaxRetransmissions; limit != 0 && int(conn.retransmits) >= limit { // widening
+		fmt.Printf("dtls: peer %v did not ack %d retransmissions, closing connection\n", conn.addr, conn.retransmits)
+		conn.shutdownOnTimeoutLocked(dtlserrors.ErrRetransmitLimit)
+		return
+	}
+	conn.retransmits++ // never overflows due to check above
+	conn.rtt.backoff()
+	conn.rtt.sampleSentUnixNano = 0 // sample record is most likely lost
+	conn.SignalWriteable()
+}
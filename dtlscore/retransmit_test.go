@@ -0,0 +1,94 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/hrissan/dtls/dtlserrors"
+	"github.com/hrissan/dtls/record"
+)
+
+func TestRTTEstimator(t *testing.T) {
+	var e rttEstimator
+	if e.timeout() != retransmitInitialTimeout {
+		t.Fatalf("wrong initial timeout")
+	}
+	for i := 0; i < 10; i++ {
+		e.backoff()
+	}
+	if e.timeout() != retransmitMaxTimeout {
+		t.Fatalf("backoff must be capped, got %v", e.timeout())
+	}
+	e.addSample(100 * time.Millisecond)
+	if e.srtt != 100*time.Millisecond || e.timeout() != 300*time.Millisecond {
+		t.Fatalf("wrong first sample srtt=%v rto=%v", e.srtt, e.timeout())
+	}
+	for i := 0; i < 100; i++ {
+		e.addSample(time.Millisecond)
+	}
+	if e.srtt > 2*time.Millisecond || e.timeout() != retransmitMinTimeout {
+		t.Fatalf("wrong stable srtt=%v rto=%v", e.srtt, e.timeout())
+	}
+	e.backoff()
+	if e.timeout() != 2*retransmitMinTimeout {
+		t.Fatalf("wrong backoff rto=%v", e.timeout())
+	}
+}
+
+func TestRetransmitLimit(t *testing.T) {
+	conn, _ := newEstablishedTestConnection(netip.MustParseAddrPort("127.0.0.1:1"))
+	opts := conn.tr.opts
+	opts.MaxRetransmissions = 2
+
+	if err := conn.RequestKeyUpdateLocked(false); err != nil {
+		t.Fatalf("failed to start KeyUpdate: %v", err)
+	}
+	var datagram [1500]byte
+	send := func() {
+		if _, _, datagramSize, _ := conn.constructDatagram(opts, datagram[:]); datagramSize == 0 {
+			t.Fatalf("KeyUpdate must be sent")
+		}
+	}
+	send()
+	for i := 0; i != opts.MaxRetransmissions; i++ {
+		conn.retransmitLocked()
+		send()
+	}
+	if err := conn.receivedEncryptedAckLocked(opts, ackRecordBody(record.NumberWith(3, 100)), record.NumberWith(3, 6)); err != nil {
+		t.Fatalf("failed to process ack: %v", err)
+	}
+	if conn.retransmits != 0 || !conn.keyUpdateInProgress() {
+		t.Fatalf("any ack must reset retransmission count")
+	}
+	for i := 0; i != opts.MaxRetransmissions; i++ {
+		conn.retransmitLocked()
+		send()
+	}
+	if conn.stateID == smIDShutdown {
+		t.Fatalf("connection must not be closed before MaxRetransmissions retransmissions")
+	}
+	conn.retransmitLocked()
+	if conn.stateID != smIDShutdown || !errors.Is(conn.closeErr, dtlserrors.ErrRetransmitLimit) {
+		t.Fatalf("connection must be closed after MaxRetransmissions retransmissions, got %v", conn.closeErr)
+	}
+}
+
+func TestClock_SetTimerFires(t *testing.T) {
+	cl := NewClock(false, 0)
+	go cl.GoRun()
+	defer cl.Close()
+	fired := make(chan struct{}, 1)
+	timer := Timer{fireFunc: func(*Timer) { fired <- struct{}{} }}
+	cl.SetTimer(&timer, time.Now().Add(time.Hour))
+	cl.SetTimer(&timer, time.Now().Add(10*time.Millisecond)) // moves earlier
+	select {
+	case <-fired:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timer did not fire")
+	}
+}
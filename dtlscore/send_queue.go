@@ -4,6 +4,7 @@
 package dtlscore
 
 import (
+	"github.com/hrissan/dtls/ciphersuite"
 	"github.com/hrissan/dtls/circular"
 	"github.com/hrissan/dtls/constants"
 	"github.com/hrissan/dtls/handshake"
@@ -30,6 +31,8 @@ type sendQueue struct {
 	// so linear search, but it is fast, see benchmarks
 	sentRecords        circular.BufferExt[record2Fragment]
 	sentRecordsStorage [constants.MaxSendRecordsQueue]record2Fragment
+
+	bodyBytes int // of messages in the queue, for memory accounting
 }
 
 func (sq *sendQueue) Reserve() {
@@ -47,6 +50,7 @@ func (sq *sendQueue) Clear() {
 	sq.messageOffset = 0
 	sq.fragmentOffset = 0
 	sq.sentRecords.Clear(sq.sentRecordsStorage[:])
+	sq.bodyBytes = 0
 }
 
 func (sq *sendQueue) PushMessage(msg handshake.Message) {
@@ -55,13 +59,16 @@ func (sq *sendQueue) PushMessage(msg handshake.Message) {
 		panic("too many messages are generated at once")
 	}
 	sq.messages.PushBack(sq.messagesStorage[:], partialHandshakeMsgFull(msg))
+	sq.bodyBytes += len(msg.Body)
 }
 
 func (sq *sendQueue) HasDataToSend() bool {
 	return sq.messageOffset < sq.messages.Len() && sq.sentRecords.Len() < sq.sentRecords.Cap(sq.sentRecordsStorage[:])
 }
 
-func (sq *sendQueue) ConstructDatagram(conn *Connection, opts *Options, datagram []byte) (
+// encrypted messages are sent with keys provided (epoch 2 during handshake, current keys post-handshake)
+func (sq *sendQueue) ConstructDatagram(conn *Connection, opts *Options, datagram []byte,
+	sendSymmetric ciphersuite.SymmetricKeys, sendEpoch uint16, sendNextSeq *uint64) (
 	datagramSize int, endDatagramNow bool, err error) {
 	for {
 		if sq.messageOffset > sq.messages.Len() {
@@ -89,7 +96,7 @@ func (sq *sendQueue) ConstructDatagram(conn *Connection, opts *Options, datagram
 			endDatagramNow = true
 		} else {
 			recordSize, fragmentInfo, rn, err = conn.constructHandshakeEncryptedRecord(
-				conn.hctx.SendSymmetricEpoch2, 2, &conn.hctx.SendNextSeqEpoch2,
+				sendSymmetric, sendEpoch, sendNextSeq,
 				opts, datagram[datagramSize:],
 				outgoing.Msg, fragmentOffset, fragmentLength)
 		}
@@ -105,6 +112,7 @@ func (sq *sendQueue) ConstructDatagram(conn *Connection, opts *Options, datagram
 		// Unfortunately, not in order because we have epoch 0 and need to resend ServerHello, so linear search
 		// limited to constants.MaxSendRecordsQueue due to check above
 		sq.sentRecords.PushBack(sq.sentRecordsStorage[:], record2Fragment{rn: rn, fragment: fragmentInfo})
+		conn.rtt.recordSent(rn)
 		datagramSize += recordSize
 		sq.fragmentOffset += fragmentInfo.FragmentLength
 		if endDatagramNow { // separate ClientHello/ServerHello into its own datagram
@@ -134,7 +142,7 @@ func findSentRecordIndexExt(elements []record2Fragment, sentRecords *circular.Bu
 	return nil
 }
 
-func (sq *sendQueue) Ack(conn *Connection, rn record.Number) {
+func (sq *sendQueue) Ack(rn record.Number) {
 	fragmentPtr := findSentRecordIndexExt(sq.sentRecordsStorage[:], &sq.sentRecords, rn)
 	if fragmentPtr == nil {
 		return
@@ -144,11 +152,12 @@ func (sq *sendQueue) Ack(conn *Connection, rn record.Number) {
 	for sq.sentRecords.Len() != 0 && sq.sentRecords.Front(sq.sentRecordsStorage[:]).fragment == (handshake.FragmentInfo{}) {
 		sq.sentRecords.PopFront(sq.sentRecordsStorage[:]) // delete everything from the front
 	}
-	if sq.messages.Len() > int(conn.nextMessageSeqSend) { // widening
-		panic("invariant violation")
+	if sq.messages.Len() == 0 {
+		return
 	}
-	// sq.messages end() is aligned with conn.nextMessageSeqSend
-	index := int(rec.MsgSeq) + sq.messages.Len() - int(conn.nextMessageSeqSend) // widening
+	// messages in the queue have consecutive sequence numbers, but not always aligned
+	// with conn.nextMessageSeqSend, because post-handshake KeyUpdate is sent separately
+	index := int(rec.MsgSeq) - int(sq.messages.FrontRef(sq.messagesStorage[:]).Msg.MsgSeq) // widening
 	if index < 0 || index >= sq.messages.Len() {
 		return
 	}
@@ -161,6 +170,20 @@ func (sq *sendQueue) Ack(conn *Connection, rn record.Number) {
 		} else {
 			sq.messageOffset--
 		}
+		sq.bodyBytes -= len(sq.messages.FrontRef(sq.messagesStorage[:]).Msg.Body)
 		sq.messages.PopFront(sq.messagesStorage[:])
 	}
 }
+
+// prepares to send all not yet acknowledged fragments again, returns false if nothing to resend
+func (sq *sendQueue) Rewind() bool {
+	if sq.messages.Len() == 0 {
+		return false
+	}
+	sq.messageOffset = 0
+	sq.fragmentOffset = 0
+	// records have unique numbers, so acks for previous transmission would still be valid,
+	// but we need space for new records, so we forget them
+	sq.sentRecords.Clear(sq.sentRecordsStorage[:])
+	return true
+}
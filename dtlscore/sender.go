@@ -13,8 +13,8 @@ import (
 type Sender interface {
 	// returns datagram from the storage pool or nil if pool is empty
 	PopHelloRetryDatagramStorage() *[constants.MaxOutgoingHRRDatagramLength]byte
-	// sends datagram and put datagram to the pool
-	SendHelloRetryDatagram(data *[constants.MaxOutgoingHRRDatagramLength]byte, size int, addr netip.AddrPort)
+	// sends datagram from localAddr (if valid) and put datagram to the pool
+	SendHelloRetryDatagram(data *[constants.MaxOutgoingHRRDatagramLength]byte, size int, addr netip.AddrPort, localAddr netip.Addr)
 	// adds connection to the send queue (with no duplicates)
 	RegisterConnectionForSend(conn *Connection)
 	// stops adding connections to the send queue
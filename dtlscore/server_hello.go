@@ -92,6 +92,25 @@ func (hctx *handshakeContext) generateClientHello(conn *Connection, setEpoch1Key
 	clientHello.Extensions.SignatureAlgorithms.ED448 = false
 	clientHello.Extensions.EncryptThenMacSet = false // not needed in DTLS1.3, but wolf sends it
 
+	clientHello.Extensions.PostHandshakeAuthSet = opts.PostHandshakeAuth
+	clientHello.Extensions.PlaintextSequenceNumberSet = opts.PlaintextSequenceNumbers
+
+	if opts.OCSPPolicy != OCSPPolicyIgnore {
+		clientHello.Extensions.StatusRequestSet = true
+		clientHello.Extensions.StatusRequest.OCSP = true
+	}
+
+	if opts.RecordSizeLimit != 0 {
+		clientHello.Extensions.RecordSizeLimitSet = true
+		clientHello.Extensions.RecordSizeLimit = opts.recordSizeLimit()
+	}
+
+	if opts.UseConnectionID {
+		clientHello.Extensions.ConnectionIDSet = true
+		clientHello.Extensions.ConnectionID = conn.receiveCIDLocked() // empty if we do not need it
+		clientHello.Extensions.RRCSet = true
+	}
+
 	if setCookie {
 		clientHello.Extensions.CookieSet = true
 		clientHello.Extensions.Cookie = ck
@@ -160,7 +179,7 @@ func (hctx *handshakeContext) generateClientHello(conn *Connection, setEpoch1Key
 
 		clientEarlyTrafficSecret := keys.DeriveSecret(hmacEarlySecret0, "c e traffic", clientHelloTranscriptHash)
 		fmt.Printf("client early traffic secret: %x\n", clientEarlyTrafficSecret.GetValue())
-		conn.keys.SendSymmetric = suite.ResetSymmetricKeys(conn.keys.SendSymmetric, clientEarlyTrafficSecret)
+		conn.keys.SendSymmetric = suite.ResetSymmetricKeys(conn.keys.SendSymmetric, clientEarlyTrafficSecret, false)
 		conn.keys.SendEpoch = 1
 		conn.debugPrintKeys()
 	}
@@ -0,0 +1,72 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"net/netip"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hrissan/dtls/constants"
+	"github.com/hrissan/dtls/dtlsrand"
+	"github.com/hrissan/dtls/transport/stats"
+)
+
+type countingSender struct {
+	hrrSent atomic.Int64
+}
+
+func (s *countingSender) PopHelloRetryDatagramStorage() *[constants.MaxOutgoingHRRDatagramLength]byte {
+	return &[constants.MaxOutgoingHRRDatagramLength]byte{}
+}
+
+func (s *countingSender) SendHelloRetryDatagram(data *[constants.MaxOutgoingHRRDatagramLength]byte, size int, addr netip.AddrPort, localAddr netip.Addr) {
+	s.hrrSent.Add(1)
+}
+
+func (s *countingSender) RegisterConnectionForSend(conn *Connection) {}
+func (s *countingSender) Shutdown()                                  {}
+
+func newShardedTestServer(shards int) (*Transport, []*countingSender) {
+	opts := DefaultTransportOptions(true, dtlsrand.CryptoRand(), stats.NewStatsLogQuiet())
+	opts.ALPNContinueOnMismatch = true
+	counting := make([]*countingSender, shards)
+	snds := make([]Sender, shards)
+	for i := range snds {
+		counting[i] = &countingSender{}
+		snds[i] = counting[i]
+	}
+	return NewShardedTransport(opts, snds, nil), counting
+}
+
+func clientHelloDatagram(t testing.TB) []byte {
+	opts := DefaultTransportOptions(false, dtlsrand.CryptoRand(), stats.NewStatsLogQuiet())
+	tr := NewTransport(opts, &statelessSender{}, nil)
+	var conn Connection
+	handler := disconnectHandler{disconnected: make(chan error, 1)}
+	if err := tr.StartConnection(&conn, &handler, netip.MustParseAddrPort("127.0.0.1:1")); err != nil {
+		t.Fatalf("failed to start connection: %v", err)
+	}
+	datagram := make([]byte, opts.PMTUMin)
+	_, _, size, _ := conn.constructDatagram(opts, datagram)
+	if size == 0 {
+		t.Fatalf("client must send ClientHello")
+	}
+	return datagram[:size]
+}
+
+func TestSharding_HelloRetryFromReceivingShard(t *testing.T) {
+	tr, snds := newShardedTestServer(4)
+	clientHello := clientHelloDatagram(t)
+	tr.ReceivedDatagramShard(2, clientHello, netip.MustParseAddrPort("127.0.0.1:2"), netip.Addr{}, nil)
+	for i, snd := range snds {
+		want := int64(0)
+		if i == 2 {
+			want = 1
+		}
+		if got := snd.hrrSent.Load(); got != want {
+			t.Fatalf("shard %d sent %d HelloRetryRequests, must send %d", i, got, want)
+		}
+	}
+}
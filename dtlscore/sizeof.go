@@ -38,12 +38,17 @@ type chacha20poly1305 struct {
 	Key [chacha20poly1305KeySize]byte
 }
 
+func sizeofHandshakeContext() int {
+	return int(unsafe.Sizeof(handshakeContext{})) // widening
+}
+
 // TODO - move this file to tests too check we did not accidentally increased sizeof()
 
 func PrintSizeofInfo() {
 	var fireFunc func(timer *Timer)
 	keys_TLS_AES_128_GCM_SHA256 := unsafe.Sizeof(ciphersuite.SymmetricKeysAES{}) + unsafe.Sizeof(gcm{}) + unsafe.Sizeof(aesBlock{})
 	keys_TLS_CHACHA20_POLY1305_SHA256 := unsafe.Sizeof(ciphersuite.SymmetricKeysChaCha20Poly1305{}) + unsafe.Sizeof(chacha20poly1305{})
+	keys_TLS_CHACHA20_POLY1305_SHA256_PlaintextSN := unsafe.Sizeof(ciphersuite.SymmetricKeysChaCha20Poly1305PlaintextSN{}) + unsafe.Sizeof(chacha20poly1305{})
 	fmt.Printf(
 		`Sizeof(various objects):
 func()             %d
@@ -54,13 +59,15 @@ Connection struct: %d (secrets + bookkeeping data, we add 3x size of keys, depen
 Keys TLS_AES_128_GCM_SHA256:
 Keys struct:       %d
 GCM:               %d (contains 1 AES inside, half of which is wasted)
-AES:               %d (half of which is wasted)
+AES:               %d (half of which is wasted, for sequence numbers)
            Total:  %d (%d if waste is removed)
+ Plaintext SN:     %d (AES for sequence numbers is not allocated, saves %d)
 ----
 Keys TLS_CHACHA20_POLY1305_SHA256:
-Keys struct:       %d
+Keys struct:       %d (contains 32-byte key for sequence numbers)
 CHACHA20_POLY1305: %d
            Total:  %d
+ Plaintext SN:     %d (keys struct without key for sequence numbers is %d, saves %d)
 `,
 		unsafe.Sizeof(fireFunc),
 		unsafe.Sizeof(Timer{}),
@@ -71,7 +78,12 @@ CHACHA20_POLY1305: %d
 		unsafe.Sizeof(aesBlock{}),
 		unsafe.Sizeof(Connection{})+3*keys_TLS_AES_128_GCM_SHA256,
 		unsafe.Sizeof(Connection{})+3*(keys_TLS_AES_128_GCM_SHA256-240),
+		unsafe.Sizeof(Connection{})+3*(keys_TLS_AES_128_GCM_SHA256-unsafe.Sizeof(aesBlock{})),
+		3*unsafe.Sizeof(aesBlock{}),
 		unsafe.Sizeof(ciphersuite.SymmetricKeysChaCha20Poly1305{}),
 		unsafe.Sizeof(chacha20poly1305{}),
-		unsafe.Sizeof(Connection{})+3*keys_TLS_CHACHA20_POLY1305_SHA256)
+		unsafe.Sizeof(Connection{})+3*keys_TLS_CHACHA20_POLY1305_SHA256,
+		unsafe.Sizeof(Connection{})+3*keys_TLS_CHACHA20_POLY1305_SHA256_PlaintextSN,
+		unsafe.Sizeof(ciphersuite.SymmetricKeysChaCha20Poly1305PlaintextSN{}),
+		3*(keys_TLS_CHACHA20_POLY1305_SHA256-keys_TLS_CHACHA20_POLY1305_SHA256_PlaintextSN))
 }
@@ -36,12 +36,14 @@ const (
 	smIDShutdown                         stateMachineStateID = iota
 	smIDClientSentHello                  stateMachineStateID = iota
 	smIDHandshakeServerCalcServerHello2  stateMachineStateID = iota
+	smIDHandshakeServerCalcCertVerify    stateMachineStateID = iota
 	smIDHandshakeServerExpectFinished    stateMachineStateID = iota
 	smIDHandshakeClientExpectServerHRR   stateMachineStateID = iota
 	smIDHandshakeClientExpectServerHello stateMachineStateID = iota
 	smIDHandshakeClientExpectEE          stateMachineStateID = iota
 	smIDHandshakeClientExpectCert        stateMachineStateID = iota
 	smIDHandshakeClientExpectCertVerify  stateMachineStateID = iota
+	smIDHandshakeClientCalcCertVerify    stateMachineStateID = iota
 	smIDHandshakeClientExpectFinished    stateMachineStateID = iota
 	smIDHandshakeClientExpectFinishedAck stateMachineStateID = iota
 	smIDPostHandshake                    stateMachineStateID = iota
@@ -51,13 +53,15 @@ var stateMachineStates = [...]StateMachine{
 	smIDClosed:                           &smClosed{},
 	smIDShutdown:                         &smClosed{},
 	smIDClientSentHello:                  &smClientSentHello1{},
-	smIDHandshakeServerCalcServerHello2:  &smHandshakeServerCalcServerHello2{},
+	smIDHandshakeServerCalcServerHello2:  &smHandshakeCalc{},
+	smIDHandshakeServerCalcCertVerify:    &smHandshakeCalc{},
 	smIDHandshakeServerExpectFinished:    &smHandshakeServerExpectFinished{},
 	smIDHandshakeClientExpectServerHRR:   &smHandshakeClientExpectServerHRR{},
 	smIDHandshakeClientExpectServerHello: &smHandshakeClientExpectServerHello{},
 	smIDHandshakeClientExpectEE:          &smHandshakeClientExpectEE{},
 	smIDHandshakeClientExpectCert:        &smHandshakeClientExpectCert{},
 	smIDHandshakeClientExpectCertVerify:  &smHandshakeClientExpectCertVerify{},
+	smIDHandshakeClientCalcCertVerify:    &smHandshakeCalc{},
 	smIDHandshakeClientExpectFinished:    &smHandshakeClientExpectFinished{},
 	smIDHandshakeClientExpectFinishedAck: &smPostHandshake{},
 	smIDPostHandshake:                    &smPostHandshake{},
@@ -16,22 +16,21 @@ type smHandshake struct {
 func (*smHandshake) OnHandshakeMsgFragment(conn *Connection, opts *Options,
 	fragment handshake.Fragment, rn record.Number) error {
 
-	if fragment.Header.MsgSeq < conn.hctx.firstMessageSeqInReceiveQueue(conn) {
+	if fragment.Header.MsgSeq < conn.hctx.receivedMessages.FirstMessageSeq(conn) {
 		// all messages before were processed by us in the state we already do not remember,
 		// so we must acknowledge unconditionally and do nothing.
-		conn.keys.AddAck(rn)
+		conn.addAckLocked(rn, true) // peer retransmitted, because our ack was lost
 		return nil
 	}
 	switch fragment.Header.MsgType {
 	case handshake.MsgTypeClientHello:
 		panic("TODO - should not be called, client_hello is special")
-	case handshake.MsgTypeNewSessionTicket:
-	case handshake.MsgTypeKeyUpdate:
+	case handshake.MsgTypeNewSessionTicket, handshake.MsgTypeKeyUpdate, handshake.MsgTypeCertificateRequest:
 		// we must never add post-handshake messages to received messages queue in Handshake,
 		// because we could partially acknowledge them, so later when we need to destroy conn.Handshake,
 		// we will not be able to throw them out (peer will never send fragments again), and we will not
 		// be able to process them immediately.
-		if fragment.Header.MsgSeq == conn.hctx.firstMessageSeqInReceiveQueue(conn) {
+		if fragment.Header.MsgSeq == conn.hctx.receivedMessages.FirstMessageSeq(conn) {
 			return dtlserrors.ErrPostHandshakeMessageDuringHandshake
 		}
 		// if not the first message, simply do not acknowledge and wait for the first message to be received
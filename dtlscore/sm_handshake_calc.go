@@ -0,0 +1,10 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+// waiting for computation (see handshake_compute.go), received messages are not delivered
+// in this state, so all message handlers are never called
+type smHandshakeCalc struct {
+	smHandshake
+}
@@ -4,14 +4,11 @@
 package dtlscore
 
 import (
-	"crypto/sha256"
-	"crypto/x509"
 	"fmt"
+	"time"
 
-	"github.com/hrissan/dtls/ciphersuite"
 	"github.com/hrissan/dtls/dtlserrors"
 	"github.com/hrissan/dtls/handshake"
-	"github.com/hrissan/dtls/signature"
 )
 
 type smHandshakeClientExpectCertVerify struct {
@@ -21,10 +18,6 @@ type smHandshakeClientExpectCertVerify struct {
 func (*smHandshakeClientExpectCertVerify) OnCertificateVerify(conn *Connection, msg handshake.Message, msgParsed handshake.MsgCertificateVerify) error {
 	hctx := conn.hctx
 	hctx.receivedNextFlight(conn)
-	// TODO - We do not want checks here, because receiving goroutine should not be blocked for long
-	// We have to first receive everything up to finished, probably send ack,
-	// then offload ECC to separate core and trigger state machine depending on result
-	// But, for now we check here
 	if hctx.certificateChain.CertificatesLength == 0 {
 		return dtlserrors.ErrCertificateChainEmpty
 	}
@@ -32,22 +25,26 @@ func (*smHandshakeClientExpectCertVerify) OnCertificateVerify(conn *Connection,
 		// TODO - more algorithms
 		return dtlserrors.ErrCertificateAlgorithmUnsupported
 	}
+	c := computation{
+		kind:      computeClientCertVerify,
+		certData:  hctx.certificateChain.Certificates[0].CertData,
+		signature: msgParsed.Signature,
+	}
 	// [rfc8446:4.4.3] - certificate verification
-	var certVerifyTranscriptHash ciphersuite.Hash
-	certVerifyTranscriptHash.SetSum(hctx.transcriptHasher)
-
-	// TODO - offload to calc goroutine here
-	sigMessageHash := signature.CalculateCoveredContentHash(sha256.New(), certVerifyTranscriptHash.GetValue())
+	c.transcriptHash.SetSum(hctx.transcriptHasher)
+	// if signature is invalid, connection is closed, so we can add message before check
+	msg.AddToHash(hctx.transcriptHasher)
+	conn.stateID = smIDHandshakeClientCalcCertVerify
+	return conn.startComputationLocked(conn.tr.opts, c)
+}
 
-	cert, err := x509.ParseCertificate(hctx.certificateChain.Certificates[0].CertData) // TODO - reuse certificates
-	if err != nil {
-		return dtlserrors.ErrCertificateLoadError
-	}
-	if err := signature.VerifySignature_RSA_PSS_RSAE_SHA256(cert, sigMessageHash.GetValue(), msgParsed.Signature); err != nil {
-		return dtlserrors.ErrCertificateSignatureInvalid
+func (conn *Connection) onServerCertVerifyCheckedLocked(opts *Options) error {
+	hctx := conn.hctx
+	if err := verifyOCSPStaple(opts, &hctx.certificateChain, time.Now()); err != nil {
+		return err
 	}
-	fmt.Printf("certificate verify ok: %+v\n", msgParsed)
-	msg.AddToHash(hctx.transcriptHasher)
+	fmt.Printf("certificate verify ok\n")
 	conn.stateID = smIDHandshakeClientExpectFinished
-	return nil
+	hctx.CanDeliveryMessages = true
+	return hctx.DeliverReceivedMessages(conn)
 }
@@ -6,6 +6,7 @@ package dtlscore
 import (
 	"github.com/hrissan/dtls/dtlserrors"
 	"github.com/hrissan/dtls/handshake"
+	"github.com/hrissan/dtls/record"
 )
 
 type smHandshakeClientExpectEE struct {
@@ -19,6 +20,19 @@ func (*smHandshakeClientExpectEE) OnEncryptedExtensions(conn *Connection, msg ha
 	if !conn.tr.opts.ALPNContinueOnMismatch && len(hctx.ALPNSelected) == 0 {
 		return dtlserrors.ErrALPNNoCompatibleProtocol
 	}
+	if msgParsed.RecordSizeLimitSet {
+		if conn.tr.opts.RecordSizeLimit == 0 {
+			return dtlserrors.ErrServerSentUnsolicitedRecordSizeLimit
+		}
+		// [rfc8449:4] we must not send records larger than protocol allows, even if peer allows it
+		conn.sendRecordSizeLimit = min(msgParsed.RecordSizeLimit, record.MaxPlaintextRecordLength+1)
+	}
+	if msgParsed.RRCSet {
+		if !conn.tr.opts.UseConnectionID {
+			return dtlserrors.ErrServerSentUnsolicitedRRC
+		}
+		conn.rrcNegotiated = true
+	}
 	if conn.hctx.pskSelected {
 		conn.stateID = smIDHandshakeClientExpectFinished
 	} else {
@@ -44,10 +44,17 @@ func (*smHandshakeClientExpectFinished) OnFinished(conn *Connection, msg handsha
 	}
 
 	conn.stateID = smIDHandshakeClientExpectFinishedAck
-	conn.keys.SendSymmetric = conn.keys.Suite().ResetSymmetricKeys(conn.keys.SendSymmetric, conn.keys.SendApplicationTrafficSecret)
+	conn.keys.SendSymmetric = conn.keys.Suite().ResetSymmetricKeys(conn.keys.SendSymmetric, conn.keys.SendApplicationTrafficSecret, conn.keys.DoNotEncryptSequenceNumbers)
 	conn.keys.SendEpoch = 3
+	conn.startSendKeysUsageLocked()
 	conn.debugPrintKeys()
 
 	// TODO - if server sent certificate_request, we should generate certificate, certificate_verify here
-	return hctx.PushMessage(conn, hctx.generateFinished(conn))
+	if err := hctx.PushMessage(conn, hctx.generateFinished(conn)); err != nil {
+		return err
+	}
+	if conn.tr.opts.PostHandshakeAuth {
+		conn.pha = newPostHandshakeAuth(hctx.transcriptHasher)
+	}
+	return nil
 }
@@ -4,7 +4,6 @@
 package dtlscore
 
 import (
-	"crypto/ecdh"
 	"fmt"
 
 	"github.com/hrissan/dtls/ciphersuite"
@@ -42,6 +41,22 @@ func (*smHandshakeClientExpectServerHello) OnServerHello(conn *Connection, msg h
 	if !msgParsed.Extensions.KeyShare.X25519PublicKeySet {
 		return dtlserrors.ErrParamsSupportKeyShare
 	}
+	if msgParsed.Extensions.ConnectionIDSet {
+		if !conn.tr.opts.UseConnectionID {
+			return dtlserrors.ErrServerSentUnsolicitedConnectionID
+		}
+		if err := conn.setSendCIDLocked(msgParsed.Extensions.ConnectionID); err != nil {
+			return err
+		}
+	} else {
+		conn.removeReceiveCIDLocked() // server will not use it
+	}
+	if msgParsed.Extensions.PlaintextSequenceNumberSet {
+		if !conn.tr.opts.PlaintextSequenceNumbers {
+			return dtlserrors.ErrServerSentUnsolicitedPlaintextSequenceNumber
+		}
+		conn.keys.DoNotEncryptSequenceNumbers = true // before handshake keys are computed
+	}
 	var pskStorage [256]byte
 	var psk []byte
 	if msgParsed.Extensions.PreSharedKeySet && conn.tr.opts.PSKAppendSecret != nil &&
@@ -55,19 +70,12 @@ func (*smHandshakeClientExpectServerHello) OnServerHello(conn *Connection, msg h
 	var handshakeTranscriptHash ciphersuite.Hash
 	handshakeTranscriptHash.SetSum(hctx.transcriptHasher)
 
-	// TODO - move to calculator goroutine
-	remotePublic, err := ecdh.X25519().NewPublicKey(msgParsed.Extensions.KeyShare.X25519PublicKey[:])
-	if err != nil {
-		panic("curve25519.X25519 failed")
-	}
-	sharedSecret, err := hctx.x25519Secret.ECDH(remotePublic)
-	if err != nil {
-		panic("curve25519.X25519 failed")
-	}
+	// not offloaded, we need handshake keys for the rest of the flight, see handshake_compute.go
+	sharedSecret := computeSharedSecret(hctx.x25519Secret, msgParsed.Extensions.KeyShare.X25519PublicKey)
 	hctx.earlySecret = keys.ComputeEarlySecret(conn.keys.Suite(), psk)
 	hctx.masterSecret, hctx.handshakeTrafficSecretSend, hctx.handshakeTrafficSecretReceive =
 		conn.keys.ComputeHandshakeKeys(suite, false, hctx.earlySecret, sharedSecret, handshakeTranscriptHash)
-	hctx.SendSymmetricEpoch2 = suite.ResetSymmetricKeys(hctx.SendSymmetricEpoch2, hctx.handshakeTrafficSecretSend)
+	hctx.SendSymmetricEpoch2 = suite.ResetSymmetricKeys(hctx.SendSymmetricEpoch2, hctx.handshakeTrafficSecretSend, conn.keys.DoNotEncryptSequenceNumbers)
 	conn.debugPrintKeys()
 
 	conn.stateID = smIDHandshakeClientExpectEE
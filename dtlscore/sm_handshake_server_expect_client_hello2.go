@@ -1,9 +0,0 @@
-// Copyright (c) 2025, Grigory Buteyko aka Hrissan
-// Licensed under the MIT License. See LICENSE for details.
-
-package dtlscore
-
-// TODO - remove
-type smHandshakeServerCalcServerHello2 struct {
-	smHandshake
-}
@@ -30,6 +30,12 @@ func (*smHandshakeServerExpectFinished) OnFinished(conn *Connection, msg handsha
 	}
 	fmt.Printf("finished message verify ok: %+v\n", msgParsed)
 
+	if hctx.postHandshakeAuth {
+		// [rfc8446:4.4] post-handshake authentication transcript includes client Finished
+		msg.AddToHash(hctx.transcriptHasher)
+		conn.pha = newPostHandshakeAuth(hctx.transcriptHasher)
+	}
+
 	if conn.keys.ReceiveEpoch != 2 { // should be [2] [.] or [1] [2] here
 		panic("unexpected receive epoch here")
 	}
@@ -39,11 +45,12 @@ func (*smHandshakeServerExpectFinished) OnFinished(conn *Connection, msg handsha
 	}
 
 	alpnSelected := conn.hctx.ALPNSelected
-	conn.hctx = nil
+	conn.releaseHandshakeLocked()
 	conn.debugPrintKeys()
 	// TODO - why wolf closes connection if we send application data immediately
 	// in the same datagram as ack. Reproduce on the latest version of us?
 	conn.stateID = smIDPostHandshake
+	conn.finishHandshakeTimerLocked()
 	conn.handler.OnHandshakeLocked(HandshakeInfo{ALPNSelected: alpnSelected})
 	conn.SignalWriteable()
 	return nil
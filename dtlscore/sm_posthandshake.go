@@ -4,6 +4,8 @@
 package dtlscore
 
 import (
+	"math"
+
 	"github.com/hrissan/dtls/dtlserrors"
 	"github.com/hrissan/dtls/handshake"
 	"github.com/hrissan/dtls/record"
@@ -13,27 +15,86 @@ type smPostHandshake struct{}
 
 func (*smPostHandshake) OnHandshakeMsgFragment(conn *Connection, opts *Options,
 	fragment handshake.Fragment, rn record.Number) error {
+	if ex := conn.postHandshakeExchange(); ex != nil {
+		// while post-handshake authentication is in progress, all messages go through the queue
+		if fragment.Header.MsgSeq < ex.receivedMessages.FirstMessageSeq(conn) {
+			conn.addAckLocked(rn, true) // peer retransmitted, because our ack was lost
+			return nil
+		}
+		return conn.receivedPostHandshakeFragment(opts, ex, fragment, rn)
+	}
 	if fragment.Header.MsgSeq < conn.nextMessageSeqReceive {
 		// all messages before were processed by us in the state we already do not remember,
 		// so we must acknowledge unconditionally and do nothing.
-		conn.keys.AddAck(rn)
+		conn.addAckLocked(rn, true)
 		return nil
 	}
 	if fragment.Header.MsgSeq > conn.nextMessageSeqReceive {
 		return nil // no message queue post hondshake, ignore
 	}
 	if fragment.Header.IsFragmented() {
+		if conn.pha != nil {
+			// certificates are large, so we allocate queue for reassembly
+			return conn.receivedPostHandshakeFragment(opts, conn.pha.startExchange(), fragment, rn)
+		}
 		// we do not support fragmented post handshake messages, because we do not want to allocate storage for them.
 		// They are short though, so we do not ack them, there is chance peer will resend them in full
 		return dtlserrors.WarnPostHandshakeMessageFragmented
 	}
-	switch fragment.Header.MsgType {
+	if conn.nextMessageSeqReceive == math.MaxUint16 {
+		return dtlserrors.ErrReceivedMessageSeqOverflow
+	}
+	conn.addAckLocked(rn, true)  // [rfc9147:5.8.1] each post-handshake message is a separate flight
+	conn.nextMessageSeqReceive++ // never due to check above
+	msg := handshake.Message{
+		MsgType: fragment.Header.MsgType,
+		MsgSeq:  fragment.Header.MsgSeq,
+		Body:    fragment.Body,
+	}
+	return conn.receivedPostHandshakeMessage(opts, msg)
+}
+
+func (conn *Connection) receivedPostHandshakeFragment(opts *Options, ex *postHandshakeContext,
+	fragment handshake.Fragment, rn record.Number) error {
+	changed, err := ex.receivedMessages.ReceivedFragment(conn, fragment, rn)
+	if err != nil || !changed {
+		return err
+	}
+	return conn.deliverPostHandshakeMessages(opts, ex)
+}
+
+// called when fully received message or when pending computation is applied
+func (conn *Connection) deliverPostHandshakeMessages(opts *Options, ex *postHandshakeContext) error {
+	// handlers can shut down connection or start computation
+	for conn.postHandshakeExchange() == ex && ex.computation.kind == computeNone {
+		msg, ok := ex.receivedMessages.PopFullMessage()
+		if !ok {
+			conn.pha.maybeFinishExchange()
+			return nil
+		}
+		if err := conn.receivedPostHandshakeMessage(opts, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (conn *Connection) receivedPostHandshakeMessage(opts *Options, msg handshake.Message) error {
+	switch msg.MsgType {
 	case handshake.MsgTypeClientHello:
 		panic("TODO - should not be called, client_hello is special")
 	case handshake.MsgTypeNewSessionTicket:
-		return conn.receivedNewSessionTicket(opts, fragment, rn)
+		return conn.receivedNewSessionTicket(opts, msg)
 	case handshake.MsgTypeKeyUpdate:
-		return conn.receivedKeyUpdate(opts, fragment, rn)
+		return conn.receivedKeyUpdate(opts, msg)
+	case handshake.MsgTypeCertificateRequest:
+		return conn.receivedCertificateRequest(opts, msg)
+	case handshake.MsgTypeCertificate:
+		return conn.receivedPostHandshakeCertificate(msg)
+	case handshake.MsgTypeCertificateVerify:
+		return conn.receivedPostHandshakeCertificateVerify(opts, msg)
+	case handshake.MsgTypeFinished:
+		return conn.receivedPostHandshakeFinished(msg)
 	}
 	return dtlserrors.ErrHandshakeMessagePostHandshake
 }
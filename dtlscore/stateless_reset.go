@@ -0,0 +1,75 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/hrissan/dtls/dtlserrors"
+	"github.com/hrissan/dtls/record"
+)
+
+// DTLS has no stateless reset, so when we receive ciphertext for unknown connection
+// (for example, after restart), we reply with plaintext alert. Plaintext alerts can be
+// spoofed, so we put last 6 bytes of received datagram (part of AEAD tag) into 48-bit
+// sequence number of the alert record. Only peer (or on-path attacker, who can disrupt
+// connection anyway) knows those bytes, so peer can check the alert is a reply to its datagram.
+const statelessResetSize = record.PlaintextRecordHeaderSize + record.AlertSize
+
+const statelessResetTailSize = 6 // bytes of datagram echoed in sequence number
+
+func datagramTail(datagram []byte) uint64 {
+	var tail [8]byte
+	copy(tail[8-statelessResetTailSize:], datagram[len(datagram)-statelessResetTailSize:])
+	return binary.BigEndian.Uint64(tail[:])
+}
+
+func (t *Transport) allowStatelessReset(nowUnixNano int64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.resetBucket.allow(nowUnixNano, t.opts.MaxStatelessResetsPerSecond)
+}
+
+func (t *Transport) sendStatelessReset(shard int, datagram []byte, addr netip.AddrPort, localAddr netip.Addr) {
+	if len(datagram) < statelessResetSize {
+		return // we never send more than we received
+	}
+	if !t.allowStatelessReset(time.Now().UnixNano()) {
+		return
+	}
+	snd := t.snds[shard] // reset is sent from the socket datagram arrived on
+	data := snd.PopHelloRetryDatagramStorage()
+	if data == nil {
+		return // queue full, rate limit is too high for our sender
+	}
+	recordHdr := record.PlaintextHeader{
+		ContentType:    record.RecordTypeAlert,
+		SequenceNumber: datagramTail(datagram),
+	}
+	alert := dtlserrors.AlertFromError(dtlserrors.WarnCiphertextNoConnection)
+	da := recordHdr.Write((*data)[:0], record.AlertSize)
+	da = alert.Write(da)
+	snd.SendHelloRetryDatagram(data, len(da), addr, localAddr)
+}
+
+// plaintext alert is a stateless reset, if it echoes our last sent datagram
+func (conn *Connection) receivedPlaintextAlert(hdr record.Plaintext) error {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	var alert record.Alert
+	if err := alert.Parse(hdr.Body); err != nil {
+		return err
+	}
+	fmt.Printf("dtls: got alert record (plaintext) %v from %v\n", alert, conn.addr)
+	if conn.sentDatagramTail == 0 || hdr.SequenceNumber != conn.sentDatagramTail {
+		// anyone can send plaintext alert, so we ignore it, and handshake will eventually time out
+		return nil
+	}
+	// peer has no keys, so cannot receive our alert
+	_ = conn.shutdownLocked(record.Alert{}, &dtlserrors.AlertError{Alert: alert, Remote: true, Err: dtlserrors.ErrPeerLostConnection})
+	return nil
+}
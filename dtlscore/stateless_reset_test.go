@@ -0,0 +1,66 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/hrissan/dtls/constants"
+	"github.com/hrissan/dtls/dtlsrand"
+	"github.com/hrissan/dtls/record"
+)
+
+type statelessSender struct {
+	sent [][]byte
+}
+
+func (s *statelessSender) PopHelloRetryDatagramStorage() *[constants.MaxOutgoingHRRDatagramLength]byte {
+	return &[constants.MaxOutgoingHRRDatagramLength]byte{}
+}
+
+func (s *statelessSender) SendHelloRetryDatagram(data *[constants.MaxOutgoingHRRDatagramLength]byte, size int, addr netip.AddrPort, localAddr netip.Addr) {
+	s.sent = append(s.sent, append([]byte{}, data[:size]...))
+}
+
+func (s *statelessSender) RegisterConnectionForSend(conn *Connection) {}
+func (s *statelessSender) Shutdown()                                  {}
+
+func TestStatelessReset_EchoAndLimits(t *testing.T) {
+	snd := &statelessSender{}
+	opts := DefaultTransportOptions(true, dtlsrand.CryptoRand(), nil)
+	opts.MaxStatelessResetsPerSecond = 2
+	tr := NewTransport(opts, snd, nil)
+
+	datagram := make([]byte, 40)
+	for i := range datagram {
+		datagram[i] = byte(i)
+	}
+	tr.sendStatelessReset(0, datagram[:statelessResetSize-1], netip.AddrPort{}, netip.Addr{}) // amplification
+	if len(snd.sent) != 0 {
+		t.Fatalf("reset must not be larger than received datagram")
+	}
+	for i := 0; i < 5; i++ {
+		tr.sendStatelessReset(0, datagram, netip.AddrPort{}, netip.Addr{})
+	}
+	if len(snd.sent) != 2 {
+		t.Fatalf("rate limit failed, %d resets sent", len(snd.sent))
+	}
+	var hdr record.Plaintext
+	n, err := hdr.Parse(snd.sent[0])
+	if err != nil || n != len(snd.sent[0]) || hdr.ContentType != record.RecordTypeAlert {
+		t.Fatalf("failed to parse reset: %v", err)
+	}
+	if hdr.SequenceNumber != 0x222324252627 {
+		t.Fatalf("reset must echo datagram tail, got %x", hdr.SequenceNumber)
+	}
+	var alert record.Alert
+	if err := alert.Parse(hdr.Body); err != nil || !alert.IsFatal() {
+		t.Fatalf("failed to parse reset alert: %v", err)
+	}
+	if !tr.allowStatelessReset(time.Now().Add(time.Second).UnixNano()) {
+		t.Fatalf("rate limit must refill")
+	}
+}
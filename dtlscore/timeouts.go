@@ -0,0 +1,130 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hrissan/dtls/dtlserrors"
+	"github.com/hrissan/dtls/record"
+)
+
+// We have single timer per connection for retransmission, handshake and idle deadlines,
+// so established connection pays only for Timer and lastReceiveUnixNano.
+// Handshake deadline is stored in handshakeContext.
+
+func earlierDeadline(a int64, b int64) int64 {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// 0 if we wait for nothing
+func (conn *Connection) nextDeadlineLocked(opts *Options) int64 {
+	if conn.stateID == smIDClosed || conn.stateID == smIDShutdown {
+		return 0
+	}
+	deadline := earlierDeadline(conn.retransmitDeadlineUnixNano, conn.pathDeadlineLocked())
+	deadline = earlierDeadline(deadline, conn.pmtu.deadlineUnixNano)
+	deadline = earlierDeadline(deadline, conn.ackDeadlineUnixNano)
+	deadline = earlierDeadline(deadline, conn.keyUpdateDeadlineLocked(opts))
+	deadline = earlierDeadline(deadline, conn.keepaliveDeadlineLocked(opts))
+	if conn.hctx != nil {
+		deadline = earlierDeadline(deadline, conn.hctx.deadlineUnixNano)
+	} else if opts.IdleTimeout > 0 && conn.lastReceiveUnixNano != 0 {
+		deadline = earlierDeadline(deadline, conn.lastReceiveUnixNano+int64(opts.IdleTimeout))
+	}
+	return deadline
+}
+
+// Clock ignores deadline if timer is already set to fire earlier, so moving deadlines
+// forward (for example, on each received record) costs nothing, timer fires and we set it again.
+func (conn *Connection) armTimerLocked() {
+	deadline := conn.nextDeadlineLocked(conn.tr.opts)
+	if deadline == 0 {
+		return
+	}
+	if conn.timer.fireFunc == nil {
+		conn.timer.fireFunc = conn.onTimer
+	}
+	conn.tr.clock.SetTimer(&conn.timer, time.Unix(0, deadline))
+}
+
+// called when handshake context is created
+func (conn *Connection) startHandshakeTimerLocked(opts *Options) {
+	if conn.timer.fireFunc == nil { // must be set before handshake can be evicted
+		conn.timer.fireFunc = conn.onTimer
+	}
+	now := time.Now().UnixNano()
+	conn.lastReceiveUnixNano = now
+	if opts.HandshakeTimeout > 0 {
+		conn.hctx.deadlineUnixNano = now + int64(opts.HandshakeTimeout)
+	}
+	conn.armTimerLocked()
+}
+
+// called when handshake context is destroyed, so idle deadline and path MTU search can start
+func (conn *Connection) finishHandshakeTimerLocked() {
+	conn.lastReceiveUnixNano = time.Now().UnixNano()
+	conn.startPMTUSearchLocked(conn.tr.opts)
+	conn.armTimerLocked()
+}
+
+func (conn *Connection) onTimer(*Timer) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	opts := conn.tr.opts
+	now := time.Now().UnixNano()
+	if conn.stateID == smIDClosed || conn.stateID == smIDShutdown {
+		return
+	}
+	if hctx := conn.hctx; hctx != nil && conn.tr.isHandshakeEvicted(hctx) {
+		opts.Stats.HandshakeEvicted(conn.addr)
+		conn.shutdownOnTimeoutLocked(dtlserrors.ErrHandshakeEvicted)
+		return
+	}
+	if hctx := conn.hctx; hctx != nil && hctx.deadlineUnixNano != 0 && now >= hctx.deadlineUnixNano {
+		fmt.Printf("dtls: handshake with %v did not finish in %v, closing connection\n", conn.addr, opts.HandshakeTimeout)
+		conn.shutdownOnTimeoutLocked(dtlserrors.ErrHandshakeTimeout)
+		return
+	}
+	if conn.hctx == nil && opts.IdleTimeout > 0 && conn.lastReceiveUnixNano != 0 &&
+		now >= conn.lastReceiveUnixNano+int64(opts.IdleTimeout) {
+		fmt.Printf("dtls: nothing received from %v in %v, closing connection\n", conn.addr, opts.IdleTimeout)
+		conn.shutdownOnTimeoutLocked(dtlserrors.ErrIdleTimeout)
+		return
+	}
+	if conn.onKeepaliveTimerLocked(opts, now) {
+		return
+	}
+	if conn.ackDeadlineUnixNano != 0 && now >= conn.ackDeadlineUnixNano {
+		conn.onAckTimerLocked()
+	}
+	if deadline := conn.pathDeadlineLocked(); deadline != 0 && now >= deadline {
+		conn.onPathTimerLocked(opts)
+	}
+	if deadline := conn.pmtu.deadlineUnixNano; deadline != 0 && now >= deadline {
+		conn.onPMTUTimerLocked(opts)
+	}
+	if deadline := conn.keyUpdateDeadlineLocked(opts); deadline != 0 && now >= deadline {
+		fmt.Printf("dtls: send keys to %v are used for %v, starting KeyUpdate\n", conn.addr, opts.KeyUpdateInterval)
+		if err := conn.RequestKeyUpdateLocked(false); err != nil {
+			_ = conn.failLocked(err)
+			return
+		}
+	}
+	if conn.retransmitDeadlineUnixNano != 0 && now >= conn.retransmitDeadlineUnixNano {
+		conn.retransmitLocked()
+	}
+	conn.armTimerLocked()
+}
+
+// [rfc8446:6.1] user_canceled must be followed by close_notify, which alone also cancels handshake,
+// so we send close_notify in both cases. Peer is probably gone anyway.
+func (conn *Connection) shutdownOnTimeoutLocked(err error) {
+	alert := record.AlertCloseNormal()
+	_ = conn.shutdownLocked(alert, &dtlserrors.AlertError{Alert: alert, Err: err})
+}
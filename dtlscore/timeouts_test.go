@@ -0,0 +1,95 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/hrissan/dtls/dtlserrors"
+	"github.com/hrissan/dtls/record"
+)
+
+type disconnectHandler struct {
+	disconnected chan error
+}
+
+func (h *disconnectHandler) OnConnectLocked()                     {}
+func (h *disconnectHandler) OnHandshakeLocked(info HandshakeInfo) {}
+func (h *disconnectHandler) OnDisconnectLocked(err error)         { h.disconnected <- err }
+func (h *disconnectHandler) OnWriteRecordLocked(earlyData bool, recordBody []byte) (int, bool, bool, error) {
+	return 0, false, false, nil
+}
+func (h *disconnectHandler) OnReadRecordLocked(earlyData bool, recordBody []byte) error            { return nil }
+func (h *disconnectHandler) OnClientAuthenticationLocked(info ClientAuthenticationInfo, err error) {}
+func (h *disconnectHandler) OnAddressChangedLocked(oldAddr netip.AddrPort, newAddr netip.AddrPort) {}
+func (h *disconnectHandler) OnPathMTUChangedLocked(pathMTU int)                                    {}
+
+// timer handler is called directly with handshake deadline moved back, so no sleeps
+func TestHandshakeTimeout(t *testing.T) {
+	lb := newLoopback(t, func(clientOpts *Options, serverOpts *Options) {
+		clientOpts.HandshakeTimeout = time.Minute
+	})
+	lb.drop = func(fromClient bool, datagram []byte) bool { return !fromClient } // server is not reachable
+	lb.pump()
+	client := &lb.clientConn
+	elapse := func(d time.Duration) {
+		client.Lock()
+		if client.hctx == nil || client.hctx.deadlineUnixNano == 0 || client.nextDeadlineLocked(client.tr.opts) > client.hctx.deadlineUnixNano {
+			t.Fatalf("handshake deadline must be armed")
+		}
+		client.hctx.deadlineUnixNano -= int64(d)
+		client.Unlock()
+		client.onTimer(nil)
+		lb.pump()
+	}
+	elapse(59 * time.Second)
+	if lb.clientHandler.disconnected {
+		t.Fatalf("handshake must not be cancelled before HandshakeTimeout")
+	}
+	elapse(2 * time.Second)
+	if !lb.clientHandler.disconnected || !errors.Is(lb.clientHandler.disconnectErr, dtlserrors.ErrHandshakeTimeout) {
+		t.Fatalf("handshake must be cancelled with handshake timeout, got %v", lb.clientHandler.disconnectErr)
+	}
+}
+
+// timer handler is called directly with lastReceiveUnixNano moved back, so no sleeps
+func TestIdleTimeout(t *testing.T) {
+	lb := newLoopback(t, func(clientOpts *Options, serverOpts *Options) {
+		serverOpts.IdleTimeout = time.Minute
+	})
+	lb.handshake()
+	server := lb.serverConn()
+	idleFor := func(d time.Duration) {
+		server.Lock()
+		server.lastReceiveUnixNano = time.Now().UnixNano() - int64(d)
+		if deadline := server.nextDeadlineLocked(server.tr.opts); deadline == 0 || deadline > server.lastReceiveUnixNano+int64(time.Minute) {
+			t.Fatalf("idle deadline must be armed")
+		}
+		server.Unlock()
+		server.onTimer(nil)
+		lb.pump()
+	}
+	idleFor(59 * time.Second)
+	if lb.serverHandler.handler.disconnected {
+		t.Fatalf("connection must not be closed before IdleTimeout")
+	}
+	before := time.Now().UnixNano()
+	lb.send(&lb.clientConn, &lb.clientHandler, []byte("ping"))
+	lb.pump()
+	if server.lastReceiveUnixNano < before {
+		t.Fatalf("authenticated record must prolong connection")
+	}
+	idleFor(61 * time.Second)
+	if !lb.serverHandler.handler.disconnected || !errors.Is(lb.serverHandler.handler.disconnectErr, dtlserrors.ErrIdleTimeout) {
+		t.Fatalf("connection must be closed with idle timeout, got %v", lb.serverHandler.handler.disconnectErr)
+	}
+	var alertErr *dtlserrors.AlertError
+	clientErr := lb.clientHandler.disconnectErr
+	if !errors.As(clientErr, &alertErr) || !alertErr.Remote || alertErr.Alert != record.AlertCloseNormal() {
+		t.Fatalf("client must receive close_notify, got %v", clientErr)
+	}
+}
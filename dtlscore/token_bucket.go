@@ -0,0 +1,31 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlscore
+
+import "time"
+
+// simple token bucket, burst equals rate, caller protects it with a mutex
+type tokenBucket struct {
+	tokens         int
+	refillUnixNano int64
+}
+
+func (b *tokenBucket) allow(nowUnixNano int64, rate int) bool {
+	if rate <= 0 {
+		return false
+	}
+	elapsed := nowUnixNano - b.refillUnixNano
+	if elapsed >= int64(time.Second) {
+		b.tokens = rate
+		b.refillUnixNano = nowUnixNano
+	} else if refill := elapsed * int64(rate) / int64(time.Second); refill > 0 { // widening
+		b.tokens = min(b.tokens+int(refill), rate) // truncation, refill <= rate
+		b.refillUnixNano = nowUnixNano
+	}
+	if b.tokens == 0 {
+		return false
+	}
+	b.tokens--
+	return true
+}
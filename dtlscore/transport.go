@@ -4,11 +4,13 @@
 package dtlscore
 
 import (
-	"net/netip"
+	"hash/maphash"
 	"sync"
+	"sync/atomic"
 
 	"github.com/hrissan/dtls/circular"
 	"github.com/hrissan/dtls/cookie"
+	"github.com/hrissan/dtls/intrusive"
 	"github.com/hrissan/dtls/record"
 )
 
@@ -16,60 +18,115 @@ type Transport struct {
 	opts        *Options
 	handler     TransportHandler
 	cookieState cookie.CookieState
-	snd         Sender
+	snds        []Sender // one per socket, see Connection.shard
+	clock       *Clock
+	compute     *ComputePool
+	keyShares   *KeySharePool
+
+	staple atomic.Pointer[[]byte] // OCSP response sent by server, replaced by refresh
 
 	// Each connection is either
 	// 1. closed, not in map, in the pool
 	// 2. closed, not in map, will be added to the pool very soon by sender
 	// 3. !closed, in the map, not in the pool
 	// To make this possible, order of locks is
-	// transport.Lock() // normal lookup of connection (per datagram)
-	// conn.Lock(), transport.Lock()  // for adding/removing to the map and adding to the pool
+	// shard.Lock() // normal lookup of connection (per datagram), see conn_map.go
+	// conn.Lock(), shard.Lock() // for adding/removing to the map
+	// conn.Lock(), transport.Lock() // for adding to the pool
 	// transport.Lock() // for removing from the pool
-	//
+	// shard and transport locks are never held together
 
 	// ClientHello with correct cookie and larger timestamp replaces
 	// previous handshake or established connection here [rfc9147:5.11].
+	mapSeed   maphash.Seed
+	addrSeed  uint64
+	mapShards [connMapShards]connMapShard
+	shutdown  atomic.Bool
+
 	mu                 sync.Mutex
-	connMap            map[netip.AddrPort]*Connection
 	connPool           circular.Buffer[*Connection]
 	createdConnections int // some are in pool, others are somewhere else
-	shutdown           bool
+	nextClientShard    int // client connections are distributed between sockets round-robin
+
+	resetBucket tokenBucket // rate limit for stateless resets
+
+	icmpLimiters []icmpLimiter // one per socket, see icmp.go
 
-	// TODO - limit on max number of parallel handshakes, clear items by LRU
+	// handshakes ordered by progress time, front is the most stalled, see handshake_budget.go
+	handshakes         intrusive.IntrusiveHeap[handshakeContext]
+	handshakeMemory    int // including reserved
+	handshakeEvictions int
+	reservedHandshakes int // slots reserved, but not yet added to handshakes
 }
 
 func NewTransport(opts *Options, snd Sender, handler TransportHandler) *Transport {
+	return NewShardedTransport(opts, []Sender{snd}, handler)
+}
+
+// Several sockets (usually bound to the same address with SO_REUSEPORT) feed the same transport,
+// each socket has its own sender. Datagrams from socket with index shard must be passed to
+// ReceivedDatagramShard, connections stick to the socket their first datagram arrived on.
+func NewShardedTransport(opts *Options, snds []Sender, handler TransportHandler) *Transport {
+	if len(snds) == 0 || len(snds) > maxShards {
+		panic("number of senders must be between 1 and 256")
+	}
 	t := &Transport{
-		opts:    opts,
-		snd:     snd,
-		handler: handler,
+		opts:         opts,
+		snds:         snds,
+		handler:      handler,
+		clock:        NewClock(opts.Preallocate, opts.MaxConnections),
+		compute:      NewComputePool(opts),
+		keyShares:    NewKeySharePool(opts),
+		icmpLimiters: make([]icmpLimiter, len(snds)),
 	}
 	t.cookieState.SetRand(opts.Rnd)
+	t.SetOCSPStaple(opts.ServerCertificate.OCSPStaple)
 	if opts.Preallocate {
-		t.connMap = make(map[netip.AddrPort]*Connection, opts.MaxConnections)
+		t.handshakes = *intrusive.NewIntrusiveHeap(handshakeHeapPred, opts.MaxHandshakes)
 		if t.opts.RoleServer {
 			t.connPool.Reserve(opts.MaxConnections)
 		}
 	} else {
-		t.connMap = map[netip.AddrPort]*Connection{}
+		t.handshakes = *intrusive.NewIntrusiveHeap(handshakeHeapPred, 0)
 	}
+	t.initConnMaps(opts)
 	return t
 }
 
+const maxShards = 256 // Connection.shard is uint8
+
 func (t *Transport) Options() *Options {
 	return t.opts
 }
 
+// Clock.GoRun() must be run by transport owner, otherwise nothing is retransmitted
+func (t *Transport) Clock() *Clock {
+	return t.clock
+}
+
+// ComputePool.GoRun() must be run by transport owner Options.ComputeGoroutines times,
+// otherwise handshakes never finish
+func (t *Transport) ComputePool() *ComputePool {
+	return t.compute
+}
+
+// KeySharePool.GoRun() should be run by transport owner, if Options.KeySharePoolSize != 0
+func (t *Transport) KeySharePool() *KeySharePool {
+	return t.keyShares
+}
+
 // send notify to all connections, close socket
 func (t *Transport) Shutdown() {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-	t.shutdown = true
-	for _, conn := range t.connMap {
-		conn.Shutdown(record.Alert{Level: record.AlerLevelFatal, Description: 0}) // close_notify
+	t.shutdown.Store(true)
+	for _, conn := range t.appendConnections(nil) {
+		conn.Shutdown(record.AlertCloseNormal())
 	}
-	t.snd.Shutdown()
+	for _, snd := range t.snds {
+		snd.Shutdown()
+	}
+	t.clock.Close()
+	t.compute.Close()
+	t.keyShares.Close()
 }
 
 func (t *Transport) getFromPool() *Connection {
@@ -102,32 +159,10 @@ func (t *Transport) getFromPoolLocked() (*Connection, bool) {
 	return nil, true // will be created without lock
 }
 
-// call under connection's mutex to maintain state invariant that
-// closed connections are not in the map, while !closed are in the map
-func (t *Transport) addToMap(conn *Connection, addr netip.AddrPort) {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-	if _, ok := t.connMap[addr]; ok {
-		panic("connection magically appeared in the map")
-	}
-	t.connMap[addr] = conn
-}
-
-// call under connection's mutex to maintain state invariant that
-// closed connections are not in the map, while !closed are in the map
-func (t *Transport) removeFromMap(conn *Connection, addr netip.AddrPort, returnToPool bool) {
+func (t *Transport) nextShardForClient() uint8 {
 	t.mu.Lock()
 	defer t.mu.Unlock()
-	c2, ok := t.connMap[addr]
-	if !ok || c2 != conn {
-		panic("connection magically replaced in the map")
-	}
-	delete(t.connMap, addr)
-	if returnToPool {
-		if t.opts.RoleServer { // For now, reuse connections on server only
-			t.connPool.PushBack(conn)
-		} else {
-			t.createdConnections--
-		}
-	}
+	shard := t.nextClientShard
+	t.nextClientShard = (t.nextClientShard + 1) % len(t.snds)
+	return uint8(shard) // truncation, checked in NewShardedTransport
 }
@@ -4,8 +4,9 @@
 package dtlserrors
 
 import (
-	"errors"
 	"fmt"
+
+	"github.com/hrissan/dtls/record"
 )
 
 // we want no allocations on error returning path,
@@ -14,6 +15,7 @@ import (
 
 type Error struct {
 	fatal bool
+	alert byte // description of alert we send, if error closes connection
 	code  int
 	text  string
 }
@@ -22,9 +24,13 @@ func (e *Error) Fatal() bool {
 	return e.fatal
 }
 
+func (e *Error) Alert() byte {
+	return e.alert
+}
+
 func (e *Error) Error() string {
 	if e.fatal {
-		return fmt.Sprintf("dtls (fatal): %d %s", e.code, e.text)
+		return fmt.Sprintf("dtls (fatal): %d %s (%s)", e.code, e.text, record.AlertDescriptionName(e.alert))
 	}
 	return fmt.Sprintf("dtls (warning): %d %s", e.code, e.text)
 }
@@ -39,104 +45,182 @@ func IsFatal(err error) bool { // we do not use errors package for now
 	return true // TODO - panic here after we replace all error with dtlserrors.Error
 }
 
-func NewFatal(code int, text string) error {
+// alert we send when err closes connection. Errors returned
+// by application or not converted yet are internal errors.
+func AlertFromError(err error) record.Alert {
+	if e, ok := err.(*Error); ok {
+		return record.AlertFatal(e.alert)
+	}
+	return record.AlertFatal(record.AlertInternalError)
+}
+
+// parsers return our errors for well-formed messages with illegal values, those have their own alerts,
+// other parsing errors are replaced by decodeErr of the caller
+func ParsingError(err error, decodeErr error) error {
+	if _, ok := err.(*Error); ok {
+		return err
+	}
+	return decodeErr
+}
+
+func NewFatal(code int, alert byte, text string) error {
 	return &Error{
 		fatal: true,
+		alert: alert,
 		code:  code,
 		text:  text,
 	}
 }
 
-func NewWarning(code int, text string) error {
+func NewWarning(code int, alert byte, text string) error {
 	return &Error{
 		fatal: false,
+		alert: alert,
 		code:  code,
 		text:  text,
 	}
 }
 
-var WarnServerHelloFragmented = NewWarning(-398, "fragmented ServerHello message not supported")
-var WarnClientHelloFragmented = NewWarning(-399, "fragmented ClientHello message not supported")
-var WarnPostHandshakeMessageFragmented = NewWarning(-400, "fragmented post-handshake message not supported by this implementation, waiting for retransmission")
-var WarnAckEpochSeqnumOverflow = NewWarning(-403, "ack record epoch overflows 2^16")
-var WarnPlaintextRecordParsing = NewWarning(-405, "plaintext record header failed to parse")
-var WarnCiphertextRecordParsing = NewWarning(-406, "ciphertext record header failed to parse")
-var WarnCiphertextNoConnection = NewWarning(-407, "received ciphertext without connection")
-var WarnFailedToDeprotectRecord = NewWarning(-408, "failed to deprotect encrypted record")
-var WarnPlaintextHandshakeMessageHeaderParsing = NewWarning(-409, "plaintext handshake message header failed to parse")
-var WarnPlaintextClientHelloParsing = NewWarning(-410, "plaintext ClientHello message failed to parse")
-var WarnPlaintextServerHelloParsing = NewWarning(-411, "plaintext ServerHello message failed to parse")
-var WarnUnknownRecordType = NewWarning(-413, "record header does not match plaintext or ciphertext format")
-
-var ErrUpdatingKeysWouldOverflowEpoch = NewFatal(-500, "updating keys would overflow epoch")
-var ErrEncryptedHandshakeMessageHeaderParsing = NewWarning(-502, "encrypted handshake message header failed to parse")
-var ErrServerHelloMustNotBeEncrypted = NewWarning(-503, "ServerHello must not be encrypted")
-var ErrClientHelloMustNotBeEncrypted = NewWarning(-504, "ClientHello must not be encrypted")
-var ErrHandshakeMessageFragmentLengthMismatch = NewWarning(-505, "handshake message fragment has different length than received before")
-var ErrHandshakeMessageFragmentTypeMismatch = NewWarning(-506, "handshake message fragment has different type than received before")
-var ErrExtensionsMessageParsing = NewWarning(-507, "Extensions handshake message failed to parse")
-var ErrCertificateMessageParsing = NewWarning(-508, "Certificate handshake message failed to parse")
-var ErrCertificateVerifyMessageParsing = NewWarning(-509, "CertificateVerify handshake message failed to parse")
-var ErrFinishedMessageParsing = NewWarning(-510, "Finished handshake message failed to parse")
-var ErrKeyUpdateMessageParsing = NewWarning(-511, "KeyUpdate handshake message failed to parse")
-
-var ErrUnexpectedMessage = NewWarning(-507, "unexpected message")
-
-var ErrCertificateChainEmpty = NewWarning(-512, "certificate chain is empty")
-var ErrCertificateLoadError = NewWarning(-513, "certificate load error")
-var ErrCertificateAlgorithmUnsupported = NewWarning(-514, "certificate algorihtm unsupported")
-var ErrCertificateSignatureInvalid = NewWarning(-515, "certificate signature invalid")
-var ErrFinishedMessageVerificationFailed = NewWarning(-516, "finished message verification failed")
-var ErrPSKBinderVerificationFailed = NewWarning(-516, "psk binder verification failed")
-
-var ErrEncryptedAckMessageHeaderParsing = NewWarning(-516, "encrypted ack message header failed to parsed")
-
-var ErrReceivedMessageSeqOverflow = NewWarning(-517, "received handshake message sequence limit of 2^16-1 reached, closing connection")
-var ErrSendMessageSeqOverflow = NewWarning(-517, "sent handshake message sequence limit of 2^16-1 reached, closing connection")
-
-var ErrSendEpoch0RecordSeqOverflow = NewWarning(-518, "sending plaintext record sequence number reached 2^16-1 (implementation limit), closing connection")
-var ErrSendRecordSeqOverflow = NewWarning(-519, "sending ciphertext record sequence number reached limit (peer did not ack our KeyUpdate?), closing connection")
-var ErrReceiveRecordSeqOverflow = NewWarning(-520, "receiving ciphertext record sequence number reached limit (peer did not react to our KeyUpdate request?), closing connection")
-var ErrReceiveRecordSeqOverflowNextEpoch = NewWarning(-521, "receiving ciphertext record sequence number for a new epoch reached limit, closing connection")
+// Passed to ConnectionHandler.OnDisconnectLocked, so application knows why connection was closed.
+type AlertError struct {
+	Alert  record.Alert
+	Remote bool  // alert was received from peer, otherwise sent (or attempted to send) by us
+	Err    error // local error which caused alert, nil if alert is remote or connection closed by application
+}
+
+func (e *AlertError) Error() string {
+	side := "sent"
+	if e.Remote {
+		side = "received"
+	}
+	if e.Err != nil {
+		return fmt.Sprintf("dtls: %s alert %v: %v", side, e.Alert, e.Err)
+	}
+	return fmt.Sprintf("dtls: %s alert %v", side, e.Alert)
+}
+
+func (e *AlertError) Unwrap() error { return e.Err }
+
+// connection was closed normally by us or peer
+func (e *AlertError) IsCloseNotify() bool { return e.Alert.Description == record.AlertCloseNotify }
+
+var WarnServerHelloFragmented = NewWarning(-398, record.AlertUnexpectedMessage, "fragmented ServerHello message not supported")
+var WarnClientHelloFragmented = NewWarning(-399, record.AlertUnexpectedMessage, "fragmented ClientHello message not supported")
+var WarnPostHandshakeMessageFragmented = NewWarning(-400, record.AlertUnexpectedMessage, "fragmented post-handshake message not supported by this implementation, waiting for retransmission")
+var WarnAckEpochSeqnumOverflow = NewWarning(-403, record.AlertIllegalParameter, "ack record epoch overflows 2^16")
+var WarnPlaintextRecordParsing = NewWarning(-405, record.AlertDecodeError, "plaintext record header failed to parse")
+var WarnCiphertextRecordParsing = NewWarning(-406, record.AlertDecodeError, "ciphertext record header failed to parse")
+var WarnCiphertextNoConnection = NewWarning(-407, record.AlertBadRecordMAC, "received ciphertext without connection")
+var WarnFailedToDeprotectRecord = NewWarning(-408, record.AlertBadRecordMAC, "failed to deprotect encrypted record")
+var WarnPlaintextHandshakeMessageHeaderParsing = NewWarning(-409, record.AlertDecodeError, "plaintext handshake message header failed to parse")
+var WarnPlaintextClientHelloParsing = NewWarning(-410, record.AlertDecodeError, "plaintext ClientHello message failed to parse")
+var WarnPlaintextServerHelloParsing = NewWarning(-411, record.AlertDecodeError, "plaintext ServerHello message failed to parse")
+var WarnUnknownRecordType = NewWarning(-413, record.AlertDecodeError, "record header does not match plaintext or ciphertext format")
+
+var ErrUpdatingKeysWouldOverflowEpoch = NewFatal(-500, record.AlertInternalError, "updating keys would overflow epoch")
+var ErrEncryptedHandshakeMessageHeaderParsing = NewWarning(-502, record.AlertDecodeError, "encrypted handshake message header failed to parse")
+var ErrServerHelloMustNotBeEncrypted = NewWarning(-503, record.AlertUnexpectedMessage, "ServerHello must not be encrypted")
+var ErrClientHelloMustNotBeEncrypted = NewWarning(-504, record.AlertUnexpectedMessage, "ClientHello must not be encrypted")
+var ErrHandshakeMessageFragmentLengthMismatch = NewWarning(-505, record.AlertIllegalParameter, "handshake message fragment has different length than received before")
+var ErrHandshakeMessageFragmentTypeMismatch = NewWarning(-506, record.AlertIllegalParameter, "handshake message fragment has different type than received before")
+var ErrExtensionsMessageParsing = NewWarning(-507, record.AlertDecodeError, "Extensions handshake message failed to parse")
+var ErrCertificateMessageParsing = NewWarning(-508, record.AlertDecodeError, "Certificate handshake message failed to parse")
+var ErrCertificateVerifyMessageParsing = NewWarning(-509, record.AlertDecodeError, "CertificateVerify handshake message failed to parse")
+var ErrFinishedMessageParsing = NewWarning(-510, record.AlertDecodeError, "Finished handshake message failed to parse")
+var ErrKeyUpdateMessageParsing = NewWarning(-511, record.AlertDecodeError, "KeyUpdate handshake message failed to parse")
+
+var ErrUnexpectedMessage = NewWarning(-507, record.AlertUnexpectedMessage, "unexpected message")
+
+var ErrCertificateChainEmpty = NewFatal(-512, record.AlertDecodeError, "certificate chain is empty")
+var ErrCertificateLoadError = NewFatal(-513, record.AlertBadCertificate, "certificate load error")
+var ErrCertificateAlgorithmUnsupported = NewFatal(-514, record.AlertIllegalParameter, "certificate algorihtm unsupported")
+var ErrCertificateSignatureInvalid = NewFatal(-515, record.AlertDecryptError, "certificate signature invalid")
+var ErrFinishedMessageVerificationFailed = NewFatal(-516, record.AlertDecryptError, "finished message verification failed")
+var ErrPSKBinderVerificationFailed = NewWarning(-516, record.AlertDecryptError, "psk binder verification failed")
+
+var ErrEncryptedAckMessageHeaderParsing = NewWarning(-516, record.AlertDecodeError, "encrypted ack message header failed to parsed")
+
+var ErrReceivedMessageSeqOverflow = NewFatal(-517, record.AlertInternalError, "received handshake message sequence limit of 2^16-1 reached, closing connection")
+var ErrSendMessageSeqOverflow = NewFatal(-517, record.AlertInternalError, "sent handshake message sequence limit of 2^16-1 reached, closing connection")
+
+var ErrSendEpoch0RecordSeqOverflow = NewFatal(-518, record.AlertInternalError, "sending plaintext record sequence number reached 2^16-1 (implementation limit), closing connection")
+var ErrSendRecordSeqOverflow = NewFatal(-519, record.AlertInternalError, "sending ciphertext record sequence number reached limit (peer did not ack our KeyUpdate?), closing connection")
+var ErrReceiveRecordSeqOverflow = NewFatal(-520, record.AlertInternalError, "receiving ciphertext record sequence number reached limit (peer did not react to our KeyUpdate request?), closing connection")
+var ErrReceiveRecordSeqOverflowNextEpoch = NewFatal(-521, record.AlertInternalError, "receiving ciphertext record sequence number for a new epoch reached limit, closing connection")
+var ErrCertificateRequestMessageParsing = NewWarning(-522, record.AlertDecodeError, "CertificateRequest handshake message failed to parse")
 
 // records format
-var ErrAckRecordMustBeEncrypted = NewWarning(-600, "ack record must always be encrypted")
-var ErrUnknownInnerPlaintextRecordType = NewWarning(-602, "unknown inner plaintext record type")
-var ErrHandshakeRecordEmpty = NewWarning(-603, "handshake record must not be empty")
+var ErrAckRecordMustBeEncrypted = NewWarning(-600, record.AlertUnexpectedMessage, "ack record must always be encrypted")
+var ErrUnknownInnerPlaintextRecordType = NewWarning(-602, record.AlertUnexpectedMessage, "unknown inner plaintext record type")
+var ErrHandshakeRecordEmpty = NewWarning(-603, record.AlertUnexpectedMessage, "handshake record must not be empty")
+var ErrRecordOverflow = NewFatal(-604, record.AlertRecordOverflow, "received record exceeds our record_size_limit")
 
 // encryption
-var WarnCannotDecryptInEpoch0 = NewWarning(-300, "cannot decrypt record at epoch 0")
-var WarnEpochDoesNotMatch = NewWarning(-300, "received record epoch bitmask does not match current or next epoch")
-var WarnCipherTextTooShortForSNDecryption = NewWarning(-300, "ciphertext too short for SN decryption")
-var WarnAEADDeprotectionFailed = NewWarning(-300, "ciphertext AEAD decryption failed")
-var ErrCipherTextAllZeroPadding = NewFatal(-300, "ciphertext all zero padding") // fatal, because inside deprotected record
+var WarnCannotDecryptInEpoch0 = NewWarning(-300, record.AlertBadRecordMAC, "cannot decrypt record at epoch 0")
+var WarnEpochDoesNotMatch = NewWarning(-300, record.AlertBadRecordMAC, "received record epoch bitmask does not match current or next epoch")
+var WarnCipherTextTooShortForSNDecryption = NewWarning(-300, record.AlertBadRecordMAC, "ciphertext too short for SN decryption")
+var WarnAEADDeprotectionFailed = NewWarning(-300, record.AlertBadRecordMAC, "ciphertext AEAD decryption failed")
+var ErrCipherTextAllZeroPadding = NewFatal(-300, record.AlertUnexpectedMessage, "ciphertext all zero padding") // fatal, because inside deprotected record
 
 // handshake protocol
-var WarnHandshakeMessageMustBeEncrypted = NewWarning(-700, "plaintext handshake messages other than ClientHello, ServerHello must be encrypted")
-
-var ErrPostHandshakeMessageDuringHandshake = NewWarning(-701, "post-handshake message during handshake")
-var ErrHandshakeMessagePostHandshake = NewWarning(-702, "handshake message received post handshake")
-var ErrHandshakeMessageTypeUnknown = NewWarning(-703, "handshake message type unknown")
-
-var ErrEncryptedExtensionsReceivedByServer = NewWarning(-701, "EncryptedExtensions handshake message rsceived by server")
-var ErrClientHelloReceivedByClient = NewWarning(-702, "ClientHello handshake message rsceived by client")
-var ErrServerHelloReceivedByServer = NewWarning(-703, "ServerHello handshake message rsceived by server")
-var ErrClientHelloUnsupportedParams = NewWarning(-704, "ClientHello unsupported params (version, ciphersuite, groups, etc)") // TODO - more granular error
-
-var ErrParamsSupportOnlyDTLS13 = NewWarning(-705, "unsupported version - only DTLSv1.3 supported")
-var ErrParamsSupportCiphersuites = NewWarning(-705, "unsupported ciphersuite")
-var ErrParamsSupportKeyShare = NewWarning(-705, "unsupported key share - only X25519 supported")
-var ErrPskKeyRequiresPskModes = NewWarning(-705, "pre_shared_key requires psk_key_exchange_modes")
-var ErrServerHRRMustContainCookie = errors.New("server HelloRetryRequest must contain valid cookie")
-var ErrServerHRRMustHaveMsgSeq0 = errors.New("server HelloRetryRequest must have message seq 0")
-var ErrServerMustNotSendPSKModes = NewWarning(-705, "server must not send psk_key_exchange_modes")
-
-var ErrALPNNoCompatibleProtocol = NewFatal(-750, "no compatible ALPN protocol")
-
-var ErrClientHelloCookieInvalid = NewWarning(-705, "ClientHello cookie failed validation")
-var ErrClientHelloCookieAge = NewWarning(-706, "ClientHello cookie expired")
-var ErrServerHelloRetryRequestQueueFull = NewWarning(-707, "Server's HelloRetryRequest queue is full, dropping ClientHello")
-var ErrServerHelloNoActiveConnection = NewWarning(-708, "client received ServerHello, but has no active connection to address")
+var WarnHandshakeMessageMustBeEncrypted = NewWarning(-700, record.AlertUnexpectedMessage, "plaintext handshake messages other than ClientHello, ServerHello must be encrypted")
+
+var ErrPostHandshakeMessageDuringHandshake = NewWarning(-701, record.AlertUnexpectedMessage, "post-handshake message during handshake")
+var ErrHandshakeMessagePostHandshake = NewWarning(-702, record.AlertUnexpectedMessage, "handshake message received post handshake")
+var ErrHandshakeMessageTypeUnknown = NewWarning(-703, record.AlertUnexpectedMessage, "handshake message type unknown")
+
+var ErrEncryptedExtensionsReceivedByServer = NewWarning(-701, record.AlertUnexpectedMessage, "EncryptedExtensions handshake message rsceived by server")
+var ErrClientHelloReceivedByClient = NewWarning(-702, record.AlertUnexpectedMessage, "ClientHello handshake message rsceived by client")
+var ErrServerHelloReceivedByServer = NewWarning(-703, record.AlertUnexpectedMessage, "ServerHello handshake message rsceived by server")
+var ErrClientHelloUnsupportedParams = NewWarning(-704, record.AlertHandshakeFailure, "ClientHello unsupported params (version, ciphersuite, groups, etc)") // TODO - more granular error
+
+var ErrParamsSupportOnlyDTLS13 = NewWarning(-705, record.AlertProtocolVersion, "unsupported version - only DTLSv1.3 supported")
+var ErrParamsSupportCiphersuites = NewWarning(-705, record.AlertHandshakeFailure, "unsupported ciphersuite")
+var ErrParamsSupportKeyShare = NewWarning(-705, record.AlertHandshakeFailure, "unsupported key share - only X25519 supported")
+var ErrPskKeyRequiresPskModes = NewWarning(-705, record.AlertMissingExtension, "pre_shared_key requires psk_key_exchange_modes")
+var ErrServerHRRMustContainCookie = NewWarning(-719, record.AlertIllegalParameter, "server HelloRetryRequest must contain valid cookie")
+var ErrServerHRRMustHaveMsgSeq0 = NewWarning(-720, record.AlertIllegalParameter, "server HelloRetryRequest must have message seq 0")
+var ErrServerMustNotSendPSKModes = NewWarning(-705, record.AlertIllegalParameter, "server must not send psk_key_exchange_modes")
+var ErrServerSentUnsolicitedRecordSizeLimit = NewFatal(-709, record.AlertUnsupportedExtension, "server sent record_size_limit extension, but client did not")
+
+var ErrPostHandshakeAuthNotPossible = NewWarning(-710, record.AlertInternalError, "post-handshake authentication is possible only on server after handshake, if client sent post_handshake_auth")
+var ErrPostHandshakeAuthInProgress = NewWarning(-711, record.AlertUnexpectedMessage, "post-handshake authentication already in progress")
+var ErrCertificateRequestContextMismatch = NewFatal(-712, record.AlertIllegalParameter, "certificate_request_context does not match")
+var ErrCertificateRequestUnexpected = NewFatal(-713, record.AlertUnexpectedMessage, "CertificateRequest received, but client did not send post_handshake_auth")
+var ErrOCSPStapleRequired = NewFatal(-714, record.AlertBadCertificateStatusResponse, "server did not staple OCSP response, but it is required")
+var ErrOCSPStapleInvalid = NewFatal(-715, record.AlertBadCertificateStatusResponse, "stapled OCSP response failed to parse or verify")
+var ErrOCSPStapleRevoked = NewFatal(-716, record.AlertCertificateRevoked, "stapled OCSP response status is not good (certificate revoked)")
+var ErrOCSPStapleExpired = NewFatal(-717, record.AlertBadCertificateStatusResponse, "stapled OCSP response is not yet valid or expired")
+var ErrOCSPStapleUnsolicited = NewFatal(-718, record.AlertUnsupportedExtension, "server stapled OCSP response, but client did not request it")
+
+var ErrALPNNoCompatibleProtocol = NewFatal(-750, record.AlertNoApplicationProtocol, "no compatible ALPN protocol")
+
+var ErrClientHelloCookieInvalid = NewWarning(-705, record.AlertIllegalParameter, "ClientHello cookie failed validation")
+var ErrClientHelloCookieAge = NewWarning(-706, record.AlertIllegalParameter, "ClientHello cookie expired")
+var ErrServerHelloRetryRequestQueueFull = NewWarning(-707, record.AlertInternalError, "Server's HelloRetryRequest queue is full, dropping ClientHello")
+var ErrConnectionReplaced = NewWarning(-721, record.AlertCloseNotify, "connection replaced by ClientHello with newer cookie from the same address")
+var ErrPeerLostConnection = NewFatal(-722, record.AlertBadRecordMAC, "peer replied with stateless reset, it has no state for our connection (restarted?)")
+var ErrHandshakeTimeout = NewWarning(-723, record.AlertCloseNotify, "handshake did not finish in Options.HandshakeTimeout, closing connection")
+var WarnHandshakeLimit = NewWarning(-725, record.AlertInternalError, "handshake limit reached and no stalled handshake to evict, refusing new handshake")
+var ErrHandshakeEvicted = NewWarning(-726, record.AlertCloseNotify, "stalled handshake evicted to make room for new handshake")
+var ErrConnectionIDCollision = NewFatal(-727, record.AlertInternalError, "failed to generate unique connection ID, check Options.CIDGenerator")
+var ErrConnectionIDTooLong = NewFatal(-728, record.AlertIllegalParameter, "peer connection ID is longer than we support")
+var ErrServerSentUnsolicitedConnectionID = NewFatal(-729, record.AlertUnsupportedExtension, "server sent connection_id extension, but client did not")
+var WarnMigrationAddressInUse = NewWarning(-730, record.AlertInternalError, "peer changed address to one used by another connection, not migrating")
+var ErrServerSentUnsolicitedRRC = NewFatal(-731, record.AlertUnsupportedExtension, "server sent rrc extension, but client did not")
+var ErrRRCNotNegotiated = NewFatal(-732, record.AlertUnexpectedMessage, "return_routability_check record received, but rrc extension was not negotiated")
+var ErrRRCMessageParsing = NewFatal(-733, record.AlertDecodeError, "return_routability_check message failed to parse")
+var WarnMigrationNotValidated = NewWarning(-734, record.AlertInternalError, "peer changed address, but return routability check was not negotiated or failed, not migrating")
+var WarnPathResponseMismatch = NewWarning(-735, record.AlertInternalError, "path_response does not match outstanding path_challenge, ignoring")
+var ErrServerSentUnsolicitedPlaintextSequenceNumber = NewFatal(-736, record.AlertUnsupportedExtension, "server sent plaintext_sequence_number extension, but client did not")
+var ErrKeyUpdateNotPossible = NewWarning(-737, record.AlertInternalError, "KeyUpdate is possible only after handshake")
+var ErrReceiveIntegrityLimit = NewFatal(-738, record.AlertInternalError, "too many received records failed deprotection (AEAD integrity limit reached), closing connection")
+var ErrKeepaliveTimeout = NewWarning(-739, record.AlertCloseNotify, "nothing received from peer after keepalives, closing connection")
+var ErrPeerUnreachable = NewWarning(-740, record.AlertCloseNotify, "ICMP destination unreachable received for peer address, closing connection")
+var ErrRetransmitLimit = NewWarning(-741, record.AlertCloseNotify, "peer did not acknowledge anything after Options.MaxRetransmissions retransmissions, closing connection")
+var ErrRecordSizeLimitTooSmall = NewFatal(-742, record.AlertIllegalParameter, "record_size_limit extension value is smaller than 64")
+var ErrIdleTimeout = NewWarning(-724, record.AlertCloseNotify, "nothing received from peer in Options.IdleTimeout, closing connection")
+var ErrServerHelloNoActiveConnection = NewWarning(-708, record.AlertUnexpectedMessage, "client received ServerHello, but has no active connection to address")
 
 // crypto related
-var ErrCertificateVerifyMessageSignature = NewWarning(-800, "failed to sign CertificateVerify handshake message")
+var ErrCertificateVerifyMessageSignature = NewWarning(-800, record.AlertInternalError, "failed to sign CertificateVerify handshake message")
@@ -0,0 +1,23 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlsudp
+
+import "net/netip"
+
+// one buffer filled by batchConn.readBatch
+type batchReceived struct {
+	size      int
+	addr      netip.AddrPort
+	localAddr netip.Addr // destination of datagram (IP_PKTINFO), invalid if unknown
+	truncated bool       // buffer was too small, datagram must be dropped
+	segment   int        // if not 0, kernel coalesced datagrams of that size (GRO), last one can be shorter
+}
+
+// one message written by batchConn.writeBatch
+type batchMessage struct {
+	data      []byte
+	addr      netip.AddrPort
+	localAddr netip.Addr // source of datagram (IP_PKTINFO), kernel selects if invalid
+	segment   int        // if not 0, kernel splits data into datagrams of that size (GSO), last one can be shorter
+}
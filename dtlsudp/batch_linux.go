@@ -0,0 +1,224 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+//go:build linux
+
+package dtlsudp
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// struct mmsghdr, Go pads it to the same size as C does
+type mmsghdr struct {
+	hdr unix.Msghdr
+	len uint32
+}
+
+const oobSpace = 128 // per message, enough for all control messages we send or receive
+
+// recvmmsg/sendmmsg on the socket, all buffers are allocated once in newBatchConn.
+// Not safe for concurrent use, receiver and sender each have their own.
+type batchConn struct {
+	raw   syscall.RawConn
+	inet6 bool // addresses must be IPv6 (IPv4-mapped for IPv4 peers)
+	gro   bool
+
+	errQueue *errQueue // nil if ICMP errors are not received, see errqueue_linux.go
+
+	msgs  []mmsghdr
+	iovs  []unix.Iovec
+	names []unix.RawSockaddrInet6 // large enough for IPv4 too
+	oob   []byte                  // oobSpace per message
+}
+
+// returns nil if batching is not supported, caller must use ordinary reads and writes then
+func newBatchConn(socket *net.UDPConn, size int) *batchConn {
+	raw, err := socket.SyscallConn()
+	if err != nil {
+		return nil
+	}
+	var sa unix.Sockaddr
+	if err2 := raw.Control(func(fd uintptr) {
+		sa, err = unix.Getsockname(int(fd))
+	}); err2 != nil || err != nil {
+		return nil
+	}
+	bc := &batchConn{
+		raw:   raw,
+		msgs:  make([]mmsghdr, size),
+		iovs:  make([]unix.Iovec, size),
+		names: make([]unix.RawSockaddrInet6, size),
+		oob:   make([]byte, size*oobSpace),
+	}
+	switch sa.(type) {
+	case *unix.SockaddrInet4:
+	case *unix.SockaddrInet6:
+		bc.inet6 = true
+	default:
+		return nil
+	}
+	for i := range bc.msgs {
+		bc.msgs[i].hdr.Name = (*byte)(unsafe.Pointer(&bc.names[i]))
+		bc.msgs[i].hdr.Iov = &bc.iovs[i]
+		bc.msgs[i].hdr.SetIovlen(1)
+	}
+	return bc
+}
+
+// returns false if kernel does not support UDP_SEGMENT (added in Linux 4.18)
+func (bc *batchConn) enableGSO() bool {
+	var err error
+	if err2 := bc.raw.Control(func(fd uintptr) {
+		_, err = unix.GetsockoptInt(int(fd), unix.SOL_UDP, unix.UDP_SEGMENT)
+	}); err2 != nil || err != nil {
+		return false
+	}
+	return true
+}
+
+// returns false if kernel does not support UDP_GRO (added in Linux 5.0)
+func (bc *batchConn) enableGRO() bool {
+	var err error
+	if err2 := bc.raw.Control(func(fd uintptr) {
+		err = unix.SetsockoptInt(int(fd), unix.SOL_UDP, unix.UDP_GRO, 1)
+	}); err2 != nil || err != nil {
+		return false
+	}
+	bc.gro = true
+	return true
+}
+
+func (bc *batchConn) setBuffer(i int, buf []byte) {
+	if len(buf) == 0 {
+		bc.iovs[i].Base = nil
+	} else {
+		bc.iovs[i].Base = &buf[0]
+	}
+	bc.iovs[i].SetLen(len(buf))
+}
+
+// reads at least 1 buffer, blocking if needed, and at most len(buffers), fills received[i] for each.
+func (bc *batchConn) readBatch(buffers [][]byte, received []batchReceived) (int, error) {
+	count := min(len(buffers), len(bc.msgs))
+	for i := 0; i < count; i++ {
+		bc.setBuffer(i, buffers[i])
+		bc.msgs[i].hdr.Namelen = unix.SizeofSockaddrInet6
+		bc.msgs[i].hdr.Control = &bc.oob[i*oobSpace]
+		bc.msgs[i].hdr.SetControllen(oobSpace)
+		bc.msgs[i].hdr.Flags = 0
+		bc.msgs[i].len = 0
+	}
+	var n int
+	var errno syscall.Errno
+	err := bc.raw.Read(func(fd uintptr) (done bool) {
+		for {
+			r, _, e := unix.Syscall6(unix.SYS_RECVMMSG, fd, uintptr(unsafe.Pointer(&bc.msgs[0])), uintptr(count), 0, 0, 0)
+			if e == unix.EINTR {
+				continue
+			}
+			if bc.errQueue != nil && (e == unix.EAGAIN || isICMPError(e)) {
+				// socket is also readable when error queue is not empty, pending error may be already
+				// reported to sender, so we check error queue every time there are no datagrams
+				bc.drainErrorQueue(fd)
+				if e != unix.EAGAIN {
+					continue
+				}
+			}
+			if e == unix.EAGAIN {
+				return false // wait until socket is readable
+			}
+			n, errno = int(r), e
+			return true
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	if errno != 0 {
+		return 0, errno
+	}
+	for i := 0; i < n; i++ {
+		r := &received[i]
+		r.size = int(bc.msgs[i].len) // widening
+		r.truncated = bc.msgs[i].hdr.Flags&unix.MSG_TRUNC != 0
+		r.addr = bc.sockaddrToAddrPort(&bc.names[i])
+		oob := bc.oob[i*oobSpace : i*oobSpace+int(bc.msgs[i].hdr.Controllen)] // widening or truncation, but fits
+		r.segment, r.localAddr = parseControlMessages(oob)
+	}
+	return n, nil
+}
+
+// writes messages in as few syscalls as possible. Returns number of messages written,
+// if it is less than len(messages), message with that index failed with returned error.
+func (bc *batchConn) writeBatch(messages []batchMessage) (int, error) {
+	count := min(len(messages), len(bc.msgs))
+	for i := 0; i < count; i++ {
+		m := &messages[i]
+		bc.setBuffer(i, m.data)
+		bc.msgs[i].hdr.Namelen = bc.addrPortToSockaddr(&bc.names[i], m.addr)
+		bc.msgs[i].len = 0
+		oob := bc.oob[i*oobSpace : i*oobSpace : (i+1)*oobSpace]
+		if m.segment != 0 && m.segment < len(m.data) {
+			oob = appendSegment(oob, m.segment)
+		}
+		oob = appendPktInfo(oob, m.localAddr)
+		bc.msgs[i].hdr.Control = nil
+		if len(oob) != 0 {
+			bc.msgs[i].hdr.Control = &oob[0]
+		}
+		bc.msgs[i].hdr.SetControllen(len(oob))
+	}
+	sent := 0
+	for sent < count {
+		var n int
+		var errno syscall.Errno
+		err := bc.raw.Write(func(fd uintptr) (done bool) {
+			r, _, e := unix.Syscall6(unix.SYS_SENDMMSG, fd, uintptr(unsafe.Pointer(&bc.msgs[sent])), uintptr(count-sent), 0, 0, 0)
+			if e == unix.EAGAIN || e == unix.EINTR {
+				return false // wait until socket is writable
+			}
+			n, errno = int(r), e
+			return true
+		})
+		if err != nil {
+			return sent, err
+		}
+		if errno != 0 { // sendmmsg returns error only if the first datagram failed
+			return sent, errno
+		}
+		sent += n
+	}
+	return sent, nil
+}
+
+func (bc *batchConn) sockaddrToAddrPort(name *unix.RawSockaddrInet6) netip.AddrPort {
+	port := binary.BigEndian.Uint16((*[2]byte)(unsafe.Pointer(&name.Port))[:]) // same offset for both families
+	if name.Family == unix.AF_INET {
+		sa4 := (*unix.RawSockaddrInet4)(unsafe.Pointer(name))
+		return netip.AddrPortFrom(netip.AddrFrom4(sa4.Addr), port)
+	}
+	// IPv4-mapped addresses are not unmapped, same as net.UDPConn.ReadFromUDPAddrPort does
+	return netip.AddrPortFrom(netip.AddrFrom16(name.Addr), port)
+}
+
+func (bc *batchConn) addrPortToSockaddr(name *unix.RawSockaddrInet6, addr netip.AddrPort) uint32 {
+	*name = unix.RawSockaddrInet6{}
+	binary.BigEndian.PutUint16((*[2]byte)(unsafe.Pointer(&name.Port))[:], addr.Port())
+	if !bc.inet6 && addr.Addr().Unmap().Is4() {
+		sa4 := (*unix.RawSockaddrInet4)(unsafe.Pointer(name))
+		sa4.Family = unix.AF_INET
+		sa4.Addr = addr.Addr().Unmap().As4()
+		return unix.SizeofSockaddrInet4
+	}
+	// IPv6 address on IPv4 socket is rejected by kernel, we report error for that datagram
+	name.Family = unix.AF_INET6
+	name.Addr = addr.Addr().As16() // IPv4 address becomes IPv4-mapped
+	return unix.SizeofSockaddrInet6
+}
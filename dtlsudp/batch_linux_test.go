@@ -0,0 +1,205 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+//go:build linux
+
+package dtlsudp
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"net/netip"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func testBatchLoopback(t *testing.T, network string, address string) {
+	udpAddr, err := net.ResolveUDPAddr(network, address)
+	if err != nil {
+		t.Skipf("cannot resolve %s: %v", address, err)
+	}
+	socket, err := net.ListenUDP(network, udpAddr)
+	if err != nil {
+		t.Skipf("cannot listen to %s: %v", address, err)
+	}
+	defer socket.Close()
+	bc := newBatchConn(socket, 4)
+	if bc == nil {
+		t.Fatalf("batching must be supported on linux")
+	}
+	to := socket.LocalAddr().(*net.UDPAddr).AddrPort()
+	messages := []batchMessage{{data: []byte("a"), addr: to}, {data: []byte("bb"), addr: to}, {data: []byte("ccccc"), addr: to}}
+	if n, err := bc.writeBatch(messages); n != 3 || err != nil {
+		t.Fatalf("writeBatch sent %d datagrams: %v", n, err)
+	}
+	buffers := [][]byte{make([]byte, 4), make([]byte, 4), make([]byte, 4), make([]byte, 4)}
+	received := make([]batchReceived, 4)
+	count := 0
+	for count < 3 {
+		n, err := bc.readBatch(buffers[count:], received[count:])
+		if err != nil {
+			t.Fatalf("readBatch failed: %v", err)
+		}
+		count += n
+	}
+	for i, want := range []string{"a", "bb", "cccc"} {
+		r := received[i]
+		if got := string(buffers[i][:min(r.size, 4)]); got != want || r.addr != to {
+			t.Fatalf("datagram %d is %q from %v, must be %q from %v", i, got, r.addr, want, to)
+		}
+		if r.truncated != (i == 2) {
+			t.Fatalf("only last datagram must be truncated")
+		}
+	}
+}
+
+func TestBatch_GSOAndGRO(t *testing.T) {
+	socket, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	defer socket.Close()
+	bc := newBatchConn(socket, 4)
+	if !bc.enableGSO() || !bc.enableGRO() {
+		t.Skipf("kernel does not support UDP GSO or GRO")
+	}
+	to := socket.LocalAddr().(*net.UDPAddr).AddrPort()
+	if n, err := bc.writeBatch([]batchMessage{{data: []byte("aaaabbbbcc"), addr: to, segment: 4}}); n != 1 || err != nil {
+		t.Fatalf("writeBatch sent %d messages: %v", n, err)
+	}
+	buffers := [][]byte{make([]byte, 64), make([]byte, 64), make([]byte, 64), make([]byte, 64)}
+	received := make([]batchReceived, 4)
+	var datagrams []string
+	for len(datagrams) < 3 {
+		n, err := bc.readBatch(buffers, received)
+		if err != nil {
+			t.Fatalf("readBatch failed: %v", err)
+		}
+		for i := 0; i < n; i++ { // kernel may or may not coalesce
+			buffer := buffers[i][:received[i].size]
+			segment := received[i].segment
+			if segment == 0 {
+				segment = len(buffer)
+			}
+			for ; len(buffer) != 0; buffer = buffer[min(segment, len(buffer)):] {
+				datagrams = append(datagrams, string(buffer[:min(segment, len(buffer))]))
+			}
+		}
+	}
+	if len(datagrams) != 3 || datagrams[0] != "aaaa" || datagrams[1] != "bbbb" || datagrams[2] != "cc" {
+		t.Fatalf("message must be split into 3 datagrams, got %q", datagrams)
+	}
+}
+
+func TestBatch_LoopbackIPv4(t *testing.T) {
+	testBatchLoopback(t, "udp4", "127.0.0.1:0")
+}
+
+func TestBatch_LoopbackIPv6(t *testing.T) {
+	testBatchLoopback(t, "udp6", "[::1]:0")
+}
+
+func TestBatch_PktInfoWildcard(t *testing.T) {
+	server, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero})
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	defer server.Close()
+	client, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	defer client.Close()
+	if !enablePktInfo(server) || enablePktInfo(client) {
+		t.Fatalf("IP_PKTINFO must be enabled for wildcard socket only")
+	}
+	bc := newBatchConn(server, 4)
+	serverAddr := netip.AddrPortFrom(netip.MustParseAddr("127.0.0.1"), server.LocalAddr().(*net.UDPAddr).AddrPort().Port())
+	if _, err := client.WriteToUDPAddrPort([]byte("hello"), serverAddr); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+	buffers := [][]byte{make([]byte, 64)}
+	received := make([]batchReceived, 1)
+	if n, err := bc.readBatch(buffers, received); n != 1 || err != nil {
+		t.Fatalf("readBatch failed: %v", err)
+	}
+	if received[0].localAddr != serverAddr.Addr() {
+		t.Fatalf("local address must be %v, got %v", serverAddr.Addr(), received[0].localAddr)
+	}
+	reply := batchMessage{data: []byte("world"), addr: received[0].addr, localAddr: received[0].localAddr}
+	if n, err := bc.writeBatch([]batchMessage{reply}); n != 1 || err != nil {
+		t.Fatalf("writeBatch failed: %v", err)
+	}
+	var datagram [64]byte
+	n, from, err := client.ReadFromUDPAddrPort(datagram[:])
+	if err != nil || string(datagram[:n]) != "world" || from != serverAddr {
+		t.Fatalf("reply must come from %v, got %q from %v: %v", serverAddr, datagram[:n], from, err)
+	}
+}
+
+func TestBatch_ICMPPortUnreachable(t *testing.T) {
+	socket, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	defer socket.Close()
+	closed, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	to := closed.LocalAddr().(*net.UDPAddr).AddrPort()
+	_ = closed.Close()
+
+	bc := newBatchConn(socket, 4)
+	var errorAddrs []netip.AddrPort
+	if !bc.enableRecvErr(func(addr netip.AddrPort, err error) {
+		if !errors.Is(err, syscall.ECONNREFUSED) {
+			t.Errorf("port unreachable must be reported as ECONNREFUSED, got %v", err)
+		}
+		errorAddrs = append(errorAddrs, addr)
+	}) {
+		t.Skipf("IP_RECVERR is not supported")
+	}
+	if n, err := bc.writeBatch([]batchMessage{{data: []byte("hello"), addr: to}}); n != 1 || err != nil {
+		t.Fatalf("writeBatch failed: %v", err)
+	}
+	_ = socket.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	buffers := [][]byte{make([]byte, 64)}
+	received := make([]batchReceived, 1)
+	if n, err := bc.readBatch(buffers, received); n != 0 || !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("readBatch must time out without datagrams, got %d: %v", n, err)
+	}
+	if len(errorAddrs) != 1 || errorAddrs[0] != to {
+		t.Fatalf("ICMP error must be reported once for %v, got %v", to, errorAddrs)
+	}
+}
+
+// datagrams larger than our PMTUMax (peer may have larger MTU) must not be truncated
+func TestBatch_ReceiveLargeDatagram(t *testing.T) {
+	socket, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	defer socket.Close()
+	bc := newBatchConn(socket, 2)
+	to := socket.LocalAddr().(*net.UDPAddr).AddrPort()
+	large := make([]byte, 9000) // jumbo frame
+	for i := range large {
+		large[i] = byte(i)
+	}
+	if _, err := socket.WriteToUDPAddrPort(large, to); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+	buffers := newReceiveBuffers(2)
+	received := make([]batchReceived, 2)
+	n, err := bc.readBatch(buffers, received)
+	if n != 1 || err != nil {
+		t.Fatalf("readBatch failed: %v", err)
+	}
+	if received[0].truncated || !bytes.Equal(buffers[0][:received[0].size], large) {
+		t.Fatalf("datagram of %d bytes must be received whole, got %d bytes", len(large), received[0].size)
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+//go:build !linux
+
+package dtlsudp
+
+import (
+	"net"
+)
+
+// no recvmmsg/sendmmsg on other platforms
+type batchConn struct{}
+
+func newBatchConn(socket *net.UDPConn, size int) *batchConn {
+	return nil
+}
+
+func (bc *batchConn) enableGSO() bool { return false }
+func (bc *batchConn) enableGRO() bool { return false }
+
+func (bc *batchConn) readBatch(buffers [][]byte, received []batchReceived) (int, error) {
+	panic("batching is not supported")
+}
+
+func (bc *batchConn) writeBatch(messages []batchMessage) (int, error) {
+	panic("batching is not supported")
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+//go:build linux
+
+package dtlsudp
+
+import (
+	"errors"
+	"net/netip"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// With IP_RECVERR/IPV6_RECVERR kernel queues ICMP errors for unconnected UDP socket, together
+// with original destination of datagram which caused it, so we can fail connection to that address.
+// Pending error is also reported once by the next recv or send on the socket, whichever comes first,
+// for unrelated datagram, so we ignore such errors and read error queue instead.
+type errQueue struct {
+	onError func(addr netip.AddrPort, err error)
+	msg     unix.Msghdr
+	name    unix.RawSockaddrInet6
+	oob     [oobSpace]byte
+}
+
+// returns false if not supported, onError is called from readBatch
+func (bc *batchConn) enableRecvErr(onError func(addr netip.AddrPort, err error)) bool {
+	var err error
+	if err2 := bc.raw.Control(func(fd uintptr) {
+		if !bc.inet6 {
+			err = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_RECVERR, 1)
+			return
+		}
+		if err = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_RECVERR, 1); err != nil {
+			return
+		}
+		// IPv4 peers of dual-stack socket, fails for IPV6_V6ONLY socket, this is ok
+		_ = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_RECVERR, 1)
+	}); err2 != nil || err != nil {
+		return false
+	}
+	bc.errQueue = &errQueue{onError: onError}
+	bc.errQueue.msg.Name = (*byte)(unsafe.Pointer(&bc.errQueue.name))
+	return true
+}
+
+// errors kernel reports for ICMP destination unreachable, also reported by send and recv
+// for unrelated datagrams, if IP_RECVERR is set
+func isICMPError(err error) bool {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+	switch errno {
+	case unix.ECONNREFUSED, unix.EHOSTUNREACH, unix.ENETUNREACH, unix.EHOSTDOWN:
+		return true
+	}
+	return false
+}
+
+// must be called from raw connection callback, reads error queue until empty
+func (bc *batchConn) drainErrorQueue(fd uintptr) {
+	eq := bc.errQueue
+	for {
+		eq.msg.Namelen = unix.SizeofSockaddrInet6
+		eq.msg.Control = &eq.oob[0]
+		eq.msg.SetControllen(len(eq.oob))
+		eq.msg.Flags = 0 // payload of original datagram is not needed, it is truncated
+		_, _, e := unix.Syscall(unix.SYS_RECVMSG, fd, uintptr(unsafe.Pointer(&eq.msg)), unix.MSG_ERRQUEUE|unix.MSG_DONTWAIT)
+		if e == unix.EINTR {
+			continue
+		}
+		if e != 0 {
+			return // EAGAIN when queue is empty
+		}
+		oob := eq.oob[:eq.msg.Controllen] // widening or truncation, but fits
+		if errno := parseExtendedError(oob); errno != 0 && isICMPError(errno) {
+			eq.onError(bc.sockaddrToAddrPort(&eq.name), errno)
+		}
+	}
+}
+
+// returns errno from ICMP error in IP_RECVERR/IPV6_RECVERR control message, or 0
+func parseExtendedError(oob []byte) syscall.Errno {
+	for len(oob) >= unix.CmsgLen(0) {
+		header := (*unix.Cmsghdr)(unsafe.Pointer(&oob[0]))
+		messageLen := int(header.Len) // widening or truncation, but fits
+		if messageLen < unix.CmsgLen(0) || messageLen > len(oob) {
+			break
+		}
+		data := oob[unix.CmsgLen(0):messageLen]
+		if ((header.Level == unix.IPPROTO_IP && header.Type == unix.IP_RECVERR) ||
+			(header.Level == unix.IPPROTO_IPV6 && header.Type == unix.IPV6_RECVERR)) &&
+			len(data) >= int(unsafe.Sizeof(unix.SockExtendedErr{})) {
+			ee := (*unix.SockExtendedErr)(unsafe.Pointer(&data[0]))
+			if ee.Origin == unix.SO_EE_ORIGIN_ICMP || ee.Origin == unix.SO_EE_ORIGIN_ICMP6 {
+				return syscall.Errno(ee.Errno)
+			}
+		}
+		space := unix.CmsgSpace(len(data))
+		if space > len(oob) {
+			break
+		}
+		oob = oob[space:]
+	}
+	return 0
+}
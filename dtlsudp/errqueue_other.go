@@ -0,0 +1,18 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+//go:build !linux
+
+package dtlsudp
+
+import (
+	"net/netip"
+)
+
+func (bc *batchConn) enableRecvErr(onError func(addr netip.AddrPort, err error)) bool {
+	return false
+}
+
+func isICMPError(err error) bool {
+	return false
+}
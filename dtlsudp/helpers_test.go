@@ -0,0 +1,79 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlsudp
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hrissan/dtls/dtlscore"
+	"github.com/hrissan/dtls/dtlsrand"
+	"github.com/hrissan/dtls/transport/stats"
+)
+
+type testHandler struct{}
+
+func (h *testHandler) OnConnectLocked()                         {}
+func (h *testHandler) OnHandshakeLocked(dtlscore.HandshakeInfo) {}
+func (h *testHandler) OnDisconnectLocked(err error)             {}
+func (h *testHandler) OnWriteRecordLocked(earlyData bool, recordBody []byte) (int, bool, bool, error) {
+	return 0, false, false, nil
+}
+func (h *testHandler) OnReadRecordLocked(earlyData bool, recordBody []byte) error { return nil }
+func (h *testHandler) OnClientAuthenticationLocked(info dtlscore.ClientAuthenticationInfo, err error) {
+}
+func (h *testHandler) OnAddressChangedLocked(oldAddr netip.AddrPort, newAddr netip.AddrPort) {}
+func (h *testHandler) OnPathMTUChangedLocked(pathMTU int)                                    {}
+
+// first flight of a client, server without cookie responds with stateless HelloRetryRequest
+func clientHelloDatagram(tb testing.TB) []byte {
+	opts := dtlscore.DefaultTransportOptions(false, dtlsrand.CryptoRand(), stats.NewStatsLogQuiet())
+	opts.Preallocate = false
+	tr := dtlscore.NewTransport(opts, NewSender(opts), nil)
+	var conn dtlscore.Connection
+	if err := tr.StartConnection(&conn, &testHandler{}, netip.MustParseAddrPort("127.0.0.1:1")); err != nil {
+		tb.Fatalf("failed to start connection: %v", err)
+	}
+	conn.SenderRemoveFromQueue() // sender is not running
+	datagram := make([]byte, opts.PMTUMin)
+	_, _, size, _ := conn.SenderConstructDatagram(datagram)
+	if size == 0 {
+		tb.Fatalf("client must send ClientHello")
+	}
+	return datagram[:size]
+}
+
+var testCertOnce sync.Once
+var testCert tls.Certificate
+
+func testCertificate(tb testing.TB) tls.Certificate {
+	testCertOnce.Do(func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		now := time.Now()
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "test"},
+			NotBefore:    now.Add(-time.Hour),
+			NotAfter:     now.Add(24 * time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		leaf, _ := x509.ParseCertificate(der)
+		testCert = tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+	})
+	return testCert
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+//go:build linux
+
+package dtlsudp
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"strconv"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Socket bound to wildcard address on multi-homed host must reply from the address datagram
+// was sent to, otherwise kernel selects source address by routing table, and peer drops reply.
+// https://github.com/golang/go/issues/36421
+// So we receive destination address with IP_PKTINFO/IPV6_PKTINFO and send from it with the same
+// control message. Returns false if socket is bound to specific address (nothing to do),
+// or options are not supported.
+func enablePktInfo(socket *net.UDPConn) bool {
+	local, ok := socket.LocalAddr().(*net.UDPAddr)
+	if !ok || !local.IP.IsUnspecified() {
+		return false
+	}
+	raw, err := socket.SyscallConn()
+	if err != nil {
+		return false
+	}
+	if err2 := raw.Control(func(fd uintptr) {
+		var sa unix.Sockaddr
+		if sa, err = unix.Getsockname(int(fd)); err != nil {
+			return
+		}
+		if _, ok := sa.(*unix.SockaddrInet4); ok {
+			err = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_PKTINFO, 1)
+			return
+		}
+		// for IPv4 peers of dual-stack socket, kernel reports IPv4-mapped address
+		err = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_RECVPKTINFO, 1)
+	}); err2 != nil || err != nil {
+		return false
+	}
+	return true
+}
+
+// allocation-free version of unix.ParseSocketControlMessage, returns size of coalesced datagrams (UDP_GRO)
+// or 0, and our address datagram was sent to (IP_PKTINFO/IPV6_PKTINFO) or invalid address.
+func parseControlMessages(oob []byte) (segment int, localAddr netip.Addr) {
+	// |<- CmsgSpace ------------------------->|
+	// |<- header.Len ----------------->|      |
+	// |<- CmsgLen(0) ------->|         |      |
+	// +---------------+------+---------+------+
+	// |    Header     | PadH |  Data   | PadD |
+	// +---------------+------+---------+------+
+	for len(oob) >= unix.CmsgLen(0) {
+		header := (*unix.Cmsghdr)(unsafe.Pointer(&oob[0]))
+		messageLen := int(header.Len) // widening or truncation, but fits
+		if messageLen < unix.CmsgLen(0) || messageLen > len(oob) {
+			break
+		}
+		data := oob[unix.CmsgLen(0):messageLen]
+		switch {
+		case header.Level == unix.SOL_UDP && header.Type == unix.UDP_GRO && len(data) >= 4:
+			segment = int(*(*int32)(unsafe.Pointer(&data[0]))) // widening, native byte order
+		case header.Level == unix.IPPROTO_IP && header.Type == unix.IP_PKTINFO && len(data) >= unix.SizeofInet4Pktinfo:
+			localAddr = netip.AddrFrom4([4]byte(data[4:8])) // ipi_spec_dst
+		case header.Level == unix.IPPROTO_IPV6 && header.Type == unix.IPV6_PKTINFO && len(data) >= unix.SizeofInet6Pktinfo:
+			localAddr = netip.AddrFrom16([16]byte(data[:16]))
+			if localAddr.IsLinkLocalUnicast() { // cannot send from it without interface
+				ifIndex := *(*uint32)(unsafe.Pointer(&data[16])) // native byte order
+				localAddr = localAddr.WithZone(strconv.FormatUint(uint64(ifIndex), 10))
+			}
+		}
+		space := unix.CmsgSpace(len(data))
+		if space > len(oob) {
+			break // last padding is optional
+		}
+		oob = oob[space:]
+	}
+	return
+}
+
+// appends control message, returns oob and data of message to fill
+func appendControlMessage(oob []byte, level int32, typ int32, dataLen int) ([]byte, []byte) {
+	start := len(oob)
+	space := unix.CmsgSpace(dataLen)
+	oob = append(oob, make([]byte, space)...) // does not allocate, if capacity is enough
+	header := (*unix.Cmsghdr)(unsafe.Pointer(&oob[start]))
+	header.Level = level
+	header.Type = typ
+	header.SetLen(unix.CmsgLen(dataLen))
+	dataStart := start + unix.CmsgLen(0)
+	return oob, oob[dataStart : dataStart+dataLen]
+}
+
+// appends control message to send datagram from localAddr, does nothing if localAddr is not valid
+func appendPktInfo(oob []byte, localAddr netip.Addr) []byte {
+	if !localAddr.IsValid() {
+		return oob
+	}
+	if localAddr.Is4() {
+		oob, data := appendControlMessage(oob, unix.IPPROTO_IP, unix.IP_PKTINFO, unix.SizeofInet4Pktinfo)
+		addr := localAddr.As4()
+		copy(data[4:8], addr[:]) // ipi_spec_dst, ipi_ifindex and ipi_addr are zero
+		return oob
+	}
+	// for IPv4-mapped addresses, kernel converts it to IP_PKTINFO
+	oob, data := appendControlMessage(oob, unix.IPPROTO_IPV6, unix.IPV6_PKTINFO, unix.SizeofInet6Pktinfo)
+	addr := localAddr.As16()
+	copy(data[:16], addr[:])
+	ifIndex, _ := strconv.ParseUint(localAddr.Zone(), 10, 32)   // 0 if no zone
+	binary.NativeEndian.PutUint32(data[16:20], uint32(ifIndex)) // truncation, parsed as 32-bit
+	return oob
+}
+
+// appends control message to split message into datagrams of segment size (UDP_SEGMENT)
+func appendSegment(oob []byte, segment int) []byte {
+	oob, data := appendControlMessage(oob, unix.SOL_UDP, unix.UDP_SEGMENT, 2)
+	binary.NativeEndian.PutUint16(data, uint16(segment)) // truncation, checked by sender
+	return oob
+}
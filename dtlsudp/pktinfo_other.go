@@ -0,0 +1,24 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+//go:build !linux
+
+package dtlsudp
+
+import (
+	"net"
+	"net/netip"
+)
+
+// TODO - IP_RECVDSTADDR/IP_SENDSRCADDR on BSD
+func enablePktInfo(socket *net.UDPConn) bool {
+	return false
+}
+
+func parseControlMessages(oob []byte) (segment int, localAddr netip.Addr) {
+	return 0, netip.Addr{}
+}
+
+func appendPktInfo(oob []byte, localAddr netip.Addr) []byte {
+	return oob
+}
@@ -6,112 +6,87 @@ package dtlsudp
 import (
 	"errors"
 	"net"
+	"net/netip"
 	"time"
 
 	"github.com/hrissan/dtls/dtlscore"
 )
 
-/*
-	type ControlMessage struct {
-		TTL     int        // time-to-live, receiving only
-		Src     netip.Addr // source address, specifying only
-		Dst     netip.Addr // destination address, receiving only
-		IfIndex int        // interface index, must be 1 <= value when specifying
-	}
-
-var ErrParseControlMessage = errors.New("failed to parse control message")
+var ErrDatagramTruncated = errors.New("received datagram is larger than receive buffer, dropped")
 
-// very platform-dependent
+// blocks until socket is closed (externally)
+func GoRunReceiverUDP(t *dtlscore.Transport, opts *dtlscore.Options, socket *net.UDPConn) {
+	GoRunReceiverShardUDP(t, opts, 0, socket)
+}
 
-	func (msg *ControlMessage) parseCMsg(header *unix.Cmsghdr, data []byte) {
-		if header.Level == unix.IPPROTO_IP && header.Type == unix.IP_PKTINFO && len(data) >= 12 {
-			msg.IfIndex = int(binary.LittleEndian.Uint32(data))
-			msg.Dst = netip.AddrFrom4([4]byte(data[4:8]))
-			msg.Src = netip.AddrFrom4([4]byte(data[8:12]))
-		}
-		if header.Level == unix.IPPROTO_IPV6 && header.Type == unix.IPV6_PKTINFO && len(data) >= 20 {
-			msg.Src = netip.AddrFrom16([16]byte(data[:16]))
-			msg.IfIndex = int(binary.LittleEndian.Uint32(data[16:20]))
+// blocks until socket is closed (externally), shard is index of socket in GoRunUDPShards
+func GoRunReceiverShardUDP(t *dtlscore.Transport, opts *dtlscore.Options, shard int, socket *net.UDPConn) {
+	pktInfo := enablePktInfo(socket)
+	// only recvmmsg path reads ICMP errors from error queue, so without batching it is used with 1 buffer
+	if opts.SocketBatchSize > 1 || opts.MaxICMPErrorsPerSecond > 0 {
+		size := max(opts.SocketBatchSize, 1)
+		if bc := newBatchConn(socket, size); bc != nil {
+			goRunReceiverBatch(t, opts, shard, bc, size)
+			return
 		}
 	}
-
-// very platform-dependent
-
-	func (msg *ControlMessage) parseCMsgs(oob []byte) (nCmgs int, _ error) {
-		// |<- ControlMessageSpace --------------->|
-		// |<- controlMessageLen ---------->|      |
-		// |<- controlHeaderLen ->|         |      |
-		// +---------------+------+---------+------+
-		// |    Header     | PadH |  Data   | PadD |
-		// +---------------+------+---------+------+
-		for len(oob) != 0 {
-			controlHeaderLen := unix.CmsgLen(0)
-			if controlHeaderLen > len(oob) {
-				return nCmgs, ErrParseControlMessage
-			}
-			header := (*unix.Cmsghdr)(unsafe.Pointer(&oob[0]))
-			controlMessageLen := int(header.Len)
-			if controlMessageLen < controlHeaderLen || controlMessageLen > len(oob) {
-				return nCmgs, ErrParseControlMessage
+	datagram := make([]byte, maxDatagramSize)
+	oob := make([]byte, 128)
+	for {
+		n, oobn, _, addr, err := socket.ReadMsgUDPAddrPort(datagram, oob)
+		var localAddr netip.Addr
+		if pktInfo {
+			_, localAddr = parseControlMessages(oob[:oobn])
+		}
+		if n != 0 { // do not check for an error here
+			shutdown := t.ReceivedDatagramShard(shard, datagram[:n], addr, localAddr, err)
+			if shutdown { // stop processing of datagrams
+				return
 			}
-			body := oob[controlHeaderLen:controlMessageLen]
-			msg.parseCMsg(header, body)
-			nCmgs++
-			controlMessageSpace := unix.CmsgSpace(len(body))
-			if controlMessageSpace > len(oob) {
-				break // last padding is optional
+		}
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
 			}
-			oob = oob[controlMessageSpace:]
+			time.Sleep(opts.SocketReadErrorDelay)
 		}
-		return nCmgs, nil
 	}
-func (t *Transport) setOptions(file *os.File) {
-	// set both, any might fail
-	// we must reply from the interface we received packet from.
-	// https://github.com/golang/go/issues/36421
-	_ = syscall.SetsockoptInt(int(file.Fd()), syscall.IPPROTO_IP, syscall.IP_PKTINFO, 1)
-	_ = syscall.SetsockoptInt(int(file.Fd()), syscall.IPPROTO_IPV6, syscall.IPV6_PKTINFO, 1)
-	// See explanation in sender, why options below do not work as intended on Linux
-	// _ = syscall.SetsockoptInt(int(file.Fd()), syscall.IPPROTO_IP, syscall.IP_RECVERR, 1)
-	// _ = syscall.SetsockoptInt(int(file.Fd()), syscall.IPPROTO_IPV6, syscall.IPV6_RECVERR, 1)
 }
-func platformExperiments() {
-	syscallSocket, err := socket.SyscallConn()
-	if err != nil {
-		panic("socket failed to get raw socket: " + err.Error())
+
+// UDP payload limit, receiver accepts any datagram, regardless of our PMTUMax
+const maxDatagramSize = 65536
+
+// recvmmsg path, each buffer fits largest datagram (or coalesced datagrams with GRO)
+func goRunReceiverBatch(t *dtlscore.Transport, opts *dtlscore.Options, shard int, bc *batchConn, size int) {
+	if opts.SocketGRO {
+		bc.enableGRO()
 	}
-	_ = syscallSocket.Read(func(fd uintptr) (done bool) {
-		n, oobn, _, from, err := unix.Recvmsg(int(fd), datagram, oob, unix.MSG_ERRQUEUE)
-		if err == nil {
-			fmt.Printf("received MSG_ERRQUEUE n=%d oobn=%d bytes from %v\n", n, oobn, from)
-		}
-		return true
-	})
-}
-*/
-// blocks until socket is closed (externally)
-func GoRunReceiverUDP(t *dtlscore.Transport, opts *dtlscore.Options, socket *net.UDPConn) {
-	//file, err := socket.File()
-	//if err != nil {
-	//	panic("socket failed to get file descriptor: " + err.Error())
-	//}
-	//defer file.Close()
-	//t.setOptions(file)
-	datagram := make([]byte, 65536)
-	//oob := make([]byte, 4096)
+	if opts.MaxICMPErrorsPerSecond > 0 {
+		bc.enableRecvErr(func(addr netip.AddrPort, err error) {
+			t.ReceivedICMPErrorShard(shard, addr, err)
+		})
+	}
+	buffers := newReceiveBuffers(size)
+	received := make([]batchReceived, size)
 	for {
-		n, addr, err := socket.ReadFromUDPAddrPort(datagram)
-		//n, _, _, addr, err := socket.ReadMsgUDPAddrPort(datagram, oob)
-		//var cm2 ControlMessage
-		//if nCmsg, err2 := cm2.parseCMsgs(oob[:oobn]); err2 != nil {
-		//	fmt.Printf("err parsing cm2: %v\n", err2)
-		//} else {
-		//	fmt.Printf("cm2 %d: pktinfo: %v %v %v\n", nCmsg, cm2.Src, cm2.Dst, cm2.IfIndex)
-		//}
-		if n != 0 { // do not check for an error here
-			shutdown := t.ReceivedDatagram(datagram[:n], addr, err)
-			if shutdown { // stop processing of datagrams
-				return
+		n, err := bc.readBatch(buffers, received)
+		for i, r := range received[:n] {
+			if r.truncated {
+				opts.Stats.SocketReadError(r.size, r.addr, ErrDatagramTruncated)
+				continue
+			}
+			buffer := buffers[i][:r.size]
+			segment := r.segment
+			if segment <= 0 {
+				segment = len(buffer)
+			}
+			for len(buffer) != 0 {
+				datagram := buffer[:min(segment, len(buffer))]
+				buffer = buffer[len(datagram):]
+				shutdown := t.ReceivedDatagramShard(shard, datagram, r.addr, r.localAddr, nil)
+				if shutdown { // stop processing of datagrams
+					return
+				}
 			}
 		}
 		if err != nil {
@@ -122,3 +97,12 @@ func GoRunReceiverUDP(t *dtlscore.Transport, opts *dtlscore.Options, socket *net
 		}
 	}
 }
+
+func newReceiveBuffers(size int) [][]byte {
+	storage := make([]byte, size*maxDatagramSize)
+	buffers := make([][]byte, size)
+	for i := range buffers {
+		buffers[i] = storage[i*maxDatagramSize : (i+1)*maxDatagramSize]
+	}
+	return buffers
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+//go:build linux
+
+package dtlsudp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Opens n sockets bound to the same address with SO_REUSEPORT, kernel distributes
+// datagrams between them by hash of source and destination addresses, so datagrams from
+// the same peer arrive on the same socket (until sockets are added or removed).
+// If port is 0, all sockets are bound to the port selected for the first one.
+func OpenReusePortSockets(addressPort string, n int) ([]*net.UDPConn, error) {
+	lc := net.ListenConfig{Control: func(network, address string, c syscall.RawConn) error {
+		var err error
+		if err2 := c.Control(func(fd uintptr) {
+			err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+		}); err2 != nil {
+			return err2
+		}
+		return err
+	}}
+	sockets := make([]*net.UDPConn, 0, n)
+	for i := 0; i < n; i++ {
+		pc, err := lc.ListenPacket(context.Background(), "udp", addressPort)
+		if err != nil {
+			for _, s := range sockets {
+				_ = s.Close()
+			}
+			return nil, fmt.Errorf("cannot listen to udp address %s with SO_REUSEPORT: %w", addressPort, err)
+		}
+		socket := pc.(*net.UDPConn)
+		sockets = append(sockets, socket)
+		addressPort = socket.LocalAddr().String() // port 0 is replaced by the selected one
+	}
+	return sockets, nil
+}
+
+// Classic BPF program selects socket in the SO_REUSEPORT group by the first byte of CID
+// (see dtlscore.Options.CIDSteering), so records with CID arrive on the socket connection sticks to,
+// even after peer address changes. Other datagrams are distributed by hash as usual.
+// Sockets must be opened by OpenReusePortSockets, and index of socket is its position in the group.
+func AttachCIDSteeringBPF(sockets []*net.UDPConn) error {
+	if len(sockets) == 0 {
+		return nil
+	}
+	// packet data starts with UDP payload, [rfc9147:4] unified header is 001CSLEE, then CID if C is set
+	program := []unix.SockFilter{
+		{Code: unix.BPF_LD | unix.BPF_B | unix.BPF_ABS, K: 0},
+		{Code: unix.BPF_ALU | unix.BPF_AND | unix.BPF_K, K: 0xf0},
+		{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, K: 0x30, Jt: 0, Jf: 3},
+		{Code: unix.BPF_LD | unix.BPF_B | unix.BPF_ABS, K: 1},
+		{Code: unix.BPF_ALU | unix.BPF_MOD | unix.BPF_K, K: uint32(len(sockets))}, // truncation, number of sockets is small
+		{Code: unix.BPF_RET | unix.BPF_A},
+		{Code: unix.BPF_RET | unix.BPF_K, K: 0xffffffff}, // index out of range, kernel falls back to hash
+	}
+	fprog := unix.SockFprog{Len: uint16(len(program)), Filter: &program[0]} // truncation, program is short
+	raw, err := sockets[0].SyscallConn()
+	if err != nil {
+		return err
+	}
+	if err2 := raw.Control(func(fd uintptr) {
+		err = unix.SetsockoptSockFprog(int(fd), unix.SOL_SOCKET, unix.SO_ATTACH_REUSEPORT_CBPF, &fprog)
+	}); err2 != nil {
+		return err2
+	}
+	return err
+}
@@ -0,0 +1,33 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+//go:build !linux
+
+package dtlsudp
+
+import (
+	"errors"
+	"net"
+)
+
+var ErrReusePortNotSupported = errors.New("SO_REUSEPORT sharding is supported on Linux only")
+
+// on other platforms, only single socket is supported
+func OpenReusePortSockets(addressPort string, n int) ([]*net.UDPConn, error) {
+	if n != 1 {
+		return nil, ErrReusePortNotSupported
+	}
+	udpAddr, err := net.ResolveUDPAddr("udp", addressPort)
+	if err != nil {
+		return nil, err
+	}
+	socket, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, err
+	}
+	return []*net.UDPConn{socket}, nil
+}
+
+func AttachCIDSteeringBPF(sockets []*net.UDPConn) error {
+	return ErrReusePortNotSupported
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlsudp
+
+import (
+	"github.com/hrissan/dtls/circular"
+	"github.com/hrissan/dtls/dtlscore"
+)
+
+// Sender has three classes of work: stateless datagrams (HelloRetryRequest, stateless reset),
+// connections in handshake and established connections. Each class gets its weight of turns per round,
+// and turns of empty class go to others, so neither flood of ClientHello nor bulk transfer stalls the rest.
+// Within class, connections are served by deficit round-robin (Shreedhar and Varghese, 1995).
+// Each turn adds quantum bytes to connection deficit, connection sends datagrams while deficit is positive,
+// then goes to the back of the queue with what is left (negative deficit is carried, so datagrams larger
+// than quantum wait several turns). Deficit is stored only in the queue, connection which has nothing
+// more to send starts from 0 next time, as in original algorithm.
+// Batched sender serves turns one by one until batch is full, connection whose turn was cut short
+// by batch capacity continues it from the front of the queue in the next batch, without new quantum.
+const (
+	sendClassHelloRetry = iota
+	sendClassHandshake
+	sendClassEstablished
+	numSendClasses
+)
+
+type scheduledConn struct {
+	conn    *dtlscore.Connection
+	deficit int
+	resume  bool // turn was cut short, quantum is already added
+}
+
+// protected by sender mutex
+type scheduler struct {
+	weights [numSendClasses]int
+	quantum int
+
+	// hello retry request is stateless.
+	// we limit (options.HelloRetryQueueSize) how many such datagrams we wish to store
+	helloRetryQueue circular.Buffer[outgoingHRR]
+	connQueues      [numSendClasses]circular.Buffer[scheduledConn] // not used for sendClassHelloRetry
+
+	class int // served in current round
+	turns int // left for class in current round
+}
+
+func newScheduler(opts *dtlscore.Options) scheduler {
+	s := scheduler{
+		weights: [numSendClasses]int{opts.SenderWeightHelloRetry, opts.SenderWeightHandshake, opts.SenderWeightEstablished},
+		quantum: opts.SenderQuantum,
+	}
+	if opts.Preallocate {
+		s.helloRetryQueue.Reserve(opts.MaxHelloRetryQueueSize)
+		s.connQueues[sendClassHandshake].Reserve(opts.MaxHandshakes)
+		s.connQueues[sendClassEstablished].Reserve(opts.MaxConnections)
+	}
+	return s
+}
+
+func (s *scheduler) connLen() int {
+	return s.connQueues[sendClassHandshake].Len() + s.connQueues[sendClassEstablished].Len()
+}
+
+func (s *scheduler) empty() bool {
+	return s.helloRetryQueue.Len() == 0 && s.connLen() == 0
+}
+
+func connClass(conn *dtlscore.Connection) int {
+	if conn.SenderInHandshake() {
+		return sendClassHandshake
+	}
+	return sendClassEstablished
+}
+
+// connection must be already marked with SenderAddToQueue
+func (s *scheduler) pushConn(conn *dtlscore.Connection) {
+	s.connQueues[connClass(conn)].PushBack(scheduledConn{conn: conn})
+}
+
+// connection returned by next was served, if requeue, it is already marked with SenderAddToQueue
+func (s *scheduler) finishTurn(sc scheduledConn, requeue bool) {
+	if !requeue {
+		return
+	}
+	queue := &s.connQueues[connClass(sc.conn)]
+	if sc.deficit > 0 {
+		queue.PushFront(scheduledConn{conn: sc.conn, deficit: sc.deficit, resume: true})
+		return
+	}
+	queue.PushBack(scheduledConn{conn: sc.conn, deficit: sc.deficit})
+}
+
+// returns either hello retry datagram or connection (removed from queue) to serve, or nothing if empty
+func (s *scheduler) next() (outgoingHRR, scheduledConn, bool) {
+	for !s.empty() {
+		if s.turns == 0 {
+			s.class = (s.class + 1) % numSendClasses
+			s.turns = s.weights[s.class]
+			continue
+		}
+		if s.class == sendClassHelloRetry {
+			hrr, ok := s.helloRetryQueue.TryPopFront()
+			if !ok {
+				s.turns = 0
+				continue
+			}
+			s.turns--
+			return hrr, scheduledConn{}, true
+		}
+		queue := &s.connQueues[s.class]
+		sc, ok := queue.TryPopFront()
+		if !ok {
+			s.turns = 0
+			continue
+		}
+		if !sc.resume {
+			s.turns--
+			sc.deficit += s.quantum
+			if sc.deficit <= 0 { // still in queue, so stays marked
+				queue.PushBack(sc)
+				continue
+			}
+		}
+		sc.resume = false
+		sc.conn.SenderRemoveFromQueue()
+		return outgoingHRR{}, sc, true
+	}
+	return outgoingHRR{}, scheduledConn{}, false
+}
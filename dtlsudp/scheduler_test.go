@@ -0,0 +1,238 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package dtlsudp
+
+import (
+	"fmt"
+	"net/netip"
+	"testing"
+
+	"github.com/hrissan/dtls/dtlscore"
+	"github.com/hrissan/dtls/dtlsrand"
+	"github.com/hrissan/dtls/transport/stats"
+)
+
+// server connection sends records of recordSize bytes for as long as sender asks
+type bulkHandler struct {
+	testHandler
+	recordSize int
+	bulk       bool
+}
+
+func (h *bulkHandler) OnWriteRecordLocked(earlyData bool, recordBody []byte) (int, bool, bool, error) {
+	if earlyData || !h.bulk {
+		return 0, false, false, nil
+	}
+	return min(h.recordSize, len(recordBody)), true, true, nil
+}
+
+type bulkServerHandler struct {
+	recordSizes []int // for connections in order of creation
+	conns       []*dtlscore.Connection
+	handlers    []*bulkHandler
+}
+
+func (h *bulkServerHandler) OnNewConnection() (*dtlscore.Connection, dtlscore.ConnectionHandler) {
+	handler := &bulkHandler{}
+	if i := len(h.handlers); i < len(h.recordSizes) {
+		handler.recordSize = h.recordSizes[i]
+	}
+	conn := &dtlscore.Connection{}
+	h.conns = append(h.conns, conn)
+	h.handlers = append(h.handlers, handler)
+	return conn, handler
+}
+
+// datagrams written by sender of one peer are received by transport of another, synchronously
+type memoryNetwork struct {
+	peers     map[netip.AddrPort]*dtlscore.Transport
+	deliver   bool // if false, only counts
+	bytes     map[netip.AddrPort]int
+	datagrams map[netip.AddrPort]int
+	total     int
+}
+
+type memoryWriter struct {
+	network *memoryNetwork
+	from    netip.AddrPort
+}
+
+func (w *memoryWriter) writeBatch(messages []batchMessage) (int, error) {
+	for _, m := range messages {
+		for data := m.data; len(data) != 0; { // split GSO message
+			size := len(data)
+			if m.segment != 0 {
+				size = min(size, m.segment)
+			}
+			n := w.network
+			n.bytes[m.addr] += size
+			n.datagrams[m.addr]++
+			n.total += size
+			if tr := n.peers[m.addr]; tr != nil && n.deliver {
+				tr.ReceivedDatagram(append([]byte(nil), data[:size]...), w.from, nil)
+			}
+			data = data[size:]
+		}
+	}
+	return len(messages), nil
+}
+
+// sender is not running, test calls sendBatch
+type testPeer struct {
+	tr    *dtlscore.Transport
+	snd   *sender
+	addr  netip.AddrPort
+	w     *memoryWriter
+	batch *sendBatch
+}
+
+// sends until sender queues are empty, returns false if nothing was sent
+func (p *testPeer) flush() bool {
+	sent := false
+	for p.snd.sendBatch(p.w, p.batch) {
+		sent = true
+	}
+	return sent
+}
+
+type schedulerTest struct {
+	network       memoryNetwork
+	server        *testPeer
+	serverHandler bulkServerHandler
+	bulkAddrs     []netip.AddrPort
+	handshakeAddr netip.AddrPort // connection with server flight in send queue
+	hrrAddr       netip.AddrPort
+}
+
+func (st *schedulerTest) newPeer(opts *dtlscore.Options, handler dtlscore.TransportHandler, batchSize int, gso bool) *testPeer {
+	addr := netip.AddrPortFrom(netip.AddrFrom4([4]byte{127, 0, 0, 1}), uint16(10000+len(st.network.peers))) // truncation
+	p := &testPeer{snd: NewSender(opts), addr: addr}
+	p.tr = dtlscore.NewTransport(opts, p.snd, handler)
+	p.w = &memoryWriter{network: &st.network, from: addr}
+	p.batch = p.snd.newSendBatch(batchSize, gso)
+	st.network.peers[addr] = p.tr
+	return p
+}
+
+// Server has established connections sending records of recordSizes (all the time),
+// connection in handshake, and hello retry queue full of datagrams.
+// Test controls what is in server sender queues, because senders run only in flush and run.
+func newSchedulerTest(t *testing.T, recordSizes []int, batchSize int, gso bool) *schedulerTest {
+	st := &schedulerTest{
+		network: memoryNetwork{
+			peers:     map[netip.AddrPort]*dtlscore.Transport{},
+			deliver:   true,
+			bytes:     map[netip.AddrPort]int{},
+			datagrams: map[netip.AddrPort]int{},
+		},
+		serverHandler: bulkServerHandler{recordSizes: recordSizes},
+	}
+	serverOpts := dtlscore.DefaultTransportOptions(true, dtlsrand.CryptoRand(), stats.NewStatsLogQuiet())
+	serverOpts.Preallocate = false
+	serverOpts.ServerCertificate = testCertificate(t)
+	serverOpts.ALPNContinueOnMismatch = true
+	st.server = st.newPeer(serverOpts, &st.serverHandler, batchSize, gso)
+
+	newClient := func() *testPeer {
+		clientOpts := dtlscore.DefaultTransportOptions(false, dtlsrand.CryptoRand(), stats.NewStatsLogQuiet())
+		clientOpts.Preallocate = false
+		clientOpts.ALPNContinueOnMismatch = true
+		client := st.newPeer(clientOpts, nil, 1, false)
+		if err := client.tr.StartConnection(&dtlscore.Connection{}, &testHandler{}, st.server.addr); err != nil {
+			t.Fatalf("failed to start connection: %v", err)
+		}
+		return client
+	}
+	for range recordSizes {
+		client := newClient()
+		for i := 0; i < 20 && (client.flush() || st.server.flush()); i++ {
+		}
+		st.bulkAddrs = append(st.bulkAddrs, client.addr)
+	}
+	if len(st.serverHandler.conns) != len(recordSizes) {
+		t.Fatalf("server must have %d connections, has %d", len(recordSizes), len(st.serverHandler.conns))
+	}
+	// ClientHello, HelloRetryRequest, ClientHello with cookie, server flight stays in queue
+	client := newClient()
+	client.flush()
+	st.server.flush()
+	client.flush()
+	st.handshakeAddr = client.addr
+	for i, conn := range st.serverHandler.conns[:len(recordSizes)] {
+		conn.Lock()
+		if !conn.SenderInHandshake() {
+			st.serverHandler.handlers[i].bulk = true
+			conn.SignalWriteable()
+		}
+		conn.Unlock()
+		if !st.serverHandler.handlers[i].bulk {
+			t.Fatalf("handshake of connection %d did not finish", i)
+		}
+	}
+
+	st.hrrAddr = netip.MustParseAddrPort("127.0.0.2:1") // nobody there
+	for i := 0; i < serverOpts.MaxHelloRetryQueueSize; i++ {
+		st.server.snd.SendHelloRetryDatagram(st.server.snd.PopHelloRetryDatagramStorage(), 100, st.hrrAddr, netip.Addr{})
+	}
+	st.network.deliver = false // clients do not process bulk data
+	return st
+}
+
+// runs server sender until limit bytes are written
+func (st *schedulerTest) run(t *testing.T, limit int) {
+	for st.network.total = 0; st.network.total < limit; {
+		if !st.server.snd.sendBatch(st.server.w, st.server.batch) {
+			t.Fatalf("sender must not run out of datagrams")
+		}
+	}
+}
+
+var schedulerTestBatches = []struct {
+	size int
+	gso  bool
+}{{1, false}, {32, false}, {32, true}}
+
+func TestScheduler_EstablishedByteShares(t *testing.T) {
+	// datagram count round-robin would give the first connection 3/4 of bytes
+	recordSizes := []int{1200, 300, 60}
+	for _, batch := range schedulerTestBatches {
+		t.Run(fmt.Sprintf("batch=%d,gso=%v", batch.size, batch.gso), func(t *testing.T) {
+			st := newSchedulerTest(t, recordSizes, batch.size, batch.gso)
+			st.run(t, 4<<20)
+			established := 0
+			for _, addr := range st.bulkAddrs {
+				established += st.network.bytes[addr]
+			}
+			for i, addr := range st.bulkAddrs {
+				share := float64(st.network.bytes[addr]) / float64(established)
+				if share < 0.3 || share > 0.37 {
+					t.Fatalf("connection %d with records of %d bytes got %.2f of bytes, must get 1/3", i, recordSizes[i], share)
+				}
+			}
+		})
+	}
+}
+
+func TestScheduler_ClassesNotStarved(t *testing.T) {
+	for _, batch := range schedulerTestBatches {
+		t.Run(fmt.Sprintf("batch=%d,gso=%v", batch.size, batch.gso), func(t *testing.T) {
+			st := newSchedulerTest(t, []int{1200}, batch.size, batch.gso)
+			opts := st.server.snd.opts
+			st.run(t, 1<<20)
+			if st.network.bytes[st.handshakeAddr] == 0 {
+				t.Fatalf("server flight of connection in handshake was not sent")
+			}
+			established := st.network.bytes[st.bulkAddrs[0]]
+			hrrs := st.network.datagrams[st.hrrAddr]
+			if hrrs == 0 || established == 0 {
+				t.Fatalf("both classes must be served, got %d HelloRetryRequests and %d bytes", hrrs, established)
+			}
+			// each round is 1 HelloRetryRequest and 4 turns of established connection, quantum bytes each
+			rounds := float64(established) / float64(opts.SenderWeightEstablished*opts.SenderQuantum)
+			if ratio := float64(hrrs) / rounds; ratio < 0.8 || ratio > 1.25 {
+				t.Fatalf("sent %d HelloRetryRequests in %.0f rounds, must send %d per round", hrrs, rounds, opts.SenderWeightHelloRetry)
+			}
+		})
+	}
+}
@@ -5,24 +5,25 @@ package dtlsudp
 
 import (
 	"errors"
+	"fmt"
 	"net"
 	"net/netip"
 	"sync"
 	"time"
 
-	"github.com/hrissan/dtls/circular"
 	"github.com/hrissan/dtls/constants"
 	"github.com/hrissan/dtls/dtlscore"
 )
 
 // [rfc9147:4.4]
-const MinimumPMTUv4 = 576 - 8 - 20  // minus UDP header, minus IPv4 header
-const MinimumPMTUv6 = 1280 - 8 - 40 // minus UDP header, minus IPv6 header
+const MinimumPMTUv4 = constants.MinimumPMTUv4
+const MinimumPMTUv6 = constants.MinimumPMTUv6
 
 type outgoingHRR struct {
-	data *[constants.MaxOutgoingHRRDatagramLength]byte
-	size int
-	addr netip.AddrPort
+	data      *[constants.MaxOutgoingHRRDatagramLength]byte
+	size      int
+	addr      netip.AddrPort
+	localAddr netip.Addr
 }
 
 type sender struct {
@@ -32,24 +33,19 @@ type sender struct {
 	cond     *sync.Cond
 	shutdown bool
 
-	// hello retry request is stateless.
-	// we limit (options.HelloRetryQueueSize) how many such datagrams we wish to store
-	helloRetryQueue circular.Buffer[outgoingHRR]
-	helloRetryPool  []*[constants.MaxOutgoingHRRDatagramLength]byte // stack, not circular buffer
-
-	wantToWriteQueue circular.Buffer[*dtlscore.Connection]
+	sched          scheduler
+	helloRetryPool []*[constants.MaxOutgoingHRRDatagramLength]byte // stack, not circular buffer
 }
 
 func NewSender(opts *dtlscore.Options) *sender {
 	snd := &sender{
-		opts: opts,
+		opts:  opts,
+		sched: newScheduler(opts),
 	}
 	snd.cond = sync.NewCond(&snd.mu)
 
 	if opts.Preallocate {
-		snd.helloRetryQueue.Reserve(opts.MaxHelloRetryQueueSize)
 		snd.helloRetryPool = make([]*[constants.MaxOutgoingHRRDatagramLength]byte, 0, opts.MaxHelloRetryQueueSize)
-		snd.wantToWriteQueue.Reserve(opts.MaxConnections)
 	}
 	return snd
 }
@@ -59,94 +55,199 @@ func (snd *sender) Shutdown() {
 	snd.mu.Lock()
 	defer snd.mu.Unlock()
 	snd.shutdown = true
-	snd.helloRetryQueue.Clear()
+	snd.sched.helloRetryQueue.Clear()
 	snd.cond.Broadcast()
 }
 
 func (snd *sender) ready() bool {
-	return snd.shutdown || snd.helloRetryQueue.Len() != 0 || snd.wantToWriteQueue.Len() != 0
+	return snd.shutdown || !snd.sched.empty()
 }
 
 // blocks until sender.Close() is closed or socket is Closed (externally), whichever comes first
 func (snd *sender) GoRunUDP(socket *net.UDPConn) {
-	datagram := make([]byte, 65536)
-	snd.mu.Lock()
+	var w batchWriter = &udpWriter{socket: socket, oob: make([]byte, 0, 128)}
+	b := snd.newSendBatch(1, false)
+	if snd.opts.SocketBatchSize > 1 {
+		if bc := newBatchConn(socket, snd.opts.SocketBatchSize); bc != nil {
+			w = bc
+			b = snd.newSendBatch(snd.opts.SocketBatchSize, snd.opts.SocketGSO && bc.enableGSO())
+		}
+	}
 	for {
+		snd.mu.Lock()
 		if !snd.ready() {
 			snd.cond.Wait()
 		}
-		quit := snd.shutdown && snd.wantToWriteQueue.Len() == 0
-		// if we wish, we can make different ratio between sending from different queues
-		hrr, _ := snd.helloRetryQueue.TryPopFront()
-		conn, _ := snd.wantToWriteQueue.TryPopFront()
-		if conn != nil {
-			conn.SenderRemoveFromQueue()
-		}
+		quit := snd.shutdown && snd.sched.connLen() == 0
 		snd.mu.Unlock()
 		if quit {
 			return
 		}
-		if hrr.data != nil {
-			_ = snd.sendDatagram(socket, (*hrr.data)[:hrr.size], hrr.addr)
-			// drop stateless datagram on error, we'll generate it again on next ClientHello
+		snd.sendBatch(w, b)
+	}
+}
+
+// sendmmsg for batchConn, in tests also in-memory network
+type batchWriter interface {
+	// writes messages in order, returns how many were written before error
+	writeBatch(messages []batchMessage) (int, error)
+}
+
+// one write per message, when there is no sendmmsg or batching is disabled
+type udpWriter struct {
+	socket *net.UDPConn
+	oob    []byte
+}
+
+func (w *udpWriter) writeBatch(messages []batchMessage) (int, error) {
+	for i, m := range messages {
+		w.oob = appendPktInfo(w.oob[:0], m.localAddr)
+		if _, _, err := w.socket.WriteMsgUDPAddrPort(m.data, w.oob, m.addr); err != nil {
+			return i, err
 		}
-		addToSendQueue := false
-		if conn != nil {
-			addr, datagramSize, add := conn.SenderConstructDatagram(datagram[:MinimumPMTUv4])
-			if datagramSize == 0 && add {
-				panic("constructDatagram invariant violation")
-			}
-			if datagramSize != 0 {
-				_ = snd.sendDatagram(socket, datagram[:datagramSize], addr)
-				// drop datagram on error, we rely on timers to generate it again
-			}
-			addToSendQueue = add
+	}
+	return len(messages), nil
+}
+
+const maxGSOSegments = 64     // UDP_MAX_SEGMENTS of older kernels
+const maxGSOBytes = 65535 - 8 // UDP length field
+
+// buffers of sender goroutine, allocated once
+type sendBatch struct {
+	size     int  // max messages
+	gso      bool // same-size datagrams to the same address are sent as one message
+	storage  []byte
+	hrrs     []outgoingHRR
+	messages []batchMessage
+}
+
+func (snd *sender) newSendBatch(size int, gso bool) *sendBatch {
+	return &sendBatch{
+		size:     size,
+		gso:      gso,
+		storage:  make([]byte, size*snd.opts.PMTUMax), // connection limits datagram to its path MTU
+		hrrs:     make([]outgoingHRR, 0, size),
+		messages: make([]batchMessage, 0, size),
+	}
+}
+
+// collects up to b.size messages from hello retry queue and connections, then writes them.
+// Connection constructs datagrams in a row for its whole turn (unless batch is full).
+// Does not block, returns false if there was nothing to send.
+func (snd *sender) sendBatch(w batchWriter, b *sendBatch) bool {
+	pmtuMax := snd.opts.PMTUMax
+	served := false
+	pos := 0
+	snd.mu.Lock()
+	for len(b.messages) < b.size && pos+pmtuMax <= len(b.storage) {
+		hrr, sc, ok := snd.sched.next()
+		if !ok {
+			break
 		}
-		snd.mu.Lock()
+		served = true
 		if hrr.data != nil {
+			b.hrrs = append(b.hrrs, hrr)
+			b.messages = append(b.messages, batchMessage{data: (*hrr.data)[:hrr.size], addr: hrr.addr, localAddr: hrr.localAddr})
+			continue
+		}
+		snd.mu.Unlock()
+		var add bool
+		pos, add = snd.constructTurn(b, &sc, pos)
+		snd.mu.Lock()
+		snd.finishTurnLocked(sc, add)
+	}
+	snd.mu.Unlock()
+	for _, hrr := range b.hrrs {
+		snd.opts.Stats.SocketWriteDatagram((*hrr.data)[:hrr.size], hrr.addr)
+	}
+	snd.sendMessages(w, b, b.messages)
+	clear(b.messages) // do not leave aliases to hello retry storage
+	b.messages = b.messages[:0]
+	if len(b.hrrs) != 0 {
+		// drop stateless datagram on error, we'll generate it again on next ClientHello
+		snd.mu.Lock()
+		for i, hrr := range b.hrrs {
 			snd.helloRetryPool = append(snd.helloRetryPool, hrr.data)
+			b.hrrs[i] = outgoingHRR{}
+		}
+		b.hrrs = b.hrrs[:0]
+		snd.mu.Unlock()
+	}
+	return served
+}
+
+// appends datagrams of connection at b.storage[pos:] until its deficit is spent or batch is full,
+// add is false if connection has nothing more to send
+func (snd *sender) constructTurn(b *sendBatch, sc *scheduledConn, pos int) (int, bool) {
+	pmtuMax := snd.opts.PMTUMax
+	start := pos
+	segment := 0 // size of datagrams in current message, 0 if next datagram starts new message
+	for {
+		datagram := b.storage[pos : pos+pmtuMax]
+		addr, localAddr, datagramSize, add := sc.conn.SenderConstructDatagram(datagram)
+		if datagramSize == 0 && add {
+			panic("constructDatagram invariant violation")
+		}
+		if datagramSize != 0 {
+			snd.opts.Stats.SocketWriteDatagram(datagram[:datagramSize], addr)
+			var last *batchMessage // message we can append datagram to
+			if b.gso && segment != 0 {
+				last = &b.messages[len(b.messages)-1]
+			}
+			if last != nil && addr == last.addr && localAddr == last.localAddr && datagramSize <= segment &&
+				pos+datagramSize-start <= maxGSOBytes && (pos-start)/segment < maxGSOSegments {
+				last.data = b.storage[start : pos+datagramSize]
+				last.segment = segment
+			} else {
+				start = pos
+				segment = datagramSize
+				b.messages = append(b.messages, batchMessage{data: datagram[:datagramSize], addr: addr, localAddr: localAddr})
+			}
+			if datagramSize < segment { // shorter datagram ends GSO message
+				segment = 0
+			}
+			pos += datagramSize
 		}
-		if addToSendQueue { // could also have been registered while we were not under lock above
-			_ = snd.registerConnectionForSendLocked(conn)
+		sc.deficit -= datagramSize
+		if !add || sc.deficit <= 0 || len(b.messages) >= b.size || pos+pmtuMax > len(b.storage) {
+			return pos, add
 		}
 	}
 }
 
-// returns false if socket closed
-func (snd *sender) sendDatagram(socket *net.UDPConn, data []byte, addr netip.AddrPort) bool {
-	snd.opts.Stats.SocketWriteDatagram(data, addr)
-	n, err := socket.WriteToUDPAddrPort(data, addr)
-	if err != nil {
+// message which failed is dropped, we rely on timers to generate it again
+func (snd *sender) sendMessages(w batchWriter, b *sendBatch, messages []batchMessage) {
+	for retried := false; len(messages) != 0; {
+		n, err := w.writeBatch(messages)
+		if err == nil {
+			return
+		}
 		if errors.Is(err, net.ErrClosed) {
-			return false
+			return
+		}
+		if isICMPError(err) && !retried {
+			// pending ICMP error of an earlier datagram, receiver reads its address from error queue
+			retried = true
+			messages = messages[n:]
+			continue
 		}
-		// We are interested to receive ICMP message "destination unreachable" to shut down our connections.
-		// We tried setting socket option for error queue.
-		// _ = syscall.SetsockoptInt(int(file.Fd()), syscall.IPPROTO_IP, syscall.IP_RECVERR, 1)
-		// _ = syscall.SetsockoptInt(int(file.Fd()), syscall.IPPROTO_IPV6, syscall.IPV6_RECVERR, 1)
-		//
-		// And indeed we start receiving errors here, but the problem is that there is wrong address.
-		// Golang returns addr given to WriteToUDPAddrPort, while the actual error is from error queue.
-		// Error queue contains correct address from ICMP message, but it is ignored.
-		//var opErr *net.OpError
-		//if errors.As(err, &opErr) {
-		//	if sysErr, ok := opErr.Unwrap().(*syscall.Errno); ok && *sysErr == syscall.ECONNREFUSED {
-		//		fmt.Println("Connection refused error detected.")
-		//	} else {
-		//		fmt.Printf("Other network error: %v\n", err)
-		//	}
-		//}
-		snd.opts.Stats.SocketWriteError(n, addr, err)
+		retried = false
+		if messages[n].segment != 0 && b.gso {
+			// for example, device does not support checksum offload, we will not try again
+			fmt.Printf("dtls: UDP GSO disabled after send error: %v\n", err)
+			b.gso = false
+		}
+		snd.opts.Stats.SocketWriteError(0, messages[n].addr, err)
 		time.Sleep(snd.opts.SocketWriteErrorDelay)
+		messages = messages[n+1:]
 	}
-	return true
 }
 
 // returns nil if hello retry queue is at max capacity
 func (snd *sender) PopHelloRetryDatagramStorage() *[constants.MaxOutgoingHRRDatagramLength]byte {
 	snd.mu.Lock()
 	defer snd.mu.Unlock()
-	if snd.helloRetryQueue.Len() >= snd.opts.MaxHelloRetryQueueSize {
+	if snd.sched.helloRetryQueue.Len() >= snd.opts.MaxHelloRetryQueueSize {
 		return nil
 	}
 	if pos := len(snd.helloRetryPool) - 1; pos >= 0 {
@@ -158,7 +259,7 @@ func (snd *sender) PopHelloRetryDatagramStorage() *[constants.MaxOutgoingHRRData
 	return &[constants.MaxOutgoingHRRDatagramLength]byte{}
 }
 
-func (snd *sender) SendHelloRetryDatagram(data *[constants.MaxOutgoingHRRDatagramLength]byte, size int, addr netip.AddrPort) {
+func (snd *sender) SendHelloRetryDatagram(data *[constants.MaxOutgoingHRRDatagramLength]byte, size int, addr netip.AddrPort, localAddr netip.Addr) {
 	if data == nil {
 		panic("must be chunk previously allocated by PopHelloRetryDatagramStorage")
 	}
@@ -170,7 +271,7 @@ func (snd *sender) SendHelloRetryDatagram(data *[constants.MaxOutgoingHRRDatagra
 	if snd.shutdown {
 		snd.helloRetryPool = append(snd.helloRetryPool, data)
 	} else {
-		snd.helloRetryQueue.PushBack(outgoingHRR{data: data, size: size, addr: addr})
+		snd.sched.helloRetryQueue.PushBack(outgoingHRR{data: data, size: size, addr: addr, localAddr: localAddr})
 		snd.cond.Signal()
 	}
 }
@@ -178,18 +279,17 @@ func (snd *sender) SendHelloRetryDatagram(data *[constants.MaxOutgoingHRRDatagra
 func (snd *sender) RegisterConnectionForSend(conn *dtlscore.Connection) {
 	snd.mu.Lock()
 	defer snd.mu.Unlock()
-	if snd.registerConnectionForSendLocked(conn) {
+	if snd.shutdown { // we must drain the queue to quit
+		return
+	}
+	if conn.SenderAddToQueue() {
+		snd.sched.pushConn(conn)
 		snd.cond.Signal()
 	}
 }
 
-func (snd *sender) registerConnectionForSendLocked(conn *dtlscore.Connection) bool {
-	if snd.shutdown { // we must drain the queue to quit
-		return false
-	}
-	if !conn.SenderAddToQueue() {
-		return false
-	}
-	snd.wantToWriteQueue.PushBack(conn)
-	return true
+// deficit is carried by connection which still has data to send after its turn, see scheduler.go
+func (snd *sender) finishTurnLocked(sc scheduledConn, add bool) {
+	// if SenderAddToQueue fails, connection was registered while we were not under lock
+	snd.sched.finishTurn(sc, add && !snd.shutdown && sc.conn.SenderAddToQueue())
 }
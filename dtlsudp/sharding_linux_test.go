@@ -0,0 +1,239 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+//go:build linux
+
+package dtlsudp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hrissan/dtls/dtlscore"
+	"github.com/hrissan/dtls/dtlsrand"
+	"github.com/hrissan/dtls/transport/stats"
+)
+
+// stateless HelloRetryRequest path, which is what server does under handshake flood.
+// Clients send from different ports, so kernel spreads them over SO_REUSEPORT sockets,
+// each socket has its own receiver and sender goroutine.
+func BenchmarkSharding_HelloRetry(b *testing.B) {
+	clientHello := clientHelloDatagram(b)
+	const clients = 32
+	for _, shards := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			opts := dtlscore.DefaultTransportOptions(true, dtlsrand.CryptoRand(), stats.NewStatsLogQuiet())
+			opts.ALPNContinueOnMismatch = true
+			sockets, err := OpenReusePortSockets("127.0.0.1:0", shards)
+			if err != nil {
+				b.Skipf("cannot open sockets: %v", err)
+			}
+			serverAddr := sockets[0].LocalAddr().(*net.UDPAddr).AddrPort()
+			snds, coreSnds := NewSenders(opts, shards)
+			tr := dtlscore.NewShardedTransport(opts, coreSnds, nil)
+			done := make(chan struct{})
+			go func() {
+				GoRunUDPShards(tr, opts, snds, sockets)
+				close(done)
+			}()
+			var next atomic.Int64
+			var lost atomic.Int64
+			var wg sync.WaitGroup
+			b.ReportAllocs()
+			b.ResetTimer()
+			for c := 0; c < clients; c++ {
+				socket, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+				if err != nil {
+					b.Fatalf("cannot open client socket: %v", err)
+				}
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer socket.Close()
+					response := make([]byte, 65536)
+					for i := next.Add(1); i <= int64(b.N); i = next.Add(1) {
+						if _, err := socket.WriteToUDPAddrPort(clientHello, serverAddr); err != nil {
+							b.Errorf("cannot send ClientHello: %v", err)
+							return
+						}
+						_ = socket.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+						if _, _, err := socket.ReadFromUDPAddrPort(response); err != nil {
+							if !errors.Is(err, os.ErrDeadlineExceeded) {
+								b.Errorf("cannot receive HelloRetryRequest: %v", err)
+								return
+							}
+							lost.Add(1)
+						}
+					}
+				}()
+			}
+			wg.Wait()
+			b.StopTimer()
+			b.ReportMetric(float64(lost.Load())/float64(b.N), "lost/op")
+			tr.Shutdown()
+			<-done
+		})
+	}
+}
+
+// server connection sends every record back
+type echoHandler struct {
+	testHandler
+	conn    *dtlscore.Connection
+	pending []byte
+	echo    bool
+}
+
+func (h *echoHandler) OnReadRecordLocked(earlyData bool, recordBody []byte) error {
+	h.pending = append(h.pending[:0], recordBody...)
+	h.echo = true
+	h.conn.SignalWriteable()
+	return nil
+}
+
+func (h *echoHandler) OnWriteRecordLocked(earlyData bool, recordBody []byte) (int, bool, bool, error) {
+	if earlyData || !h.echo {
+		return 0, false, false, nil
+	}
+	h.echo = false
+	return copy(recordBody, h.pending), true, false, nil
+}
+
+type echoServerHandler struct{}
+
+func (echoServerHandler) OnNewConnection() (*dtlscore.Connection, dtlscore.ConnectionHandler) {
+	conn := &dtlscore.Connection{}
+	return conn, &echoHandler{conn: conn}
+}
+
+// client connection sends ping once per SignalWriteable, waits for echo
+type pingHandler struct {
+	testHandler
+	ping      []byte
+	send      bool
+	handshake chan struct{}
+	echo      chan struct{}
+}
+
+func (h *pingHandler) OnHandshakeLocked(dtlscore.HandshakeInfo) { close(h.handshake) }
+
+func (h *pingHandler) OnWriteRecordLocked(earlyData bool, recordBody []byte) (int, bool, bool, error) {
+	if earlyData || !h.send {
+		return 0, false, false, nil
+	}
+	h.send = false
+	return copy(recordBody, h.ping), true, false, nil
+}
+
+func (h *pingHandler) OnReadRecordLocked(earlyData bool, recordBody []byte) error {
+	select {
+	case h.echo <- struct{}{}:
+	default: // late echo of lost ping
+	}
+	return nil
+}
+
+// Established connections, records carry CID, so AttachCIDSteeringBPF selects socket and
+// transport finds connection by CID in sharded map. Each client connection has its own transport,
+// so clients are not the bottleneck. One op is one record sent to server and echoed back.
+func BenchmarkSharding_Established(b *testing.B) {
+	const clients = 32
+	for _, shards := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			opts := dtlscore.DefaultTransportOptions(true, dtlsrand.CryptoRand(), stats.NewStatsLogQuiet())
+			opts.ALPNContinueOnMismatch = true
+			opts.ServerCertificate = testCertificate(b)
+			opts.UseConnectionID = true
+			opts.CIDLength = 4
+			opts.CIDSteering = true
+			sockets, err := OpenReusePortSockets("127.0.0.1:0", shards)
+			if err != nil {
+				b.Skipf("cannot open sockets: %v", err)
+			}
+			if err := AttachCIDSteeringBPF(sockets); err != nil {
+				b.Skipf("cannot attach BPF: %v", err)
+			}
+			serverAddr := sockets[0].LocalAddr().(*net.UDPAddr).AddrPort()
+			snds, coreSnds := NewSenders(opts, shards)
+			tr := dtlscore.NewShardedTransport(opts, coreSnds, echoServerHandler{})
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				GoRunUDPShards(tr, opts, snds, sockets)
+			}()
+			conns := make([]*dtlscore.Connection, clients)
+			handlers := make([]*pingHandler, clients)
+			clientTransports := make([]*dtlscore.Transport, clients)
+			for c := range conns {
+				clientOpts := dtlscore.DefaultTransportOptions(false, dtlsrand.CryptoRand(), stats.NewStatsLogQuiet())
+				clientOpts.Preallocate = false
+				clientOpts.ALPNContinueOnMismatch = true
+				clientOpts.UseConnectionID = true
+				socket, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+				if err != nil {
+					b.Fatalf("cannot open client socket: %v", err)
+				}
+				snd := NewSender(clientOpts)
+				clientTransports[c] = dtlscore.NewTransport(clientOpts, snd, nil)
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					GoRunUDP(clientTransports[c], clientOpts, snd, socket)
+				}()
+				conns[c] = &dtlscore.Connection{}
+				handlers[c] = &pingHandler{ping: make([]byte, 100), handshake: make(chan struct{}), echo: make(chan struct{}, 1)}
+				if err := clientTransports[c].StartConnection(conns[c], handlers[c], serverAddr); err != nil {
+					b.Fatalf("failed to start connection: %v", err)
+				}
+			}
+			for _, h := range handlers {
+				select {
+				case <-h.handshake:
+				case <-time.After(10 * time.Second):
+					b.Fatalf("handshake did not finish")
+				}
+			}
+			var next atomic.Int64
+			var lost atomic.Int64
+			var clientsWG sync.WaitGroup
+			b.ReportAllocs()
+			b.ResetTimer()
+			for c := range conns {
+				clientsWG.Add(1)
+				go func() {
+					defer clientsWG.Done()
+					conn, h := conns[c], handlers[c]
+					timeout := time.NewTimer(time.Hour)
+					for i := next.Add(1); i <= int64(b.N); i = next.Add(1) {
+						conn.Lock()
+						h.send = true
+						conn.SignalWriteable()
+						conn.Unlock()
+						timeout.Reset(100 * time.Millisecond)
+						select {
+						case <-h.echo:
+						case <-timeout.C:
+							lost.Add(1)
+						}
+						timeout.Stop()
+					}
+				}()
+			}
+			clientsWG.Wait()
+			b.StopTimer()
+			b.ReportMetric(float64(lost.Load())/float64(b.N), "lost/op")
+			for _, ct := range clientTransports {
+				ct.Shutdown()
+			}
+			tr.Shutdown()
+			wg.Wait()
+		})
+	}
+}
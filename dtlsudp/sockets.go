@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"sync"
 
 	"github.com/hrissan/dtls/dtlscore"
 )
@@ -28,13 +29,48 @@ func OpenSocketMust(addressPort string) *net.UDPConn {
 // Blocks until t.Shutdown()
 // Closes socket as part of orderd shutdown, so receiver blocked in Read can stop.
 func GoRunUDP(t *dtlscore.Transport, opts *dtlscore.Options, snd *sender, socket *net.UDPConn) {
-	ch := make(chan struct{}, 1)
-	go func() {
-		snd.GoRunUDP(socket)
-		// on shutdown, sender first sends all alerts, then exits goroutine
-		_ = socket.Close() // so receiver also exits
-		ch <- struct{}{}
-	}()
-	GoRunReceiverUDP(t, opts, socket)
-	<-ch
+	GoRunUDPShards(t, opts, []*sender{snd}, []*net.UDPConn{socket})
+}
+
+// One sender per socket, pass the second result to dtlscore.NewShardedTransport,
+// and the first one to GoRunUDPShards.
+func NewSenders(opts *dtlscore.Options, n int) ([]*sender, []dtlscore.Sender) {
+	snds := make([]*sender, n)
+	coreSnds := make([]dtlscore.Sender, n)
+	for i := range snds {
+		snds[i] = NewSender(opts)
+		coreSnds[i] = snds[i]
+	}
+	return snds, coreSnds
+}
+
+// Blocks until t.Shutdown()
+// Each socket has its own reading and sending goroutine, datagrams from sockets[i] are passed
+// to transport as shard i, and connections which stick to shard i are sent by snds[i] to sockets[i].
+func GoRunUDPShards(t *dtlscore.Transport, opts *dtlscore.Options, snds []*sender, sockets []*net.UDPConn) {
+	if len(snds) != len(sockets) {
+		panic("there must be one sender per socket")
+	}
+	go t.Clock().GoRun() // until t.Shutdown()
+	if opts.KeySharePoolSize != 0 {
+		go t.KeySharePool().GoRun() // until t.Shutdown()
+	}
+	for i := 0; i < opts.ComputeGoroutines; i++ {
+		go t.ComputePool().GoRun() // until t.Shutdown()
+	}
+	var wg sync.WaitGroup
+	for i, socket := range sockets {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			snds[i].GoRunUDP(socket)
+			// on shutdown, sender first sends all alerts, then exits goroutine
+			_ = socket.Close() // so receiver also exits
+		}()
+		go func() {
+			defer wg.Done()
+			GoRunReceiverShardUDP(t, opts, i, socket)
+		}()
+	}
+	wg.Wait()
 }
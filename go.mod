@@ -6,4 +6,4 @@ toolchain go1.24.6
 
 require golang.org/x/crypto v0.35.0
 
-require golang.org/x/sys v0.30.0 // indirect
+require golang.org/x/sys v0.30.0
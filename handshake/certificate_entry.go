@@ -6,5 +6,14 @@ package handshake
 // after parsing, slices inside point to datagram, so must not be retained
 type CertificateEntry struct {
 	CertData        []byte
-	ExtenstionsData []byte // we do not write extensions, and skip during read
+	ExtenstionsData []byte // without uint16 length prefix
+}
+
+// slices inside ext will point to ExtenstionsData
+func (c *CertificateEntry) ParseExtensions(ext *ExtensionsSet) error {
+	return ext.parseInside(c.ExtenstionsData, false, false, false, false, nil)
+}
+
+func (c *CertificateEntry) SetExtensions(ext *ExtensionsSet) {
+	c.ExtenstionsData = ext.WriteInside(c.ExtenstionsData[:0], false, false, false, nil)
 }
@@ -13,19 +13,34 @@ import (
 )
 
 const (
+	EXTENSION_STATUS_REQUEST        = 0x0005
 	EXTENSION_SUPPORTED_GROUPS      = 0x000a
 	EXTENSION_SIGNATURE_ALGORITHMS  = 0x000d
 	EXTENSION_ALPN                  = 0x0010
 	EXTENSION_ENCRYPT_THEN_MAC      = 0x0016
+	EXTENSION_RECORD_SIZE_LIMIT     = 0x001c
 	EXTENSION_PRE_SHARED_KEY        = 0x0029
 	EXTENSION_EARLY_DATA            = 0x002a
 	EXTENSION_SUPPORTED_VERSIONS    = 0x002b
 	EXTENSION_COOKIE                = 0x002c
 	EXTENSION_PSK_KEY_EXCHANGE_MODE = 0x002d
+	EXTENSION_POST_HANDSHAKE_AUTH   = 0x0031
 	EXTENSION_KEY_SHARE             = 0x0033
+	EXTENSION_CONNECTION_ID         = 0x0036
+	EXTENSION_RRC                   = 0x003d // [draft-ietf-tls-dtls-rrc] temporary code point
+
+	// [draft-pismenny-tls-dtls-plaintext-sequence-number] not assigned yet, we use value from private range
+	EXTENSION_PLAINTEXT_SEQUENCE_NUMBER = 0xff5e
 )
 
+// [rfc8449:4] Endpoints MUST NOT send a "record_size_limit" extension with a value smaller than 64.
+const MinRecordSizeLimit = 64
+
 var ErrInvalidEarlyDataIndicationSize = errors.New("invalid EarlyDataIndicationSize")
+var ErrInvalidRecordSizeLimit = errors.New("invalid record_size_limit")
+var ErrInvalidPostHandshakeAuthSize = errors.New("invalid post_handshake_auth")
+var ErrInvalidRRCSize = errors.New("invalid rrc")
+var ErrInvalidPlaintextSequenceNumberSize = errors.New("invalid plaintext_sequence_number")
 var ErrPreSharedKeyExtensionMustBeLast = errors.New("psk_key_exchange_modes extension must be last")
 
 // after parsing, slices inside point to datagram, so must not be retained
@@ -40,6 +55,14 @@ type ExtensionsSet struct {
 	EarlyDataMaxSize       uint32
 	EncryptThenMacSet      bool
 
+	// [rfc8446:4.4.2.1] in ClientHello, CertificateRequest and leaf CertificateEntry
+	StatusRequestSet bool
+	StatusRequest    StatusRequest
+
+	// [rfc8449:4] for TLS 1.3, value includes content type and padding
+	RecordSizeLimitSet bool
+	RecordSizeLimit    uint16
+
 	ALPNSet bool
 	ALPN    ALPN
 
@@ -52,8 +75,20 @@ type ExtensionsSet struct {
 	PskExchangeModesSet bool
 	PskExchangeModes    PskExchangeModes
 
+	PostHandshakeAuthSet bool // [rfc8446:4.2.6]
+
 	PreSharedKeySet bool
 	PreSharedKey    PreSharedKey
+
+	// [rfc9146:3] CID sender wants to receive in records, can be empty
+	ConnectionIDSet bool
+	ConnectionID    []byte
+
+	RRCSet bool // [draft-ietf-tls-dtls-rrc] empty, in ClientHello and EncryptedExtensions
+
+	// [draft-pismenny-tls-dtls-plaintext-sequence-number] empty, in ClientHello and ServerHello,
+	// because it affects records with handshake keys
+	PlaintextSequenceNumberSet bool
 }
 
 func (msg *ExtensionsSet) parseCookie(body []byte) (err error) {
@@ -64,6 +99,14 @@ func (msg *ExtensionsSet) parseCookie(body []byte) (err error) {
 	return format.ParserReadFinish(body, offset)
 }
 
+func (msg *ExtensionsSet) parseConnectionID(body []byte) (err error) {
+	offset := 0
+	if offset, msg.ConnectionID, err = format.ParserReadByteLength(body, offset); err != nil {
+		return err
+	}
+	return format.ParserReadFinish(body, offset)
+}
+
 func (msg *ExtensionsSet) parseInside(body []byte, isClientHello bool, isNewSessionTicket bool, isServerHello bool, isHelloRetryRequest bool, bindersListLength *int) (err error) {
 	offset := 0
 	for offset < len(body) {
@@ -76,6 +119,16 @@ func (msg *ExtensionsSet) parseInside(body []byte, isClientHello bool, isNewSess
 			return err
 		}
 		switch extensionType { // skip unknown/not needed
+		case EXTENSION_STATUS_REQUEST:
+			var statusRequest StatusRequest
+			if err := statusRequest.Parse(extensionBody, isClientHello); err != nil {
+				return err
+			}
+			if isClientHello && !statusRequest.OCSP {
+				continue // [rfc6066:8] we support only ocsp
+			}
+			msg.StatusRequest = statusRequest
+			msg.StatusRequestSet = true
 		case EXTENSION_SUPPORTED_GROUPS:
 			if err := msg.SupportedGroups.Parse(extensionBody); err != nil {
 				return err
@@ -103,6 +156,15 @@ func (msg *ExtensionsSet) parseInside(body []byte, isClientHello bool, isNewSess
 				}
 			}
 			msg.EarlyDataSet = true
+		case EXTENSION_RECORD_SIZE_LIMIT: // [rfc8449:4]
+			if len(extensionBody) != 2 {
+				return ErrInvalidRecordSizeLimit
+			}
+			msg.RecordSizeLimit = binary.BigEndian.Uint16(extensionBody)
+			if msg.RecordSizeLimit < MinRecordSizeLimit {
+				return dtlserrors.ErrRecordSizeLimitTooSmall
+			}
+			msg.RecordSizeLimitSet = true
 		case EXTENSION_SUPPORTED_VERSIONS: // Supported Versions
 			if err := msg.SupportedVersions.Parse(extensionBody, isServerHello); err != nil {
 				return err
@@ -118,6 +180,11 @@ func (msg *ExtensionsSet) parseInside(body []byte, isClientHello bool, isNewSess
 				return err
 			}
 			msg.KeyShareSet = true
+		case EXTENSION_CONNECTION_ID:
+			if err := msg.parseConnectionID(extensionBody); err != nil {
+				return err
+			}
+			msg.ConnectionIDSet = true
 		case EXTENSION_PSK_KEY_EXCHANGE_MODE:
 			if isServerHello {
 				// [rfc8446:4.2.9]
@@ -127,6 +194,21 @@ func (msg *ExtensionsSet) parseInside(body []byte, isClientHello bool, isNewSess
 				return err
 			}
 			msg.PskExchangeModesSet = true
+		case EXTENSION_POST_HANDSHAKE_AUTH: // [rfc8446:4.2.6]
+			if len(extensionBody) != 0 {
+				return ErrInvalidPostHandshakeAuthSize
+			}
+			msg.PostHandshakeAuthSet = true
+		case EXTENSION_RRC:
+			if len(extensionBody) != 0 {
+				return ErrInvalidRRCSize
+			}
+			msg.RRCSet = true
+		case EXTENSION_PLAINTEXT_SEQUENCE_NUMBER:
+			if len(extensionBody) != 0 {
+				return ErrInvalidPlaintextSequenceNumberSize
+			}
+			msg.PlaintextSequenceNumberSet = true
 		case EXTENSION_PRE_SHARED_KEY:
 			if err := msg.PreSharedKey.Parse(extensionBody, isServerHello, bindersListLength); err != nil {
 				return err
@@ -155,6 +237,12 @@ func (msg *ExtensionsSet) Parse(body []byte, isClientHello bool, isNewSessionTic
 
 func (msg *ExtensionsSet) WriteInside(body []byte, isNewSessionTicket bool, isServerHello bool, isHelloRetryRequest bool, bindersListLength *int) []byte {
 	var mark int
+	if msg.StatusRequestSet {
+		body = binary.BigEndian.AppendUint16(body, EXTENSION_STATUS_REQUEST)
+		body, mark = format.MarkUint16Offset(body)
+		body = msg.StatusRequest.Write(body)
+		format.FillUint16Offset(body, mark)
+	}
 	if msg.SupportedVersionsSet {
 		body = binary.BigEndian.AppendUint16(body, EXTENSION_SUPPORTED_VERSIONS)
 		body, mark = format.MarkUint16Offset(body)
@@ -192,6 +280,12 @@ func (msg *ExtensionsSet) WriteInside(body []byte, isNewSessionTicket bool, isSe
 		body, mark = format.MarkUint16Offset(body)
 		format.FillUint16Offset(body, mark)
 	}
+	if msg.RecordSizeLimitSet {
+		body = binary.BigEndian.AppendUint16(body, EXTENSION_RECORD_SIZE_LIMIT)
+		body, mark = format.MarkUint16Offset(body)
+		body = binary.BigEndian.AppendUint16(body, msg.RecordSizeLimit)
+		format.FillUint16Offset(body, mark)
+	}
 	if msg.CookieSet {
 		body = binary.BigEndian.AppendUint16(body, EXTENSION_COOKIE)
 		body, mark = format.MarkUint16Offset(body)
@@ -211,6 +305,28 @@ func (msg *ExtensionsSet) WriteInside(body []byte, isNewSessionTicket bool, isSe
 		body = msg.PskExchangeModes.Write(body)
 		format.FillUint16Offset(body, mark)
 	}
+	if msg.PostHandshakeAuthSet {
+		body = binary.BigEndian.AppendUint16(body, EXTENSION_POST_HANDSHAKE_AUTH)
+		body, mark = format.MarkUint16Offset(body)
+		format.FillUint16Offset(body, mark)
+	}
+	if msg.ConnectionIDSet {
+		body = binary.BigEndian.AppendUint16(body, EXTENSION_CONNECTION_ID)
+		body, mark = format.MarkUint16Offset(body)
+		body = append(body, safecast.Cast[uint8](len(msg.ConnectionID)))
+		body = append(body, msg.ConnectionID...)
+		format.FillUint16Offset(body, mark)
+	}
+	if msg.RRCSet {
+		body = binary.BigEndian.AppendUint16(body, EXTENSION_RRC)
+		body, mark = format.MarkUint16Offset(body)
+		format.FillUint16Offset(body, mark)
+	}
+	if msg.PlaintextSequenceNumberSet {
+		body = binary.BigEndian.AppendUint16(body, EXTENSION_PLAINTEXT_SEQUENCE_NUMBER)
+		body, mark = format.MarkUint16Offset(body)
+		format.FillUint16Offset(body, mark)
+	}
 	// "pre_shared_key" must be last [rfc8446:4.2.11] (which MUST be the last extension in the ClientHello)
 	if msg.PreSharedKeySet {
 		body = binary.BigEndian.AppendUint16(body, EXTENSION_PRE_SHARED_KEY)
@@ -3,4 +3,31 @@
 
 package handshake
 
-// TODO - later
+import (
+	"github.com/hrissan/dtls/format"
+)
+
+// [rfc8446:4.3.2]
+// after parsing, slices inside point to datagram, so must not be retained
+type MsgCertificateRequest struct {
+	RequestContext []byte
+	Extensions     ExtensionsSet
+}
+
+func (msg *MsgCertificateRequest) MessageKind() string { return "handshake" }
+func (msg *MsgCertificateRequest) MessageName() string { return "CertificateRequest" }
+
+func (msg *MsgCertificateRequest) Parse(body []byte) (err error) {
+	offset := 0
+	if offset, msg.RequestContext, err = format.ParserReadByteLength(body, offset); err != nil {
+		return err
+	}
+	return msg.Extensions.Parse(body[offset:], false, false, false, false, nil)
+}
+
+func (msg *MsgCertificateRequest) Write(body []byte) []byte {
+	body, mark := format.MarkByteOffset(body)
+	body = append(body, msg.RequestContext...)
+	format.FillByteOffset(body, mark)
+	return msg.Extensions.Write(body, false, false, false, nil)
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package handshake
+
+import (
+	"errors"
+
+	"github.com/hrissan/dtls/format"
+	"github.com/hrissan/dtls/safecast"
+)
+
+// [rfc6066:8] [rfc8446:4.4.2.1]
+const StatusTypeOCSP = 1
+
+var ErrStatusRequestWrongFormat = errors.New("status_request extension has wrong format")
+
+// In ClientHello, this is CertificateStatusRequest, we only support ocsp status_type,
+// and do not send (ignore when parsing) responder_id_list and request_extensions.
+// In CertificateEntry of the leaf certificate, this is CertificateStatus, OCSPResponse is set.
+// In CertificateRequest, extension is empty.
+// after parsing, slices inside point to datagram, so must not be retained
+type StatusRequest struct {
+	OCSP         bool // status_type ocsp was requested or sent
+	OCSPResponse []byte
+}
+
+func (msg *StatusRequest) Parse(body []byte, isClientHello bool) (err error) {
+	if !isClientHello && len(body) == 0 {
+		return nil // [rfc8446:4.4.2.1] empty "status_request" in CertificateRequest
+	}
+	offset := 0
+	var statusType byte
+	if offset, statusType, err = format.ParserReadByte(body, offset); err != nil {
+		return err
+	}
+	if statusType != StatusTypeOCSP {
+		if !isClientHello {
+			return ErrStatusRequestWrongFormat
+		}
+		return nil // skip unknown, format of the rest depends on status type
+	}
+	msg.OCSP = true
+	if !isClientHello {
+		if offset, msg.OCSPResponse, err = format.ParserReadUint24Length(body, offset); err != nil {
+			return err
+		}
+		if len(msg.OCSPResponse) == 0 {
+			return ErrStatusRequestWrongFormat
+		}
+		return format.ParserReadFinish(body, offset)
+	}
+	if offset, _, err = format.ParserReadUint16Length(body, offset); err != nil { // responder_id_list
+		return err
+	}
+	if offset, _, err = format.ParserReadUint16Length(body, offset); err != nil { // request_extensions
+		return err
+	}
+	return format.ParserReadFinish(body, offset)
+}
+
+func (msg *StatusRequest) Write(body []byte) []byte {
+	body = append(body, StatusTypeOCSP)
+	if len(msg.OCSPResponse) != 0 {
+		body = format.AppendUint24(body, safecast.Cast[uint32](len(msg.OCSPResponse)))
+		return append(body, msg.OCSPResponse...)
+	}
+	return append(body, 0, 0, 0, 0) // empty responder_id_list and request_extensions
+}
@@ -45,7 +45,9 @@ type Keys struct {
 
 	SuiteID ciphersuite.ID
 
-	// enabled extensions and saves us 50% memory on crypto contexts
+	// [draft-pismenny-tls-dtls-plaintext-sequence-number] negotiated in ClientHello/ServerHello,
+	// saves us 50% memory on AES contexts. Early data keys (epoch 1) are computed before
+	// negotiation, so they always encrypt sequence numbers.
 	DoNotEncryptSequenceNumbers bool
 	// we should request update only once per epoch, and this must be separate flag from sendKeyUpdateUpdateRequested
 	// otherwise we will request update again after peer's ack, but before actual epoch update
@@ -76,6 +78,10 @@ func (keys *Keys) SequenceNumberLimit() uint64 {
 	return min(keys.Suite().ProtectionLimit(), record.MaxSeq)
 }
 
+func (keys *Keys) FailedDeprotectionLimit() uint64 {
+	return keys.Suite().IntegrityLimit()
+}
+
 func ComputeEarlySecret(suite ciphersuite.Suite, psk []byte) ciphersuite.Hash {
 	// [rfc8446:4.2.11.2] PSK Binder
 	// Derive-Secret(., "ext binder" | "res binder", "") = binder_key
@@ -110,12 +116,12 @@ func (keys *Keys) ComputeHandshakeKeys(suite ciphersuite.Suite, roleServer bool,
 	switch keys.ReceiveEpoch {
 	case 0: // client and server if no early data negotiated
 		keys.ReceiveEpoch = 2
-		keys.ReceiveSymmetric = suite.ResetSymmetricKeys(keys.ReceiveSymmetric, handshakeTrafficSecretReceive)
+		keys.ReceiveSymmetric = suite.ResetSymmetricKeys(keys.ReceiveSymmetric, handshakeTrafficSecretReceive, keys.DoNotEncryptSequenceNumbers)
 		keys.ReceiveNextSeq.Reset()
 	case 1: // server if early data negotiated
 		keys.NewReceiveKeysSet = true
 		keys.ReceiveEpoch = 2
-		keys.NewReceiveSymmetric = suite.ResetSymmetricKeys(keys.NewReceiveSymmetric, handshakeTrafficSecretReceive)
+		keys.NewReceiveSymmetric = suite.ResetSymmetricKeys(keys.NewReceiveSymmetric, handshakeTrafficSecretReceive, keys.DoNotEncryptSequenceNumbers)
 		keys.NewReceiveNextSeq.Reset()
 	default:
 		panic("handshake receive keys state machine violation")
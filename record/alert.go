@@ -5,6 +5,7 @@ package record
 
 import (
 	"errors"
+	"strconv"
 
 	"github.com/hrissan/dtls/format"
 )
@@ -19,6 +20,97 @@ const (
 	AlerLevelFatal   = 2
 )
 
+// [rfc8446:6] alert descriptions, we do not define deprecated ones
+const (
+	AlertCloseNotify                  = 0
+	AlertUnexpectedMessage            = 10
+	AlertBadRecordMAC                 = 20
+	AlertRecordOverflow               = 22
+	AlertHandshakeFailure             = 40
+	AlertBadCertificate               = 42
+	AlertUnsupportedCertificate       = 43
+	AlertCertificateRevoked           = 44
+	AlertCertificateExpired           = 45
+	AlertCertificateUnknown           = 46
+	AlertIllegalParameter             = 47
+	AlertUnknownCA                    = 48
+	AlertAccessDenied                 = 49
+	AlertDecodeError                  = 50
+	AlertDecryptError                 = 51
+	AlertProtocolVersion              = 70
+	AlertInsufficientSecurity         = 71
+	AlertInternalError                = 80
+	AlertInappropriateFallback        = 86
+	AlertUserCanceled                 = 90
+	AlertMissingExtension             = 109
+	AlertUnsupportedExtension         = 110
+	AlertUnrecognizedName             = 112
+	AlertBadCertificateStatusResponse = 113
+	AlertUnknownPSKIdentity           = 115
+	AlertCertificateRequired          = 116
+	AlertNoApplicationProtocol        = 120
+)
+
+func AlertDescriptionName(description byte) string {
+	switch description {
+	case AlertCloseNotify:
+		return "close_notify"
+	case AlertUnexpectedMessage:
+		return "unexpected_message"
+	case AlertBadRecordMAC:
+		return "bad_record_mac"
+	case AlertRecordOverflow:
+		return "record_overflow"
+	case AlertHandshakeFailure:
+		return "handshake_failure"
+	case AlertBadCertificate:
+		return "bad_certificate"
+	case AlertUnsupportedCertificate:
+		return "unsupported_certificate"
+	case AlertCertificateRevoked:
+		return "certificate_revoked"
+	case AlertCertificateExpired:
+		return "certificate_expired"
+	case AlertCertificateUnknown:
+		return "certificate_unknown"
+	case AlertIllegalParameter:
+		return "illegal_parameter"
+	case AlertUnknownCA:
+		return "unknown_ca"
+	case AlertAccessDenied:
+		return "access_denied"
+	case AlertDecodeError:
+		return "decode_error"
+	case AlertDecryptError:
+		return "decrypt_error"
+	case AlertProtocolVersion:
+		return "protocol_version"
+	case AlertInsufficientSecurity:
+		return "insufficient_security"
+	case AlertInternalError:
+		return "internal_error"
+	case AlertInappropriateFallback:
+		return "inappropriate_fallback"
+	case AlertUserCanceled:
+		return "user_canceled"
+	case AlertMissingExtension:
+		return "missing_extension"
+	case AlertUnsupportedExtension:
+		return "unsupported_extension"
+	case AlertUnrecognizedName:
+		return "unrecognized_name"
+	case AlertBadCertificateStatusResponse:
+		return "bad_certificate_status_response"
+	case AlertUnknownPSKIdentity:
+		return "unknown_psk_identity"
+	case AlertCertificateRequired:
+		return "certificate_required"
+	case AlertNoApplicationProtocol:
+		return "no_application_protocol"
+	}
+	return "alert(" + strconv.Itoa(int(description)) + ")" // widening
+}
+
 type Alert struct {
 	Level       byte
 	Description byte
@@ -28,7 +120,25 @@ func (msg *Alert) IsFatal() bool {
 	return msg.Level == AlerLevelFatal
 }
 
-func AlertCloseNormal() Alert { return Alert{Level: 2, Description: 0} }
+// [rfc8446:6.1] close_notify is the only alert we send with warning level
+func AlertCloseNormal() Alert { return Alert{Level: AlerLevelWarning, Description: AlertCloseNotify} }
+
+func AlertFatal(description byte) Alert {
+	return Alert{Level: AlerLevelFatal, Description: description}
+}
+
+// [rfc8446:6] all alerts except close_notify and user_canceled are error alerts
+// and must be treated as fatal regardless of AlertLevel
+func (msg *Alert) IsError() bool {
+	return msg.Description != AlertCloseNotify && msg.Description != AlertUserCanceled
+}
+
+func (msg Alert) String() string {
+	if msg.Level == AlerLevelFatal {
+		return "fatal " + AlertDescriptionName(msg.Description)
+	}
+	return AlertDescriptionName(msg.Description)
+}
 
 func (msg *Alert) Parse(body []byte) (err error) {
 	offset := 0
@@ -45,7 +155,6 @@ func (msg *Alert) Parse(body []byte) (err error) {
 	if offset, msg.Description, err = format.ParserReadByte(body, offset); err != nil {
 		return err
 	}
-	// we do not classify descriptions yet. TODO - some logic
 	return format.ParserReadFinish(body, offset)
 }
 
@@ -11,8 +11,24 @@ import (
 const MaxCiphertextRecordLength = MaxPlaintextRecordLength + 256 // [rfc8446:5.2]
 
 // This does not include CID size and AEAD seal, they are deterministic but depend on runtime parameters
-const OutgoingCiphertextRecordHeader8 = 4  // first byte + 16-bit seqnum + 16-bit length
-const OutgoingCiphertextRecordHeader16 = 5 // first byte + 8-bit seqnum + 16-bit length
+const OutgoingCiphertextRecordHeader8 = 4    // first byte + 8-bit seqnum + 16-bit length
+const OutgoingCiphertextRecordHeader16 = 5   // first byte + 16-bit seqnum + 16-bit length
+const OutgoingCiphertextRecordLengthSize = 2 // [rfc9147:4] length can be omitted in the last record of datagram
+
+// header size (without CID) defines header format of records we send
+func OutgoingCiphertextHeaderFormat(hdrSize int) (has16bitSeqNum bool, hasLength bool, ok bool) {
+	switch hdrSize {
+	case OutgoingCiphertextRecordHeader8:
+		return false, true, true
+	case OutgoingCiphertextRecordHeader16:
+		return true, true, true
+	case OutgoingCiphertextRecordHeader8 - OutgoingCiphertextRecordLengthSize:
+		return false, false, true
+	case OutgoingCiphertextRecordHeader16 - OutgoingCiphertextRecordLengthSize:
+		return true, false, true
+	}
+	return false, false, false
+}
 
 func IsEncryptedRecord(fb byte) bool {
 	return fb&0b11100000 == 0b00100000
@@ -100,7 +116,10 @@ func (hdr *Encrypted) Parse(datagram []byte, cIDLength int) (n int, err error) {
 		hdr.SeqNum = datagram[offset : offset+1]
 		offset += 1
 	}
-	if !hdr.HasLength() {
+	if !hdr.HasLength() { // [rfc9147:4] record extends to the end of datagram
+		if len(datagram)-offset > MaxCiphertextRecordLength {
+			return 0, ErrCiphertextRecordBodyTooLong
+		}
 		hdr.Header = datagram[:offset]
 		hdr.Ciphertext = datagram[offset:]
 		return len(datagram), nil
@@ -109,7 +128,7 @@ func (hdr *Encrypted) Parse(datagram []byte, cIDLength int) (n int, err error) {
 		return 0, ErrCiphertextRecordTooShort
 	}
 	length := int(binary.BigEndian.Uint16(datagram[offset:])) // widening
-	if length > MaxCiphertextRecordLength {                   // TODO - generate record_overflow alert
+	if length > MaxCiphertextRecordLength {                   // unauthenticated, so silently discarded [rfc9147:4.5.2]
 		return 0, ErrCiphertextRecordBodyTooLong
 	}
 	offset += 2
@@ -0,0 +1,80 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package record
+
+import (
+	"bytes"
+	"testing"
+)
+
+func appendTestHeader(datagram []byte, cid []byte, has16bitSeqNum bool, hasLength bool, ciphertext []byte) []byte {
+	datagram = append(datagram, CiphertextHeaderFirstByte(len(cid) != 0, has16bitSeqNum, hasLength, 3))
+	datagram = append(datagram, cid...)
+	datagram = append(datagram, 0xAB)
+	if has16bitSeqNum {
+		datagram = append(datagram, 0xCD)
+	}
+	if hasLength {
+		datagram = append(datagram, byte(len(ciphertext)>>8), byte(len(ciphertext))) // truncation
+	}
+	return append(datagram, ciphertext...)
+}
+
+func TestEncryptedParseFormats(t *testing.T) {
+	ciphertext := []byte("0123456789abcdef")
+	for _, cid := range [][]byte{nil, {1, 2, 3}} {
+		for _, has16bitSeqNum := range []bool{false, true} {
+			for _, hasLength := range []bool{false, true} {
+				datagram := appendTestHeader(nil, cid, has16bitSeqNum, hasLength, ciphertext)
+				if hasLength { // 2 records, the last one without length
+					datagram = appendTestHeader(datagram, cid, has16bitSeqNum, false, ciphertext)
+				}
+				var hdr Encrypted
+				n, err := hdr.Parse(datagram, len(cid))
+				if err != nil || !bytes.Equal(hdr.Ciphertext, ciphertext) || !bytes.Equal(hdr.CID, cid) {
+					t.Fatalf("failed to parse record cid=%x 16bit=%v length=%v: %v", cid, has16bitSeqNum, hasLength, err)
+				}
+				hdrSize := len(hdr.Header) - len(cid)
+				if s16, l, ok := OutgoingCiphertextHeaderFormat(hdrSize); !ok || s16 != has16bitSeqNum || l != hasLength {
+					t.Fatalf("wrong header size %d", hdrSize)
+				}
+				if n != len(datagram) {
+					if n, err = hdr.Parse(datagram[n:], len(cid)); err != nil || n != len(hdr.Header)+len(ciphertext) {
+						t.Fatalf("failed to parse the last record")
+					}
+				}
+			}
+		}
+	}
+}
+
+func FuzzEncryptedParse(f *testing.F) {
+	ciphertext := []byte("0123456789abcdef")
+	f.Add(byte(0), appendTestHeader(nil, nil, true, true, ciphertext))
+	f.Add(byte(0), appendTestHeader(nil, nil, false, false, ciphertext))
+	f.Add(byte(2), appendTestHeader(nil, []byte{1, 2}, true, false, ciphertext))
+	f.Add(byte(2), appendTestHeader(appendTestHeader(nil, []byte{1, 2}, false, true, ciphertext), []byte{1, 2}, false, false, nil))
+	f.Fuzz(func(t *testing.T, cidLength byte, datagram []byte) {
+		for len(datagram) != 0 { // empty datagram is checked by caller
+			var hdr Encrypted
+			n, err := hdr.Parse(datagram, int(cidLength%21)) // widening
+			if err != nil {
+				return
+			}
+			if n <= 0 || n > len(datagram) || len(hdr.Header)+len(hdr.Ciphertext) != n {
+				t.Fatalf("wrong record size %d", n)
+			}
+			if !bytes.Equal(datagram[:len(hdr.Header)], hdr.Header) || len(hdr.Ciphertext) > MaxCiphertextRecordLength {
+				t.Fatalf("wrong header or ciphertext")
+			}
+			if hdr.HasCID() && len(hdr.CID) != int(cidLength%21) { // widening
+				t.Fatalf("wrong CID length")
+			}
+			if (len(hdr.SeqNum) == 2) != hdr.Has16BitSeqNum() || (!hdr.HasLength() && n != len(datagram)) {
+				t.Fatalf("wrong sequence number or length")
+			}
+			datagram = datagram[n:]
+		}
+	})
+}
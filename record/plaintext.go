@@ -19,6 +19,8 @@ const (
 	RecordTypeApplicationData = 23
 	// PlaintextContentTypeHeartbeat       = 24 // [rfc6520] should not be received without negotiating extension. We choose to error on it.
 	RecordTypeAck = 26
+	// [draft-ietf-tls-dtls-rrc] should not be received without negotiating rrc extension.
+	RecordTypeReturnRoutabilityCheck = 27
 )
 
 type PlaintextHeader struct {
@@ -62,7 +64,7 @@ func (hdr *Plaintext) Parse(datagram []byte) (n int, err error) {
 	if length == 0 {
 		return 0, ErrPlaintextRecordBodyTooShort
 	}
-	if length > MaxPlaintextRecordLength { // TODO - generate record_overflow alert
+	if length > MaxPlaintextRecordLength { // unauthenticated, so silently discarded [rfc9147:4.5.2]
 		return 0, ErrPlaintextRecordBodyTooLong
 	}
 	endOffset := PlaintextRecordHeaderSize + length
@@ -0,0 +1,48 @@
+// Copyright (c) 2025, Grigory Buteyko aka Hrissan
+// Licensed under the MIT License. See LICENSE for details.
+
+package record
+
+import (
+	"errors"
+
+	"github.com/hrissan/dtls/format"
+)
+
+var ErrRRCMsgTypeParsing = errors.New("return_routability_check message type failed to parse")
+
+// [draft-ietf-tls-dtls-rrc] message type + cookie
+const RRCSize = 9
+
+const (
+	RRCPathChallenge = 0
+	RRCPathResponse  = 1
+	RRCPathDrop      = 2
+)
+
+// record with return_routability_check type must contain exactly one message.
+type RRC struct {
+	MsgType byte
+	Cookie  [8]byte
+}
+
+func (msg *RRC) Parse(body []byte) (err error) {
+	offset := 0
+	if offset, msg.MsgType, err = format.ParserReadByte(body, offset); err != nil {
+		return err
+	}
+	switch msg.MsgType {
+	case RRCPathChallenge, RRCPathResponse, RRCPathDrop:
+	default:
+		return ErrRRCMsgTypeParsing
+	}
+	if offset, err = format.ParserReadFixedBytes(body, offset, msg.Cookie[:]); err != nil {
+		return err
+	}
+	return format.ParserReadFinish(body, offset)
+}
+
+func (msg *RRC) Write(body []byte) []byte {
+	body = append(body, msg.MsgType)
+	return append(body, msg.Cookie[:]...)
+}
@@ -10,12 +10,19 @@ import (
 )
 
 // [rfc8446:4.4.3]
-var coveredContentPrefix = []byte("                                                                " +
+var coveredContentPrefixServer = []byte("                                                                " +
 	"TLS 1.3, server CertificateVerify\x00")
 
+var coveredContentPrefixClient = []byte("                                                                " +
+	"TLS 1.3, client CertificateVerify\x00")
+
 // like hash.Sum, appends hash to data and returns it
-func CalculateCoveredContentHash(hasher hash.Hash, certVerifyTranscriptHash []byte) ciphersuite.Hash {
-	_, _ = hasher.Write(coveredContentPrefix)
+func CalculateCoveredContentHash(hasher hash.Hash, roleServer bool, certVerifyTranscriptHash []byte) ciphersuite.Hash {
+	if roleServer {
+		_, _ = hasher.Write(coveredContentPrefixServer)
+	} else {
+		_, _ = hasher.Write(coveredContentPrefixClient)
+	}
 	_, _ = hasher.Write(certVerifyTranscriptHash)
 
 	var result ciphersuite.Hash
@@ -46,12 +46,33 @@ type Stats interface {
 	ServerHelloRetryRequestQueueOverloaded(addr netip.AddrPort)
 	CookieCreated(addr netip.AddrPort)
 	CookieChecked(valid bool, age time.Duration, addr netip.AddrPort)
+	HandshakeEvicted(addr netip.AddrPort)
+
+	// [rfc9147:7.1] ack scheduler, compare number of records to ack with number of ack records sent.
+	// recordsToAck were received since previous ack, immediateRecords of them required ack without delay.
+	AckSent(addr netip.AddrPort, recordsToAck int, immediateRecords int, recordsAcked int)
+
+	// connections waiting for handshake computations, reported on each push and pop
+	ComputeQueueDepth(depth int)
+	// precomputed key share was taken from pool (hit), or generated inline
+	KeySharePoolTake(hit bool)
 }
 
 type StatsLog struct {
 	level          atomic.Int32
 	printDatagrams atomic.Bool
 	printMessages  atomic.Bool
+
+	recordsToAck  atomic.Uint64
+	immediateAcks atomic.Uint64
+	acksSent      atomic.Uint64
+	recordsAcked  atomic.Uint64
+
+	computeQueueDepth    atomic.Int64
+	computeQueueMaxDepth atomic.Int64
+
+	keySharePoolHits   atomic.Uint64
+	keySharePoolMisses atomic.Uint64
 }
 
 func NewStatsLogVerbose() *StatsLog {
@@ -62,6 +83,13 @@ func NewStatsLogVerbose() *StatsLog {
 	return s
 }
 
+// for benchmarks, only counters are updated
+func NewStatsLogQuiet() *StatsLog {
+	s := &StatsLog{}
+	s.level.Store(-1)
+	return s
+}
+
 func (s *StatsLog) Warning(addr netip.AddrPort, err error) {
 	if s.level.Load() < 0 {
 		return
@@ -201,3 +229,55 @@ func (s *StatsLog) CookieChecked(valid bool, age time.Duration, addr netip.AddrP
 	}
 	fmt.Printf("dtls: cookie checked valid=%v age=%v for addr=%v\n", valid, age, addr)
 }
+
+func (s *StatsLog) HandshakeEvicted(addr netip.AddrPort) {
+	if s.level.Load() < 0 {
+		return
+	}
+	fmt.Printf("dtls: stalled handshake evicted addr=%v\n", addr)
+}
+
+func (s *StatsLog) AckSent(addr netip.AddrPort, recordsToAck int, immediateRecords int, recordsAcked int) {
+	s.recordsToAck.Add(uint64(recordsToAck))      // widening
+	s.immediateAcks.Add(uint64(immediateRecords)) // widening
+	s.acksSent.Add(1)
+	s.recordsAcked.Add(uint64(recordsAcked)) // widening
+	// too much even for verbose log, see AckCounters
+	if !s.printDatagrams.Load() {
+		return
+	}
+	fmt.Printf("dtls: ack for %d records sent to addr=%v\n", recordsAcked, addr)
+}
+
+// acks sent vs records received which needed ack, shows how well acks are coalesced
+func (s *StatsLog) AckCounters() (recordsToAck uint64, immediateAcks uint64, acksSent uint64, recordsAcked uint64) {
+	return s.recordsToAck.Load(), s.immediateAcks.Load(), s.acksSent.Load(), s.recordsAcked.Load()
+}
+
+func (s *StatsLog) ComputeQueueDepth(depth int) {
+	s.computeQueueDepth.Store(int64(depth)) // widening
+	for {
+		maxDepth := s.computeQueueMaxDepth.Load()
+		if int64(depth) <= maxDepth || s.computeQueueMaxDepth.CompareAndSwap(maxDepth, int64(depth)) { // widening
+			return
+		}
+	}
+}
+
+// last reported and max depth of compute queue, shows whether Options.ComputeGoroutines is enough
+func (s *StatsLog) ComputeQueueCounters() (depth int64, maxDepth int64) {
+	return s.computeQueueDepth.Load(), s.computeQueueMaxDepth.Load()
+}
+
+func (s *StatsLog) KeySharePoolTake(hit bool) {
+	if hit {
+		s.keySharePoolHits.Add(1)
+	} else {
+		s.keySharePoolMisses.Add(1)
+	}
+}
+
+// hit rate is hits / (hits + misses), low rate means KeySharePoolSize is too small for handshake rate
+func (s *StatsLog) KeySharePoolCounters() (hits uint64, misses uint64) {
+	return s.keySharePoolHits.Load(), s.keySharePoolMisses.Load()
+}